@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+func TestParseMCResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		strict  bool
+		want    string
+		wantErr bool
+		wantRPC bool
+	}{
+		{"2.0", `{"jsonrpc":"2.0","id":"1","result":[1]}`, false, `[1]`, false, false},
+		{"version-less", `{"id":"1","result":[1]}`, false, `[1]`, false, false},
+		{"other version", `{"jsonrpc":"1.0","id":"1","result":[1]}`, false, `[1]`, false, false},
+		{"strict 2.0", `{"jsonrpc":"2.0","id":"1","result":[1]}`, true, `[1]`, false, false},
+		{"strict version-less", `{"id":"1","result":[1]}`, true, ``, true, false},
+		{"strict other version", `{"jsonrpc":"1.0","id":"1","result":[1]}`, true, ``, true, false},
+		{"version-less error", `{"id":"1","error":{"code":-32601,"message":"nope"}}`, false, ``, true, true},
+		{"not json", `{`, false, ``, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMCResponse("rpc.discover", []byte(tt.data), tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var rpcErr *rpcError
+			if errors.As(err, &rpcErr) != tt.wantRPC {
+				t.Fatalf("err = %v, want rpc error %v", err, tt.wantRPC)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("result = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCallMinecraftIDs runs callMinecraft against a fake Minecraft server
+// that answers each request with its own id as the result, so the injected
+// ids are checked on the wire and through response correlation.
+func TestCallMinecraftIDs(t *testing.T) {
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mcConn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mcConn.Close(websocket.StatusNormalClosure, "")
+	minecraft := <-conns
+	defer minecraft.Close(websocket.StatusNormalClosure, "")
+
+	go func() {
+		for {
+			_, data, err := minecraft.Read(ctx)
+			if err != nil {
+				return
+			}
+			var req JSONRPC
+			if err := json.Unmarshal(data, &req); err != nil || req.ID == nil {
+				t.Errorf("minecraft got %s", data)
+				return
+			}
+			resp, _ := json.Marshal(JSONRPC{JSONRPC: "2.0", ID: req.ID, Result: *req.ID})
+			if err := minecraft.Write(ctx, websocket.MessageText, resp); err != nil {
+				return
+			}
+		}
+	}()
+
+	s := newSession(Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil, mcConn)
+	n := 0
+	s.newID = func() string {
+		n++
+		return fmt.Sprintf("call-%d", n)
+	}
+	go func() {
+		for {
+			_, data, err := mcConn.Read(ctx)
+			if err != nil {
+				return
+			}
+			s.handleMCMessage(ctx, data)
+		}
+	}()
+
+	for _, want := range []string{`"call-1"`, `"call-2"`, `"call-3"`} {
+		got, err := s.callMinecraft(ctx, "rpc.discover", nil)
+		if err != nil {
+			t.Fatalf("callMinecraft: %v", err)
+		}
+		if string(got) != want {
+			t.Fatalf("result = %s, want the id %s", got, want)
+		}
+	}
+	if len(s.pending) != 0 {
+		t.Fatalf("%d calls still pending", len(s.pending))
+	}
+}
+
+func TestDefaultAgentCallID(t *testing.T) {
+	a, b := newAgentCallID(), newAgentCallID()
+	if !strings.HasPrefix(a, "agent:") || !strings.HasPrefix(b, "agent:") {
+		t.Fatalf("ids %q and %q lack the agent: prefix", a, b)
+	}
+	if a == b {
+		t.Fatalf("two calls returned the same id %q", a)
+	}
+}
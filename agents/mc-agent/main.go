@@ -1,21 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
+	mathrand "math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -31,12 +40,40 @@ type Config struct {
 	MCInsecure        bool
 	MCTLSServerName   string
 	MCTLSRootCAs      *x509.CertPool
+	MCTLSPinSHA256    []byte
+	MCTLSMinVersion   uint16
+	MCTLSCipherSuites []uint16
 	MCDialTimeout     time.Duration
+	APIProxy          *url.URL
+	APITLSRootCAs     *x509.CertPool
 	BackoffInitial    time.Duration
 	BackoffMax        time.Duration
 	BackoffMultiplier float64
 	BackoffJitter     time.Duration
+	SlowReconnect     time.Duration
 	TelemetryInterval time.Duration
+	TelemetryForward  bool
+	TelemetryBatch    int
+	TelemetryGzip     bool
+	DiscoverInterval  time.Duration
+	DiscoverTimeout   time.Duration
+	DiscoverBackoff   time.Duration
+	DiscoverMaxWait   time.Duration
+	DiscoverAttempts  int
+	LogFrames         bool
+	LogFramesVerbose  bool
+	LogSample         float64
+	AgentName         string
+	LogForward        bool
+	LogForwardLevel   slog.Level
+	LogForwardRate    int
+	ChunkBytes        int
+	MCReadLimit       int64
+	MCStrictJSONRPC   bool
+	// MethodPolicy, when set, blocks API-forwarded methods above a role.
+	MethodPolicy *methodPolicy
+	// DrainURLs are the API endpoints a drain request may move the agent to.
+	DrainURLs []string
 }
 
 type JSONRPC struct {
@@ -48,6 +85,29 @@ type JSONRPC struct {
 	Error   json.RawMessage  `json:"error,omitempty"`
 }
 
+// rpcError is a JSON-RPC error object returned by Minecraft, as opposed to a
+// transport failure talking to it.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcMethodNotFound is the JSON-RPC 2.0 code for an unknown method.
+const rpcMethodNotFound = -32601
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("minecraft rpc error %d: %s", e.Code, e.Message)
+}
+
+// rpcPolicyDenied is the server-defined JSON-RPC code the agent answers with
+// when its method policy blocks a call.
+const rpcPolicyDenied = -32001
+
+func isMethodNotFound(err error) bool {
+	var rpcErr *rpcError
+	return errors.As(err, &rpcErr) && rpcErr.Code == rpcMethodNotFound
+}
+
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
@@ -60,14 +120,47 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	var logs *logForwarder
+	if cfg.LogForward {
+		logs = newLogForwarder(cfg.LogForwardRate)
+		logger = slog.New(&forwardingHandler{inner: logger.Handler(), min: cfg.LogForwardLevel, fwd: logs})
+	}
+
+	if cfg.AgentName != "" {
+		logger = logger.With(slog.String("agent_name", cfg.AgentName))
+	}
+
 	metrics := newTelemetry(logger, cfg.TelemetryInterval)
 	defer metrics.stop()
+	if cfg.TelemetryForward {
+		metrics.enablePush(cfg.TelemetryBatch)
+	}
+
+	// The server identity is learned from the first API handshake and then
+	// pinned to the root logger, so every later line and snapshot carries it.
+	identified := false
+	identify := func(serverID, serverName string) *slog.Logger {
+		if identified || serverID == "" {
+			return logger
+		}
+		identified = true
+		attrs := []any{slog.String("server_id", serverID)}
+		if cfg.AgentName == "" && serverName != "" {
+			attrs = append(attrs, slog.String("server_name", serverName))
+		}
+		logger = logger.With(attrs...)
+		metrics.setLogger(logger)
+		return logger
+	}
 
 	backoff := cfg.BackoffInitial
 	if backoff <= 0 {
 		backoff = time.Second
 	}
 	attempt := 1
+	// Zero until the first API session has been established; afterwards it
+	// holds when that link was last lost, which the next handshake reports.
+	var apiLostAt time.Time
 	for {
 		if ctx.Err() != nil {
 			return
@@ -75,8 +168,16 @@ func main() {
 
 		metrics.recordSessionStart()
 		started := time.Now()
-		err := runOnce(ctx, cfg, logger, metrics)
+		err := runOnce(ctx, cfg, logger, metrics, logs, identify, &apiLostAt)
 		duration := time.Since(started)
+		var drained *drainedError
+		if errors.As(err, &drained) {
+			if drained.url != "" {
+				cfg.APIURL = drained.url
+			}
+			logger.Info("session drained; reconnecting", slog.String("api", cfg.APIURL))
+			err = nil
+		}
 		if err != nil {
 			if ctx.Err() != nil || errors.Is(err, context.Canceled) {
 				metrics.recordSessionFailure(duration, err)
@@ -84,7 +185,17 @@ func main() {
 			}
 			metrics.recordSessionFailure(duration, err)
 			wait := applyJitter(backoff, cfg.BackoffJitter)
-			logger.Warn("agent session ended; scheduling reconnect", slog.Int("attempt", attempt), slog.Duration("backoff", wait), slog.Any("err", err))
+			switch mode, reason := classifySessionError(err); mode {
+			case reconnectStop:
+				logger.Error("agent session ended; not reconnecting", slog.String("reason", reason), slog.Any("err", err))
+				metrics.stop()
+				os.Exit(1)
+			case reconnectSlow:
+				wait = applyJitter(cfg.SlowReconnect, cfg.BackoffJitter)
+				logger.Warn("agent session ended; reconnecting slowly", slog.String("reason", reason), slog.Int("attempt", attempt), slog.Duration("backoff", wait), slog.Any("err", err))
+			default:
+				logger.Warn("agent session ended; scheduling reconnect", slog.Int("attempt", attempt), slog.Duration("backoff", wait), slog.Any("err", err))
+			}
 			attempt++
 			select {
 			case <-time.After(wait):
@@ -104,6 +215,73 @@ func main() {
 	}
 }
 
+// reconnectMode is how main reacts to a session that ended with an error.
+type reconnectMode int
+
+const (
+	reconnectNormal reconnectMode = iota
+	// reconnectSlow waits AGENT_SLOW_RECONNECT_DELAY instead of the usual
+	// backoff; reconnecting sooner would not help and may do harm.
+	reconnectSlow
+	// reconnectStop exits non-zero; no amount of retrying will succeed.
+	reconnectStop
+)
+
+// dialRejectedError is a WebSocket dial that reached its peer but was
+// refused with an HTTP status instead of upgraded.
+type dialRejectedError struct {
+	peer   string
+	status int
+	err    error
+}
+
+func (e *dialRejectedError) Error() string {
+	return fmt.Sprintf("%s rejected connection with HTTP %d: %v", e.peer, e.status, e.err)
+}
+
+func (e *dialRejectedError) Unwrap() error {
+	return e.err
+}
+
+// rejectedDial wraps a dial error with the response status when the peer
+// answered one.
+func rejectedDial(peer string, resp *http.Response, err error) error {
+	if resp == nil {
+		return err
+	}
+	return &dialRejectedError{peer: peer, status: resp.StatusCode, err: err}
+}
+
+// classifySessionError picks the reconnect mode for err and a short reason
+// for the log. Rejected credentials are terminal. Close codes and statuses
+// the API uses for a server that is suspended or has another agent are
+// slowed down: reconnecting at once would only replace the other agent, which
+// would then replace this one in turn.
+func classifySessionError(err error) (reconnectMode, string) {
+	var rejected *dialRejectedError
+	if errors.As(err, &rejected) {
+		switch rejected.status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return reconnectStop, rejected.peer + " rejected credentials"
+		case http.StatusLocked:
+			return reconnectSlow, "server suspended"
+		case http.StatusTooManyRequests:
+			return reconnectSlow, "connection limit reached"
+		}
+		return reconnectNormal, ""
+	}
+	var closeErr websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code == websocket.StatusPolicyViolation {
+		switch closeErr.Reason {
+		case "replaced":
+			return reconnectSlow, "replaced by another agent with the same token"
+		case "server suspended":
+			return reconnectSlow, "server suspended"
+		}
+	}
+	return reconnectNormal, ""
+}
+
 func loadConfig() (Config, error) {
 	insecureRaw := strings.TrimSpace(strings.ToLower(os.Getenv("MC_TLS_INSECURE")))
 	modeRaw := strings.TrimSpace(strings.ToLower(os.Getenv("MC_TLS_MODE")))
@@ -123,27 +301,110 @@ func loadConfig() (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	slowReconnect, err := durationFromEnv("AGENT_SLOW_RECONNECT_DELAY", 5*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
 	telemetryInterval, err := durationFromEnv("AGENT_TELEMETRY_INTERVAL", time.Minute)
 	if err != nil {
 		return Config{}, err
 	}
+	telemetryBatch, err := intFromEnv("AGENT_TELEMETRY_BATCH", 5)
+	if err != nil {
+		return Config{}, err
+	}
 	dialTimeout, err := durationFromEnv("MC_TLS_HANDSHAKE_TIMEOUT", 15*time.Second)
 	if err != nil {
 		return Config{}, err
 	}
+	discoverInterval, err := durationFromEnv("AGENT_DISCOVER_INTERVAL", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	discoverTimeout, err := durationFromEnv("AGENT_DISCOVER_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	discoverBackoff, err := durationFromEnv("AGENT_DISCOVER_BACKOFF_INITIAL", 5*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	discoverMaxWait, err := durationFromEnv("AGENT_DISCOVER_BACKOFF_MAX", time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	discoverAttempts, err := intFromEnv("AGENT_DISCOVER_MAX_ATTEMPTS", 0)
+	if err != nil {
+		return Config{}, err
+	}
 
-	caPath := strings.TrimSpace(os.Getenv("MC_TLS_ROOT_CA"))
-	var caPool *x509.CertPool
-	if caPath != "" {
-		pemBytes, err := os.ReadFile(caPath)
-		if err != nil {
-			return Config{}, fmt.Errorf("failed to read MC_TLS_ROOT_CA %q: %w", caPath, err)
-		}
-		pool := x509.NewCertPool()
-		if !pool.AppendCertsFromPEM(pemBytes) {
-			return Config{}, fmt.Errorf("invalid PEM data in MC_TLS_ROOT_CA %q", caPath)
+	caPool, err := certPoolFromEnv("MC_TLS_ROOT_CA")
+	if err != nil {
+		return Config{}, err
+	}
+	apiCAPool, err := certPoolFromEnv("CONDUIT_API_TLS_ROOT_CA")
+	if err != nil {
+		return Config{}, err
+	}
+
+	var apiProxy *url.URL
+	if raw := strings.TrimSpace(os.Getenv("CONDUIT_HTTPS_PROXY")); raw != "" {
+		apiProxy, err = url.Parse(raw)
+		if err != nil || apiProxy.Host == "" {
+			return Config{}, fmt.Errorf("invalid CONDUIT_HTTPS_PROXY %q", raw)
 		}
-		caPool = pool
+	}
+
+	logSample, err := floatFromEnv("AGENT_LOG_SAMPLE", 1.0)
+	if err != nil {
+		return Config{}, err
+	}
+	logForwardLevel, err := parseLogLevel("AGENT_FORWARD_LOG_LEVEL", os.Getenv("AGENT_FORWARD_LOG_LEVEL"))
+	if err != nil {
+		return Config{}, err
+	}
+	logForwardRate, err := intFromEnv("AGENT_FORWARD_LOG_RATE", 30)
+	if err != nil {
+		return Config{}, err
+	}
+	chunkBytes, err := intFromEnv("AGENT_RESPONSE_CHUNK_BYTES", 16384)
+	if err != nil {
+		return Config{}, err
+	}
+	mcReadLimit, err := intFromEnv("MC_READ_LIMIT_BYTES", 16<<20)
+	if err != nil {
+		return Config{}, err
+	}
+
+	policy, err := loadMethodPolicy()
+	if err != nil {
+		return Config{}, err
+	}
+
+	agentToken, err := secretFromEnv("CONDUIT_AGENT_TOKEN")
+	if err != nil {
+		return Config{}, err
+	}
+	mcToken, err := secretFromEnv("MC_MGMT_TOKEN")
+	if err != nil {
+		return Config{}, err
+	}
+
+	pin, err := parseCertPin(os.Getenv("MC_TLS_PIN_SHA256"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	minVersion, err := parseTLSVersion(os.Getenv("MC_TLS_MIN_VERSION"))
+	if err != nil {
+		return Config{}, err
+	}
+	cipherSuites, err := parseCipherSuites(os.Getenv("MC_TLS_CIPHER_SUITES"))
+	if err != nil {
+		return Config{}, err
+	}
+	if len(cipherSuites) > 0 && minVersion == tls.VersionTLS13 {
+		return Config{}, errors.New("MC_TLS_CIPHER_SUITES has no effect with MC_TLS_MIN_VERSION=1.3; TLS 1.3 suites are not configurable")
 	}
 
 	serverName := strings.TrimSpace(os.Getenv("MC_TLS_SERVER_NAME"))
@@ -161,23 +422,52 @@ func loadConfig() (Config, error) {
 
 	cfg := Config{
 		APIURL:            strings.TrimSpace(os.Getenv("CONDUIT_API_WS")),
-		AgentToken:        strings.TrimSpace(os.Getenv("CONDUIT_AGENT_TOKEN")),
+		AgentToken:        strings.TrimSpace(agentToken),
 		MCURL:             strings.TrimSpace(os.Getenv("MC_MGMT_WS")),
-		MCToken:           strings.TrimSpace(os.Getenv("MC_MGMT_TOKEN")),
+		MCToken:           strings.TrimSpace(mcToken),
 		MCInsecure:        mcInsecure,
 		MCTLSServerName:   serverName,
 		MCTLSRootCAs:      caPool,
+		MCTLSPinSHA256:    pin,
+		MCTLSMinVersion:   minVersion,
+		MCTLSCipherSuites: cipherSuites,
 		MCDialTimeout:     dialTimeout,
+		APIProxy:          apiProxy,
+		APITLSRootCAs:     apiCAPool,
 		BackoffInitial:    initialBackoff,
 		BackoffMax:        maxBackoff,
 		BackoffMultiplier: multiplier,
 		BackoffJitter:     jitter,
+		SlowReconnect:     slowReconnect,
 		TelemetryInterval: telemetryInterval,
+		TelemetryForward:  boolFromEnv("AGENT_FORWARD_TELEMETRY"),
+		TelemetryBatch:    telemetryBatch,
+		TelemetryGzip:     boolFromEnv("AGENT_TELEMETRY_GZIP"),
+		DiscoverInterval:  discoverInterval,
+		DiscoverTimeout:   discoverTimeout,
+		DiscoverBackoff:   discoverBackoff,
+		DiscoverMaxWait:   discoverMaxWait,
+		DiscoverAttempts:  discoverAttempts,
+		LogFrames:         boolFromEnv("AGENT_LOG_FRAMES"),
+		LogFramesVerbose:  boolFromEnv("AGENT_LOG_FRAMES_VERBOSE"),
+		LogSample:         logSample,
+		AgentName:         strings.TrimSpace(os.Getenv("AGENT_NAME")),
+		LogForward:        boolFromEnv("AGENT_FORWARD_LOGS"),
+		LogForwardLevel:   logForwardLevel,
+		LogForwardRate:    logForwardRate,
+		ChunkBytes:        chunkBytes,
+		MCReadLimit:       int64(mcReadLimit),
+		MCStrictJSONRPC:   boolFromEnv("MC_RPC_STRICT_VERSION"),
+		MethodPolicy:      policy,
+		DrainURLs:         splitList(os.Getenv("AGENT_DRAIN_URLS")),
 	}
 
 	if cfg.APIURL == "" || cfg.AgentToken == "" || cfg.MCURL == "" || cfg.MCToken == "" {
 		return Config{}, errors.New("missing required environment variables")
 	}
+	if len(cfg.MCTLSPinSHA256) > 0 && cfg.MCInsecure {
+		return Config{}, errors.New("MC_TLS_PIN_SHA256 cannot be combined with MC_TLS_MODE=skip or MC_TLS_INSECURE")
+	}
 	if cfg.BackoffInitial <= 0 {
 		cfg.BackoffInitial = time.Second
 	}
@@ -190,16 +480,254 @@ func loadConfig() (Config, error) {
 	if cfg.BackoffJitter < 0 {
 		cfg.BackoffJitter = 0
 	}
+	if cfg.SlowReconnect < cfg.BackoffMax {
+		cfg.SlowReconnect = cfg.BackoffMax
+	}
+	if cfg.DiscoverInterval < 0 {
+		cfg.DiscoverInterval = 0
+	}
+	if cfg.DiscoverTimeout <= 0 {
+		cfg.DiscoverTimeout = 10 * time.Second
+	}
+	if cfg.DiscoverBackoff <= 0 {
+		cfg.DiscoverBackoff = 5 * time.Second
+	}
+	if cfg.DiscoverMaxWait < cfg.DiscoverBackoff {
+		cfg.DiscoverMaxWait = cfg.DiscoverBackoff
+	}
+	if cfg.DiscoverAttempts < 0 {
+		cfg.DiscoverAttempts = 0
+	}
+	if cfg.LogSample <= 0 || cfg.LogSample > 1 {
+		cfg.LogSample = 1
+	}
+	if cfg.LogForwardRate < 0 {
+		cfg.LogForwardRate = 0
+	}
+	// A full batch must fit in one frame under the API's 32 KiB limit.
+	if cfg.TelemetryBatch < 1 || cfg.TelemetryBatch > maxTelemetryBatch {
+		return Config{}, fmt.Errorf("AGENT_TELEMETRY_BATCH must be between 1 and %d", maxTelemetryBatch)
+	}
+	if cfg.ChunkBytes < 0 {
+		cfg.ChunkBytes = 0
+	}
+	// Base64 grows each chunk by a third; the API reads at most 32 KiB per frame.
+	if cfg.ChunkBytes > maxChunkBytes {
+		return Config{}, fmt.Errorf("AGENT_RESPONSE_CHUNK_BYTES must be at most %d", maxChunkBytes)
+	}
+	if cfg.MCReadLimit <= 0 {
+		cfg.MCReadLimit = 16 << 20
+	}
 
 	return cfg, nil
 }
 
+// methodRule mirrors one of the API's RBAC rules: the first rule whose prefix
+// matches a method decides the role the method needs.
+type methodRule struct {
+	Prefix string `json:"prefix"`
+	Role   string `json:"role"`
+}
+
+// defaultMethodRules is a copy of the API's rbacRules. Keep the two in step;
+// AGENT_METHOD_POLICY_FILE can replace it without a rebuild.
+var defaultMethodRules = []methodRule{
+	{Prefix: "minecraft:server/stop", Role: "owner"},
+	{Prefix: "minecraft:server/save", Role: "moderator"},
+	{Prefix: "minecraft:server/system_message", Role: "moderator"},
+	{Prefix: "minecraft:server/status", Role: "viewer"},
+	{Prefix: "minecraft:server/console", Role: "moderator"},
+	{Prefix: "minecraft:players/", Role: "moderator"},
+	{Prefix: "minecraft:players", Role: "viewer"},
+	{Prefix: "minecraft:gamerules/update", Role: "moderator"},
+	{Prefix: "minecraft:gamerules", Role: "viewer"},
+	{Prefix: "minecraft:serversettings/", Role: "moderator"},
+	{Prefix: "minecraft:allowlist/", Role: "moderator"},
+	{Prefix: "minecraft:allowlist", Role: "viewer"},
+	{Prefix: "minecraft:operators/", Role: "moderator"},
+	{Prefix: "minecraft:operators", Role: "moderator"},
+	{Prefix: "minecraft:bans/", Role: "moderator"},
+	{Prefix: "minecraft:bans", Role: "moderator"},
+	{Prefix: "minecraft:ip_bans/", Role: "moderator"},
+	{Prefix: "minecraft:ip_bans", Role: "moderator"},
+}
+
+var roleRank = map[string]int{"viewer": 1, "moderator": 2, "owner": 3}
+
+// methodPolicy is the agent's own copy of the role model. The agent does not
+// know who made a call, so it caps what the API may ask for at all: methods
+// that need more than maxRole are refused whatever the API decided.
+type methodPolicy struct {
+	maxRole string
+	rules   []methodRule
+	// overrideMax caps how long an API-pushed override may last; zero
+	// refuses overrides.
+	overrideMax time.Duration
+
+	mu sync.Mutex
+	// overrides maps a method, or a prefix ending in "*", to when the
+	// temporary allowance for it expires.
+	overrides map[string]time.Time
+}
+
+// loadMethodPolicy reads AGENT_METHOD_POLICY_MAX_ROLE and, optionally, a JSON
+// rule list from AGENT_METHOD_POLICY_FILE. It returns nil when no maximum
+// role is set, which leaves the policy off.
+func loadMethodPolicy() (*methodPolicy, error) {
+	maxRole := strings.TrimSpace(strings.ToLower(os.Getenv("AGENT_METHOD_POLICY_MAX_ROLE")))
+	path := strings.TrimSpace(os.Getenv("AGENT_METHOD_POLICY_FILE"))
+	if maxRole == "" {
+		if path != "" {
+			return nil, errors.New("AGENT_METHOD_POLICY_FILE requires AGENT_METHOD_POLICY_MAX_ROLE")
+		}
+		if os.Getenv("AGENT_POLICY_OVERRIDE_MAX") != "" {
+			return nil, errors.New("AGENT_POLICY_OVERRIDE_MAX requires AGENT_METHOD_POLICY_MAX_ROLE")
+		}
+		return nil, nil
+	}
+	if roleRank[maxRole] == 0 {
+		return nil, fmt.Errorf("invalid AGENT_METHOD_POLICY_MAX_ROLE %q", maxRole)
+	}
+	overrideMax, err := durationFromEnv("AGENT_POLICY_OVERRIDE_MAX", 0)
+	if err != nil {
+		return nil, err
+	}
+	if overrideMax < 0 {
+		return nil, errors.New("AGENT_POLICY_OVERRIDE_MAX must not be negative")
+	}
+
+	rules := defaultMethodRules
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read AGENT_METHOD_POLICY_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("parse AGENT_METHOD_POLICY_FILE: %w", err)
+		}
+		for _, rule := range rules {
+			if rule.Prefix == "" || roleRank[rule.Role] == 0 {
+				return nil, fmt.Errorf("AGENT_METHOD_POLICY_FILE: invalid rule %+v", rule)
+			}
+		}
+	}
+	return &methodPolicy{maxRole: maxRole, rules: rules, overrideMax: overrideMax, overrides: make(map[string]time.Time)}, nil
+}
+
+// requiredRole matches the API: unlisted methods need owner.
+func (p *methodPolicy) requiredRole(method string) string {
+	for _, rule := range p.rules {
+		if strings.HasPrefix(method, rule.Prefix) {
+			return rule.Role
+		}
+	}
+	return "owner"
+}
+
+func (p *methodPolicy) allows(method string) bool {
+	// The API's schema probe relays rpc.discover, which only reads.
+	if method == "rpc.discover" {
+		return true
+	}
+	return roleRank[p.requiredRole(method)] <= roleRank[p.maxRole] || p.overridden(method)
+}
+
+// overridden reports whether an unexpired override covers method.
+func (p *methodPolicy) overridden(method string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for pattern, expires := range p.overrides {
+		if !now.Before(expires) {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); (ok && strings.HasPrefix(method, prefix)) || pattern == method {
+			return true
+		}
+	}
+	return false
+}
+
+// applyOverride allows methods for d, capped at AGENT_POLICY_OVERRIDE_MAX,
+// and returns when the allowance ends.
+func (p *methodPolicy) applyOverride(methods []string, d time.Duration) (time.Time, error) {
+	if p.overrideMax <= 0 {
+		return time.Time{}, errors.New("policy overrides are disabled; set AGENT_POLICY_OVERRIDE_MAX to accept them")
+	}
+	if len(methods) == 0 || d <= 0 {
+		return time.Time{}, errors.New("override needs methods and a positive duration")
+	}
+	expires := time.Now().Add(min(d, p.overrideMax))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, method := range methods {
+		p.overrides[method] = expires
+	}
+	return expires, nil
+}
+
+// expireOverrides drops overrides that have run out and returns their
+// methods.
+func (p *methodPolicy) expireOverrides() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var expired []string
+	for method, expires := range p.overrides {
+		if !now.Before(expires) {
+			expired = append(expired, method)
+			delete(p.overrides, method)
+		}
+	}
+	slices.Sort(expired)
+	return expired
+}
+
+func certPoolFromEnv(key string) (*x509.CertPool, error) {
+	caPath := strings.TrimSpace(os.Getenv(key))
+	if caPath == "" {
+		return nil, nil
+	}
+	pemBytes, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %q: %w", key, caPath, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("invalid PEM data in %s %q", key, caPath)
+	}
+	return pool, nil
+}
+
+// buildAPIHTTPClient returns the client used to dial Conduit. It always
+// honors proxy settings, preferring CONDUIT_HTTPS_PROXY over the standard
+// HTTP(S)_PROXY variables.
+func (cfg Config) buildAPIHTTPClient() *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+	if cfg.APIProxy != nil {
+		transport.Proxy = http.ProxyURL(cfg.APIProxy)
+	}
+	if strings.HasPrefix(strings.ToLower(cfg.APIURL), "wss://") {
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    cfg.APITLSRootCAs,
+		}
+	}
+	return &http.Client{Transport: transport}
+}
+
 func (cfg Config) buildMCTLSConfig() *tls.Config {
 	if !strings.HasPrefix(strings.ToLower(cfg.MCURL), "wss://") {
 		return nil
 	}
 	tlsCfg := &tls.Config{
-		MinVersion: tls.VersionTLS12,
+		MinVersion:   cfg.MCTLSMinVersion,
+		CipherSuites: cfg.MCTLSCipherSuites,
+	}
+	if tlsCfg.MinVersion == 0 {
+		tlsCfg.MinVersion = tls.VersionTLS12
 	}
 	if cfg.MCTLSServerName != "" {
 		tlsCfg.ServerName = cfg.MCTLSServerName
@@ -210,22 +738,115 @@ func (cfg Config) buildMCTLSConfig() *tls.Config {
 	if cfg.MCInsecure {
 		tlsCfg.InsecureSkipVerify = true
 	}
+	if len(cfg.MCTLSPinSHA256) > 0 {
+		// The pin replaces chain verification, so CA validity is not consulted.
+		pin := cfg.MCTLSPinSHA256
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("minecraft server presented no certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if subtle.ConstantTimeCompare(sum[:], pin) != 1 {
+				return fmt.Errorf("minecraft certificate fingerprint %s does not match MC_TLS_PIN_SHA256", hex.EncodeToString(sum[:]))
+			}
+			return nil
+		}
+	}
 	return tlsCfg
 }
 
-func runOnce(ctx context.Context, cfg Config, logger *slog.Logger, metrics *telemetry) error {
+func parseTLSVersion(raw string) (uint16, error) {
+	switch strings.TrimSpace(raw) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid MC_TLS_MIN_VERSION %q; expected 1.2 or 1.3", raw)
+	}
+}
+
+// parseCipherSuites maps a comma-separated list of Go cipher suite names
+// (e.g. TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384) to IDs. Only suites Go
+// considers secure are accepted.
+func parseCipherSuites(raw string) ([]uint16, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q in MC_TLS_CIPHER_SUITES", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseCertPin(raw string) ([]byte, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	normalized := strings.ToLower(strings.ReplaceAll(raw, ":", ""))
+	pin, err := hex.DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MC_TLS_PIN_SHA256: %w", err)
+	}
+	if len(pin) != sha256.Size {
+		return nil, fmt.Errorf("invalid MC_TLS_PIN_SHA256: expected %d bytes, got %d", sha256.Size, len(pin))
+	}
+	return pin, nil
+}
+
+// runOnce runs a single bridge session. apiLostAt is read to tell the API
+// how long the agent was away and is updated once an established API
+// session ends.
+func runOnce(ctx context.Context, cfg Config, logger *slog.Logger, metrics *telemetry, logs *logForwarder, identify func(serverID, serverName string) *slog.Logger, apiLostAt *time.Time) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	apiHeader := http.Header{}
 	apiHeader.Set("Authorization", "Bearer "+cfg.AgentToken)
+	features := "drain"
+	if cfg.MethodPolicy != nil && cfg.MethodPolicy.overrideMax > 0 {
+		features += ",policy_override"
+	}
+	if cfg.TelemetryForward {
+		features += ",telemetry"
+		if cfg.TelemetryGzip {
+			features += ",telemetry_gzip"
+		}
+	}
+	apiHeader.Set("X-Conduit-Agent-Features", features)
+	if !apiLostAt.IsZero() {
+		apiHeader.Set("X-Conduit-Agent-Reconnect", "1")
+		apiHeader.Set("X-Conduit-Agent-Downtime-Ms", strconv.FormatInt(time.Since(*apiLostAt).Milliseconds(), 10))
+	}
 	apiDialStart := time.Now()
-	apiConn, _, err := websocket.Dial(ctx, cfg.APIURL, &websocket.DialOptions{HTTPHeader: apiHeader})
+	apiConn, apiResp, err := websocket.Dial(ctx, cfg.APIURL, &websocket.DialOptions{
+		HTTPHeader: apiHeader,
+		HTTPClient: cfg.buildAPIHTTPClient(),
+	})
 	if err != nil {
 		metrics.recordDialFailure("api", err)
-		return err
+		return rejectedDial("api", apiResp, err)
 	}
 	metrics.recordDialSuccess("api", time.Since(apiDialStart))
+	defer func() { *apiLostAt = time.Now() }()
+	serverName, _ := url.PathUnescape(apiResp.Header.Get("X-Conduit-Server-Name"))
+	logger = identify(apiResp.Header.Get("X-Conduit-Server-Id"), serverName)
 
 	mcHeader := http.Header{}
 	mcHeader.Set("Authorization", "Bearer "+cfg.MCToken)
@@ -237,7 +858,7 @@ func runOnce(ctx context.Context, cfg Config, logger *slog.Logger, metrics *tele
 		tlsCfg := cfg.buildMCTLSConfig()
 		if tlsCfg != nil {
 			transport.TLSClientConfig = tlsCfg
-			if tlsCfg.InsecureSkipVerify {
+			if cfg.MCInsecure {
 				logger.Warn("minecraft TLS verification disabled", slog.String("mc_url", cfg.MCURL))
 			}
 		}
@@ -249,44 +870,74 @@ func runOnce(ctx context.Context, cfg Config, logger *slog.Logger, metrics *tele
 	}
 
 	mcDialStart := time.Now()
-	mcConn, _, err := websocket.Dial(ctx, cfg.MCURL, mcDialOpts)
+	mcConn, mcResp, err := websocket.Dial(ctx, cfg.MCURL, mcDialOpts)
 	if err != nil {
 		metrics.recordDialFailure("minecraft", err)
 		apiConn.Close(websocket.StatusInternalError, "mc dial failed")
-		return err
+		return rejectedDial("minecraft", mcResp, err)
 	}
 	metrics.recordDialSuccess("minecraft", time.Since(mcDialStart))
+	mcConn.SetReadLimit(cfg.MCReadLimit)
 
-	session := newSession(cfg, logger, metrics, apiConn, mcConn)
+	session := newSession(cfg, logger, metrics, logs, apiConn, mcConn)
+	session.hubFeatures = parseFeatures(apiResp.Header.Get("X-Conduit-Hub-Features"))
 	return session.run(ctx)
 }
 
 type session struct {
-	cfg     Config
-	logger  *slog.Logger
-	metrics *telemetry
-	apiConn *websocket.Conn
-	mcConn  *websocket.Conn
-	pendMu  sync.Mutex
-	pending map[string]chan []byte
+	cfg        Config
+	logger     *slog.Logger
+	metrics    *telemetry
+	logs       *logForwarder
+	apiConn    *websocket.Conn
+	mcConn     *websocket.Conn
+	pendMu     sync.Mutex
+	pending    map[string]chan []byte
+	discoverMu sync.Mutex
+	schemaHash string
+	drainOnce  sync.Once
+	drained    chan error
+	// invalidLog rate-limits invalid payload warnings from Minecraft.
+	invalidLog logThrottle
+	// newID returns the id for agent-originated Minecraft calls. Tests can
+	// swap in a counter to make correlation deterministic.
+	newID func() string
+	// hubFeatures is what the API listed in X-Conduit-Hub-Features. APIs
+	// that predate the header list nothing.
+	hubFeatures map[string]bool
 }
 
-func newSession(cfg Config, logger *slog.Logger, metrics *telemetry, apiConn, mcConn *websocket.Conn) *session {
+func newSession(cfg Config, logger *slog.Logger, metrics *telemetry, logs *logForwarder, apiConn, mcConn *websocket.Conn) *session {
 	return &session{
 		cfg:     cfg,
 		logger:  logger,
 		metrics: metrics,
+		logs:    logs,
 		apiConn: apiConn,
 		mcConn:  mcConn,
 		pending: make(map[string]chan []byte),
+		drained: make(chan error, 1),
+		newID:   newAgentCallID,
 	}
 }
 
+// newAgentCallID is the default session.newID. The prefix keeps agent calls
+// apart from ids the API forwards.
+func newAgentCallID() string {
+	return "agent:" + uuid.NewString()
+}
+
 func (s *session) run(ctx context.Context) error {
 	s.logger.Info("bridge established", slog.String("api", s.cfg.APIURL), slog.String("minecraft", s.cfg.MCURL))
 	s.metrics.recordBridgeEstablished()
 
 	go s.discoverLoop(ctx)
+	if s.logs != nil {
+		go s.forwardLogs(ctx)
+	}
+	if s.metrics.pushing() && s.hubFeatures["telemetry"] {
+		go s.forwardTelemetry(ctx, s.cfg.TelemetryGzip && s.hubFeatures["telemetry_gzip"])
+	}
 
 	errCh := make(chan error, 2)
 	go func() { errCh <- s.pipeAPIToMC(ctx) }()
@@ -299,6 +950,9 @@ func (s *session) run(ctx context.Context) error {
 	case err := <-errCh:
 		s.close()
 		return err
+	case err := <-s.drained:
+		s.close()
+		return err
 	}
 }
 
@@ -315,7 +969,7 @@ func (s *session) close() {
 }
 
 func (s *session) discoverLoop(ctx context.Context) {
-	backoff := 5 * time.Second
+	backoff := s.cfg.DiscoverBackoff
 	attempt := 0
 
 	for {
@@ -333,26 +987,53 @@ func (s *session) discoverLoop(ctx context.Context) {
 				s.logger.Info("rpc.discover succeeded", slog.Int("attempt", attempt))
 			}
 			s.metrics.recordDiscover(true, nil)
-			return
+
+			// An interval of zero keeps the original discover-once behavior.
+			if s.cfg.DiscoverInterval <= 0 {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.cfg.DiscoverInterval):
+			}
+			backoff = s.cfg.DiscoverBackoff
+			attempt = 0
+			continue
 		}
 
 		if errors.Is(err, context.Canceled) || websocket.CloseStatus(err) != -1 {
 			return
 		}
 
-		s.logger.Warn("rpc.discover attempt failed", slog.Int("attempt", attempt), slog.Any("err", err))
 		s.metrics.recordDiscover(false, err)
 
+		// A server without rpc.discover will never grow one; retrying only
+		// adds noise to its logs.
+		if isMethodNotFound(err) {
+			s.logger.Error("rpc.discover not supported by minecraft; giving up", slog.Int("attempt", attempt), slog.Any("err", err))
+			return
+		}
+
+		// Plain forwarding keeps working without a schema, so stop once
+		// the configured number of consecutive failures is reached.
+		if s.cfg.DiscoverAttempts > 0 && attempt >= s.cfg.DiscoverAttempts {
+			s.logger.Error("rpc.discover failed too many times; giving up", slog.Int("attempt", attempt), slog.Any("err", err))
+			return
+		}
+
+		s.logger.Warn("rpc.discover attempt failed", slog.Int("attempt", attempt), slog.Any("err", err))
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-time.After(backoff):
 		}
 
-		if backoff < time.Minute {
+		if backoff < s.cfg.DiscoverMaxWait {
 			backoff *= 2
-			if backoff > time.Minute {
-				backoff = time.Minute
+			if backoff > s.cfg.DiscoverMaxWait {
+				backoff = s.cfg.DiscoverMaxWait
 			}
 		}
 	}
@@ -382,13 +1063,151 @@ func (s *session) pipeAPIToMC(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		if s.handleAPIControl(data) {
+			continue
+		}
+		denied, err := s.enforcePolicy(ctx, data)
+		if err != nil {
+			return err
+		}
+		if denied {
+			continue
+		}
 		if err := s.mcConn.Write(ctx, websocket.MessageText, data); err != nil {
 			return err
 		}
+		s.logFrame("api_to_mc", data)
 		s.metrics.recordForwardAPIToMC()
 	}
 }
 
+// maxDrainDelay caps how long a drain request can keep the old session open.
+const maxDrainDelay = 30 * time.Second
+
+// drainedError ends a session the API asked the agent to leave. url, when
+// set, is the API endpoint to dial next.
+type drainedError struct {
+	url string
+}
+
+func (e *drainedError) Error() string {
+	return "session drained by api"
+}
+
+// handleAPIControl consumes control frames from the API, which are never
+// meant for Minecraft. It reports whether data was one.
+func (s *session) handleAPIControl(data []byte) bool {
+	if !bytes.Contains(data, []byte(`"_control"`)) {
+		return false
+	}
+	var ctrl struct {
+		Control    string   `json:"_control"`
+		DelayMS    int64    `json:"delay_ms"`
+		URL        string   `json:"url"`
+		Methods    []string `json:"methods"`
+		DurationMS int64    `json:"duration_ms"`
+	}
+	if err := json.Unmarshal(data, &ctrl); err != nil || ctrl.Control == "" {
+		return false
+	}
+	switch ctrl.Control {
+	case "drain":
+		s.scheduleDrain(time.Duration(ctrl.DelayMS)*time.Millisecond, ctrl.URL)
+	case "policy_override":
+		s.applyPolicyOverride(ctrl.Methods, time.Duration(ctrl.DurationMS)*time.Millisecond)
+	default:
+		s.logger.Info("unknown control message from api", slog.String("type", ctrl.Control))
+	}
+	return true
+}
+
+// scheduleDrain ends the session after delay, capped at maxDrainDelay, so
+// the main loop dials again straight away. A new URL is only honored when
+// it is listed in AGENT_DRAIN_URLS, since the agent token goes with it.
+func (s *session) scheduleDrain(delay time.Duration, target string) {
+	delay = min(max(delay, 0), maxDrainDelay)
+	if target != "" && !slices.Contains(s.cfg.DrainURLs, target) {
+		s.logger.Warn("ignoring drain url not listed in AGENT_DRAIN_URLS", slog.String("url", target))
+		target = ""
+	}
+	s.drainOnce.Do(func() {
+		s.logger.Info("api requested drain", slog.Duration("delay", delay), slog.String("url", target))
+		time.AfterFunc(delay, func() {
+			s.drained <- &drainedError{url: target}
+		})
+	})
+}
+
+// applyPolicyOverride lets the API temporarily allow methods the policy
+// blocks, for maintenance. The allowance belongs to the policy rather than
+// the session, so it survives a reconnect and runs out on its own.
+func (s *session) applyPolicyOverride(methods []string, d time.Duration) {
+	policy := s.cfg.MethodPolicy
+	if policy == nil {
+		s.logger.Warn("ignoring policy override: no method policy is set")
+		return
+	}
+	expires, err := policy.applyOverride(methods, d)
+	if err != nil {
+		s.logger.Warn("refusing policy override", slog.Any("methods", methods), slog.Any("err", err))
+		return
+	}
+	s.logger.Warn("agent policy override applied", slog.Any("methods", methods), slog.Time("expires_at", expires))
+	s.metrics.recordPolicyOverride()
+
+	logger, metrics := s.logger, s.metrics
+	time.AfterFunc(time.Until(expires), func() {
+		if expired := policy.expireOverrides(); len(expired) > 0 {
+			logger.Info("agent policy override expired", slog.Any("methods", expired))
+			metrics.recordPolicyOverrideExpiry(len(expired))
+		}
+	})
+}
+
+// enforcePolicy checks an API frame against AGENT_METHOD_POLICY_MAX_ROLE. A
+// blocked call is answered with a JSON-RPC error so the API caller is not
+// left waiting; a blocked notification is dropped. Frames that are not a
+// single JSON object, such as batches, are dropped while the policy is on
+// because their methods cannot be checked one by one.
+func (s *session) enforcePolicy(ctx context.Context, data []byte) (bool, error) {
+	policy := s.cfg.MethodPolicy
+	if policy == nil {
+		return false, nil
+	}
+	var env struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		s.logger.Warn("dropping frame the method policy cannot check", slog.Any("err", err))
+		s.metrics.recordPolicyViolation()
+		return true, nil
+	}
+	if env.Method == "" || policy.allows(env.Method) {
+		return false, nil
+	}
+
+	s.logger.Warn("method blocked by agent policy",
+		slog.String("method", env.Method),
+		slog.String("required_role", policy.requiredRole(env.Method)),
+		slog.String("max_role", policy.maxRole))
+	s.metrics.recordPolicyViolation()
+	if len(env.ID) == 0 || string(env.ID) == "null" {
+		return true, nil
+	}
+
+	id := json.RawMessage(env.ID)
+	errObj, err := json.Marshal(rpcError{Code: rpcPolicyDenied, Message: "method not permitted by agent policy"})
+	if err != nil {
+		return true, err
+	}
+	resp, err := json.Marshal(JSONRPC{JSONRPC: "2.0", ID: &id, Error: errObj})
+	if err != nil {
+		return true, err
+	}
+	return true, s.apiConn.Write(ctx, websocket.MessageText, resp)
+}
+
 func (s *session) pipeMCToAPI(ctx context.Context) error {
 	for {
 		_, data, err := s.mcConn.Read(ctx)
@@ -402,17 +1221,90 @@ func (s *session) pipeMCToAPI(ctx context.Context) error {
 		if handled {
 			continue
 		}
-		if err := s.apiConn.Write(ctx, websocket.MessageText, data); err != nil {
+		if err := s.forwardToAPI(ctx, data); err != nil {
 			return err
 		}
+		s.logFrame("mc_to_api", data)
 		s.metrics.recordForwardMCToAPI()
 	}
 }
 
+const maxChunkBytes = 24 << 10
+
+// forwardToAPI relays a Minecraft frame to the API. Responses larger than
+// AGENT_RESPONSE_CHUNK_BYTES are split into "chunk" control frames so each
+// stays under the API's per-message read limit and can be streamed onward.
+func (s *session) forwardToAPI(ctx context.Context, data []byte) error {
+	if s.cfg.ChunkBytes <= 0 || len(data) <= s.cfg.ChunkBytes {
+		return s.apiConn.Write(ctx, websocket.MessageText, data)
+	}
+	var env struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil || len(env.ID) == 0 || string(env.ID) == "null" || env.Method != "" {
+		return s.apiConn.Write(ctx, websocket.MessageText, data)
+	}
+
+	for seq, offset := 0, 0; offset < len(data); seq++ {
+		end := min(offset+s.cfg.ChunkBytes, len(data))
+		payload, err := json.Marshal(struct {
+			Control string          `json:"_control"`
+			ID      json.RawMessage `json:"id"`
+			Seq     int             `json:"seq"`
+			Data    []byte          `json:"data"`
+			Final   bool            `json:"final"`
+		}{Control: "chunk", ID: env.ID, Seq: seq, Data: data[offset:end], Final: end == len(data)})
+		if err != nil {
+			return err
+		}
+		if err := s.apiConn.Write(ctx, websocket.MessageText, payload); err != nil {
+			return err
+		}
+		offset = end
+	}
+	return nil
+}
+
+// logFrame records a sampled view of a forwarded frame. By default only the
+// envelope (method, id, size) is logged; AGENT_LOG_FRAMES_VERBOSE adds the
+// payload, which may contain player data.
+func (s *session) logFrame(direction string, data []byte) {
+	if !s.cfg.LogFrames {
+		return
+	}
+	if s.cfg.LogSample < 1 && mathrand.Float64() >= s.cfg.LogSample {
+		return
+	}
+
+	var env struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Error  json.RawMessage `json:"error"`
+	}
+	_ = json.Unmarshal(data, &env)
+
+	attrs := []any{
+		slog.String("direction", direction),
+		slog.String("method", env.Method),
+		slog.String("id", string(env.ID)),
+		slog.Bool("error", len(env.Error) > 0 && string(env.Error) != "null"),
+		slog.Int("bytes", len(data)),
+	}
+	if s.cfg.LogFramesVerbose {
+		attrs = append(attrs, slog.String("payload", string(data)))
+	}
+	s.logger.Info("bridge frame", attrs...)
+	s.metrics.recordFrameLogged()
+}
+
 func (s *session) handleMCMessage(ctx context.Context, data []byte) (bool, error) {
 	var frame map[string]json.RawMessage
 	if err := json.Unmarshal(data, &frame); err != nil {
-		s.logger.Warn("invalid minecraft payload", slog.Any("err", err))
+		s.metrics.recordInvalidPayload()
+		if ok, suppressed := s.invalidLog.allow(); ok {
+			s.logger.Warn("invalid minecraft payload", slog.Uint64("suppressed", suppressed), slog.Any("err", err))
+		}
 		return false, nil
 	}
 
@@ -429,7 +1321,7 @@ func (s *session) handleMCMessage(ctx context.Context, data []byte) (bool, error
 }
 
 func (s *session) sendDiscover(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.DiscoverTimeout)
 	defer cancel()
 
 	result, err := s.callMinecraft(ctx, "rpc.discover", json.RawMessage("[]"))
@@ -437,6 +1329,16 @@ func (s *session) sendDiscover(ctx context.Context) error {
 		return err
 	}
 
+	s.discoverMu.Lock()
+	defer s.discoverMu.Unlock()
+
+	sum := sha256.Sum256(result)
+	hash := hex.EncodeToString(sum[:])
+	if hash == s.schemaHash {
+		s.logger.Debug("rpc.discover schema unchanged; skipping send")
+		return nil
+	}
+
 	control := map[string]json.RawMessage{
 		"_control": json.RawMessage(`"discover"`),
 		"schema":   result,
@@ -446,14 +1348,18 @@ func (s *session) sendDiscover(ctx context.Context) error {
 		return err
 	}
 
-	return s.apiConn.Write(ctx, websocket.MessageText, payload)
+	if err := s.apiConn.Write(ctx, websocket.MessageText, payload); err != nil {
+		return err
+	}
+	s.schemaHash = hash
+	return nil
 }
 
 func (s *session) callMinecraft(ctx context.Context, method string, params json.RawMessage) (json.RawMessage, error) {
 	if params == nil {
 		params = json.RawMessage("[]")
 	}
-	id := "agent:" + uuid.NewString()
+	id := s.newID()
 	idRaw, err := json.Marshal(id)
 	if err != nil {
 		return nil, err
@@ -487,20 +1393,165 @@ func (s *session) callMinecraft(ctx context.Context, method string, params json.
 		if data == nil {
 			return nil, errors.New("minecraft call canceled")
 		}
-		var resp struct {
-			Result json.RawMessage `json:"result"`
-			Error  *struct {
-				Code    int    `json:"code"`
-				Message string `json:"message"`
-			} `json:"error"`
+		return parseMCResponse(method, data, s.cfg.MCStrictJSONRPC)
+	}
+}
+
+// parseMCResponse returns the result of a Minecraft response, or its error.
+// Some servers omit or vary the version on responses; only strict mode
+// treats that as a failure.
+func parseMCResponse(method string, data []byte, strict bool) (json.RawMessage, error) {
+	var resp struct {
+		JSONRPC *string         `json:"jsonrpc"`
+		Result  json.RawMessage `json:"result"`
+		Error   *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if strict && (resp.JSONRPC == nil || *resp.JSONRPC != "2.0") {
+		return nil, fmt.Errorf("%s response is not jsonrpc 2.0", method)
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+// logForwardQueueSize bounds records held while the API link is down or the
+// rate limit is exhausted; anything beyond it is counted and dropped.
+const logForwardQueueSize = 256
+
+type forwardedLog struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// logForwarder queues warning and error records for delivery to the API as
+// "log" control messages. It outlives sessions so records logged while
+// reconnecting are sent once the next bridge is up.
+type logForwarder struct {
+	queue     chan forwardedLog
+	perMinute int
+	dropped   atomic.Uint64
+}
+
+func newLogForwarder(perMinute int) *logForwarder {
+	return &logForwarder{queue: make(chan forwardedLog, logForwardQueueSize), perMinute: perMinute}
+}
+
+func (f *logForwarder) enqueue(entry forwardedLog) {
+	select {
+	case f.queue <- entry:
+	default:
+		f.dropped.Add(1)
+	}
+}
+
+// forwardingHandler tees records at or above min into a logForwarder.
+type forwardingHandler struct {
+	inner slog.Handler
+	min   slog.Level
+	fwd   *logForwarder
+	attrs []slog.Attr
+}
+
+func (h *forwardingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *forwardingHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if rec.Level >= h.min {
+		attrs := make(map[string]any, len(h.attrs)+rec.NumAttrs())
+		for _, attr := range h.attrs {
+			attrs[attr.Key] = logAttrValue(attr.Value)
+		}
+		rec.Attrs(func(attr slog.Attr) bool {
+			attrs[attr.Key] = logAttrValue(attr.Value)
+			return true
+		})
+		h.fwd.enqueue(forwardedLog{Time: rec.Time.UTC(), Level: rec.Level.String(), Message: rec.Message, Attrs: attrs})
+	}
+	return h.inner.Handle(ctx, rec)
+}
+
+func (h *forwardingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &forwardingHandler{inner: h.inner.WithAttrs(attrs), min: h.min, fwd: h.fwd, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+// WithGroup only namespaces the local output; forwarded attrs stay flat.
+func (h *forwardingHandler) WithGroup(name string) slog.Handler {
+	return &forwardingHandler{inner: h.inner.WithGroup(name), min: h.min, fwd: h.fwd, attrs: h.attrs}
+}
+
+func logAttrValue(v slog.Value) any {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindGroup:
+		group := make(map[string]any)
+		for _, attr := range v.Group() {
+			group[attr.Key] = logAttrValue(attr.Value)
 		}
-		if err := json.Unmarshal(data, &resp); err != nil {
-			return nil, err
+		return group
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
 		}
-		if resp.Error != nil {
-			return nil, errors.New(resp.Error.Message)
+	}
+	return v.Any()
+}
+
+func parseLogLevel(key, raw string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid %s %q; expected warn or error", key, raw)
+	}
+}
+
+// forwardLogs drains the forwarder onto the API link, sending at most
+// perMinute records per minute. The count of records dropped since the last
+// delivery rides along so gaps are visible on the API side. Failures are not
+// logged, since the log would only be forwarded again.
+func (s *session) forwardLogs(ctx context.Context) {
+	windowStart := time.Now()
+	sent := 0
+	for {
+		var entry forwardedLog
+		select {
+		case <-ctx.Done():
+			return
+		case entry = <-s.logs.queue:
 		}
-		return resp.Result, nil
+
+		if time.Since(windowStart) >= time.Minute {
+			windowStart = time.Now()
+			sent = 0
+		}
+		if s.logs.perMinute > 0 && sent >= s.logs.perMinute {
+			s.logs.dropped.Add(1)
+			continue
+		}
+
+		payload, err := json.Marshal(struct {
+			Control string `json:"_control"`
+			forwardedLog
+			Dropped uint64 `json:"dropped,omitempty"`
+		}{Control: "log", forwardedLog: entry, Dropped: s.logs.dropped.Swap(0)})
+		if err != nil {
+			continue
+		}
+		if err := s.apiConn.Write(ctx, websocket.MessageText, payload); err != nil {
+			return
+		}
+		sent++
 	}
 }
 
@@ -518,10 +1569,41 @@ type telemetry struct {
 	dialLatency         map[string]time.Duration
 	discoverSuccess     uint64
 	discoverFailures    uint64
+	discoverRPCErrors   uint64
 	apiToMCTotal        uint64
 	mcToAPITotal        uint64
+	framesLogged        uint64
+	policyViolations    uint64
+	policyOverrides     uint64
+	policyExpiries      uint64
+	invalidPayloads     uint64
 	stopCh              chan struct{}
 	doneCh              chan struct{}
+
+	// Push state, used once enablePush is called. pending holds samples
+	// not yet sent; ready is signalled when a batch is waiting.
+	batch       int
+	prev        map[string]uint64
+	pending     []telemetrySample
+	pushDropped uint64
+	ready       chan struct{}
+}
+
+const (
+	// maxTelemetryBatch keeps a batch well inside the API's frame limit
+	// even uncompressed.
+	maxTelemetryBatch = 20
+	// telemetryPendingMax bounds the samples held while the API link is
+	// down or does not accept telemetry; the oldest are dropped first.
+	telemetryPendingMax = 120
+)
+
+// telemetrySample is one snapshot interval's counter deltas as pushed to
+// the API. Counters that did not move are left out.
+type telemetrySample struct {
+	Time      time.Time         `json:"time"`
+	Counters  map[string]uint64 `json:"counters,omitempty"`
+	LastError string            `json:"last_error,omitempty"`
 }
 
 func newTelemetry(logger *slog.Logger, interval time.Duration) *telemetry {
@@ -590,8 +1672,14 @@ func (t *telemetry) snapshot() {
 		slog.Duration("last_session_duration", t.lastSessionDuration),
 		slog.Uint64("discover_success_total", t.discoverSuccess),
 		slog.Uint64("discover_failures_total", t.discoverFailures),
+		slog.Uint64("discover_rpc_errors_total", t.discoverRPCErrors),
 		slog.Uint64("messages_forwarded_api_to_mc", t.apiToMCTotal),
 		slog.Uint64("messages_forwarded_mc_to_api", t.mcToAPITotal),
+		slog.Uint64("frames_logged_total", t.framesLogged),
+		slog.Uint64("policy_violations_total", t.policyViolations),
+		slog.Uint64("policy_overrides_applied_total", t.policyOverrides),
+		slog.Uint64("policy_overrides_expired_total", t.policyExpiries),
+		slog.Uint64("invalid_mc_payloads_total", t.invalidPayloads),
 		slog.Any("dial_success_total", successCopy),
 		slog.Any("dial_failures_total", failureCopy),
 		slog.Any("dial_last_latency", latencyCopy),
@@ -600,6 +1688,187 @@ func (t *telemetry) snapshot() {
 		attrs = append(attrs, slog.String("last_error", t.lastError))
 	}
 	t.logger.Info("agent telemetry snapshot", attrs...)
+	if t.ready != nil {
+		t.queueSampleLocked(time.Now())
+	}
+}
+
+// enablePush starts keeping samples for forwardTelemetry, handed out in
+// batches of size. Call it before the first snapshot.
+func (t *telemetry) enablePush(size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.batch = max(size, 1)
+	t.prev = t.countersLocked()
+	t.ready = make(chan struct{}, 1)
+}
+
+func (t *telemetry) pushing() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ready != nil
+}
+
+// countersLocked flattens the counters into the names used in snapshots,
+// with per-target dial counts as e.g. "dial_success_total.api".
+func (t *telemetry) countersLocked() map[string]uint64 {
+	counters := map[string]uint64{
+		"sessions_total":                 t.sessions,
+		"session_failures_total":         t.failures,
+		"bridges_established_total":      t.bridges,
+		"discover_success_total":         t.discoverSuccess,
+		"discover_failures_total":        t.discoverFailures,
+		"discover_rpc_errors_total":      t.discoverRPCErrors,
+		"messages_forwarded_api_to_mc":   t.apiToMCTotal,
+		"messages_forwarded_mc_to_api":   t.mcToAPITotal,
+		"frames_logged_total":            t.framesLogged,
+		"policy_violations_total":        t.policyViolations,
+		"policy_overrides_applied_total": t.policyOverrides,
+		"policy_overrides_expired_total": t.policyExpiries,
+		"invalid_mc_payloads_total":      t.invalidPayloads,
+	}
+	for target, n := range t.dialSuccess {
+		counters["dial_success_total."+target] = n
+	}
+	for target, n := range t.dialFailures {
+		counters["dial_failures_total."+target] = n
+	}
+	return counters
+}
+
+// queueSampleLocked records the counter deltas since the previous sample
+// and signals forwardTelemetry once a full batch is waiting.
+func (t *telemetry) queueSampleLocked(now time.Time) {
+	current := t.countersLocked()
+	sample := telemetrySample{Time: now.UTC(), LastError: t.lastError}
+	for name, n := range current {
+		if delta := n - t.prev[name]; delta > 0 {
+			if sample.Counters == nil {
+				sample.Counters = make(map[string]uint64)
+			}
+			sample.Counters[name] = delta
+		}
+	}
+	t.prev = current
+
+	t.pending = append(t.pending, sample)
+	if over := len(t.pending) - telemetryPendingMax; over > 0 {
+		t.pending = append([]telemetrySample(nil), t.pending[over:]...)
+		t.pushDropped += uint64(over)
+	}
+	if len(t.pending) >= t.batch {
+		select {
+		case t.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// takeBatch removes up to one batch of samples, along with the count of
+// samples dropped since the last batch was taken.
+func (t *telemetry) takeBatch() ([]telemetrySample, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := min(len(t.pending), t.batch)
+	samples := append([]telemetrySample(nil), t.pending[:n]...)
+	t.pending = t.pending[n:]
+	dropped := t.pushDropped
+	t.pushDropped = 0
+	if len(t.pending) >= t.batch {
+		select {
+		case t.ready <- struct{}{}:
+		default:
+		}
+	}
+	return samples, dropped
+}
+
+// requeue puts back a batch that could not be sent, ahead of anything
+// queued since, so the next session delivers it first.
+func (t *telemetry) requeue(samples []telemetrySample, dropped uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(append([]telemetrySample(nil), samples...), t.pending...)
+	t.pushDropped += dropped
+	if over := len(t.pending) - telemetryPendingMax; over > 0 {
+		t.pending = t.pending[over:]
+		t.pushDropped += uint64(over)
+	}
+	if len(t.pending) >= t.batch {
+		select {
+		case t.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// telemetryFrame is a "telemetry" control message. Samples are sent as is,
+// or with Encoding "gzip" as the gzipped JSON array in Data.
+type telemetryFrame struct {
+	Control  string          `json:"_control"`
+	Encoding string          `json:"encoding,omitempty"`
+	Samples  json.RawMessage `json:"samples,omitempty"`
+	Data     []byte          `json:"data,omitempty"`
+	Dropped  uint64          `json:"dropped,omitempty"`
+}
+
+func encodeTelemetryBatch(samples []telemetrySample, dropped uint64, gzipped bool) ([]byte, error) {
+	raw, err := json.Marshal(samples)
+	if err != nil {
+		return nil, err
+	}
+	frame := telemetryFrame{Control: "telemetry", Dropped: dropped}
+	if !gzipped {
+		frame.Samples = raw
+		return json.Marshal(frame)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	frame.Encoding = "gzip"
+	frame.Data = buf.Bytes()
+	return json.Marshal(frame)
+}
+
+// forwardTelemetry sends each batch of samples to the API as it fills. A
+// batch that fails to send is kept for the next session.
+func (s *session) forwardTelemetry(ctx context.Context, gzipped bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.metrics.ready:
+		}
+		samples, dropped := s.metrics.takeBatch()
+		if len(samples) == 0 {
+			continue
+		}
+		payload, err := encodeTelemetryBatch(samples, dropped, gzipped)
+		if err != nil {
+			continue
+		}
+		if err := s.apiConn.Write(ctx, websocket.MessageText, payload); err != nil {
+			s.metrics.requeue(samples, dropped)
+			return
+		}
+	}
+}
+
+func (t *telemetry) setLogger(logger *slog.Logger) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.logger = logger.With(slog.String("component", "telemetry"))
+	t.mu.Unlock()
 }
 
 func (t *telemetry) recordSessionStart() {
@@ -665,6 +1934,10 @@ func (t *telemetry) recordDiscover(success bool, err error) {
 		t.discoverSuccess++
 	} else {
 		t.discoverFailures++
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			t.discoverRPCErrors++
+		}
 		if err != nil {
 			t.lastError = err.Error()
 		}
@@ -699,6 +1972,111 @@ func (t *telemetry) recordForwardMCToAPI() {
 	t.mu.Unlock()
 }
 
+func (t *telemetry) recordFrameLogged() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.framesLogged++
+	t.mu.Unlock()
+}
+
+func (t *telemetry) recordPolicyViolation() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.policyViolations++
+	t.mu.Unlock()
+}
+
+func (t *telemetry) recordPolicyOverride() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.policyOverrides++
+	t.mu.Unlock()
+}
+
+func (t *telemetry) recordPolicyOverrideExpiry(methods int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.policyExpiries += uint64(methods)
+	t.mu.Unlock()
+}
+
+func (t *telemetry) recordInvalidPayload() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.invalidPayloads++
+	t.mu.Unlock()
+}
+
+// invalidPayloadLogInterval is how often the invalid payload warning may
+// repeat within a session; occurrences in between are only counted.
+const invalidPayloadLogInterval = time.Minute
+
+// logThrottle lets the first event through and then at most one per
+// interval, reporting how many were suppressed since the last one.
+type logThrottle struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed uint64
+}
+
+func (t *logThrottle) allow() (bool, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if !t.last.IsZero() && now.Sub(t.last) < invalidPayloadLogInterval {
+		t.suppressed++
+		return false, 0
+	}
+	suppressed := t.suppressed
+	t.last = now
+	t.suppressed = 0
+	return true, suppressed
+}
+
+// secretFromEnv prefers the file named by key_FILE over the plain variable,
+// which suits Docker and Kubernetes secrets mounted as files.
+func secretFromEnv(key string) (string, error) {
+	if path := strings.TrimSpace(os.Getenv(key + "_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read %s_FILE: %w", key, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return os.Getenv(key), nil
+}
+
+// splitList parses a comma-separated variable, dropping empty entries.
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseFeatures reads a comma-separated feature header such as
+// X-Conduit-Hub-Features.
+func parseFeatures(raw string) map[string]bool {
+	features := make(map[string]bool)
+	for _, f := range splitList(strings.ToLower(raw)) {
+		features[f] = true
+	}
+	return features
+}
+
 func durationFromEnv(key string, def time.Duration) (time.Duration, error) {
 	raw := strings.TrimSpace(os.Getenv(key))
 	if raw == "" {
@@ -711,6 +2089,23 @@ func durationFromEnv(key string, def time.Duration) (time.Duration, error) {
 	return d, nil
 }
 
+func boolFromEnv(key string) bool {
+	raw := strings.TrimSpace(strings.ToLower(os.Getenv(key)))
+	return raw == "true" || raw == "1" || raw == "yes"
+}
+
+func intFromEnv(key string, def int) (int, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer for %s: %w", key, err)
+	}
+	return v, nil
+}
+
 func floatFromEnv(key string, def float64) (float64, error) {
 	raw := strings.TrimSpace(os.Getenv(key))
 	if raw == "" {
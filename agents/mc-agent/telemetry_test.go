@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestTelemetry(batch int) *telemetry {
+	t := &telemetry{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		dialSuccess:  make(map[string]uint64),
+		dialFailures: make(map[string]uint64),
+		dialLatency:  make(map[string]time.Duration),
+	}
+	t.enablePush(batch)
+	return t
+}
+
+func TestTelemetryDeltas(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(*telemetry)
+		want   map[string]uint64
+	}{
+		{"nothing moved", func(*telemetry) {}, nil},
+		{"forwarded messages", func(m *telemetry) {
+			m.recordForwardAPIToMC()
+			m.recordForwardAPIToMC()
+			m.recordForwardMCToAPI()
+		}, map[string]uint64{"messages_forwarded_api_to_mc": 2, "messages_forwarded_mc_to_api": 1}},
+		{"dial targets", func(m *telemetry) {
+			m.recordDialSuccess("api", time.Millisecond)
+			m.recordDialFailure("minecraft", nil)
+		}, map[string]uint64{"dial_success_total.api": 1, "dial_failures_total.minecraft": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestTelemetry(1)
+			// An earlier snapshot's counts must not be sent again.
+			m.recordSessionStart()
+			m.snapshot()
+			m.takeBatch()
+
+			tt.record(m)
+			m.snapshot()
+			samples, _ := m.takeBatch()
+			if len(samples) != 1 {
+				t.Fatalf("got %d samples, want 1", len(samples))
+			}
+			if !reflect.DeepEqual(samples[0].Counters, tt.want) {
+				t.Fatalf("counters = %v, want %v", samples[0].Counters, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelemetryBatching(t *testing.T) {
+	tests := []struct {
+		name        string
+		batch       int
+		snapshots   int
+		wantReady   bool
+		wantSizes   []int
+		wantDropped uint64
+	}{
+		{"below batch", 3, 2, false, []int{2}, 0},
+		{"one batch", 3, 3, true, []int{3}, 0},
+		{"backlog in batches", 3, 7, true, []int{3, 3, 1}, 0},
+		{"backlog over the cap", 20, telemetryPendingMax + 5, true, []int{20, 20, 20, 20, 20, 20}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestTelemetry(tt.batch)
+			for i := 0; i < tt.snapshots; i++ {
+				m.snapshot()
+			}
+			select {
+			case <-m.ready:
+				if !tt.wantReady {
+					t.Fatal("ready signalled before a full batch")
+				}
+			default:
+				if tt.wantReady {
+					t.Fatal("ready not signalled")
+				}
+			}
+			var sizes []int
+			var dropped uint64
+			for {
+				samples, d := m.takeBatch()
+				dropped += d
+				if len(samples) == 0 {
+					break
+				}
+				sizes = append(sizes, len(samples))
+			}
+			if !reflect.DeepEqual(sizes, tt.wantSizes) {
+				t.Fatalf("batch sizes = %v, want %v", sizes, tt.wantSizes)
+			}
+			if dropped != tt.wantDropped {
+				t.Fatalf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestTelemetryRequeue(t *testing.T) {
+	m := newTestTelemetry(2)
+	m.recordBridgeEstablished()
+	m.snapshot()
+	m.snapshot()
+	failed, _ := m.takeBatch()
+	m.snapshot()
+	m.requeue(failed, 3)
+
+	samples, dropped := m.takeBatch()
+	if !reflect.DeepEqual(samples, failed) {
+		t.Fatalf("first batch after requeue = %v, want the failed batch %v", samples, failed)
+	}
+	if dropped != 3 {
+		t.Fatalf("dropped = %d, want 3", dropped)
+	}
+}
+
+func TestEncodeTelemetryBatch(t *testing.T) {
+	samples := []telemetrySample{
+		{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Counters: map[string]uint64{"sessions_total": 1}},
+		{Time: time.Date(2026, 1, 2, 3, 5, 5, 0, time.UTC), LastError: "dial api: refused"},
+	}
+	tests := []struct {
+		name     string
+		gzipped  bool
+		encoding string
+	}{
+		{"plain", false, ""},
+		{"gzip", true, "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := encodeTelemetryBatch(samples, 2, tt.gzipped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var frame telemetryFrame
+			if err := json.Unmarshal(payload, &frame); err != nil {
+				t.Fatal(err)
+			}
+			if frame.Control != "telemetry" || frame.Encoding != tt.encoding || frame.Dropped != 2 {
+				t.Fatalf("frame = %+v", frame)
+			}
+			raw := []byte(frame.Samples)
+			if tt.gzipped {
+				if len(frame.Samples) != 0 {
+					t.Fatal("gzip frame also carries plain samples")
+				}
+				zr, err := gzip.NewReader(bytes.NewReader(frame.Data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if raw, err = io.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var got []telemetrySample
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, samples) {
+				t.Fatalf("samples = %+v, want %+v", got, samples)
+			}
+		})
+	}
+}
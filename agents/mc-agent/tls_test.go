@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCertPin dials a self-signed server that no configured root trusts, so
+// the handshake succeeds only through the pin.
+func TestCertPin(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	// Rejected handshakes are the point of the test; keep them out of the output.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	other := sha256.Sum256([]byte("some other certificate"))
+
+	tests := []struct {
+		name    string
+		pin     []byte
+		wantErr string
+	}{
+		{"matching pin", sum[:], ""},
+		{"mismatched pin", other[:], "does not match MC_TLS_PIN_SHA256"},
+		{"no pin", nil, "certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{MCURL: "wss://minecraft.invalid", MCTLSPinSHA256: tt.pin}
+			conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), cfg.buildMCTLSConfig())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("dial: %v", err)
+				}
+				conn.Close()
+				return
+			}
+			if err == nil {
+				conn.Close()
+				t.Fatal("dial succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %q does not mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCertPin(t *testing.T) {
+	sum := sha256.Sum256([]byte("cert"))
+	plain := hex.EncodeToString(sum[:])
+	var colons []string
+	for i := 0; i < len(plain); i += 2 {
+		colons = append(colons, strings.ToUpper(plain[i:i+2]))
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    []byte
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"hex", plain, sum[:], false},
+		{"openssl style", strings.Join(colons, ":"), sum[:], false},
+		{"not hex", "zz", nil, true},
+		{"too short", plain[:32], nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCertPin(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != string(tt.want) {
+				t.Fatalf("pin = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertPinExcludesInsecure(t *testing.T) {
+	sum := sha256.Sum256([]byte("cert"))
+	t.Setenv("CONDUIT_API_WS", "ws://api.invalid/agent/connect")
+	t.Setenv("CONDUIT_AGENT_TOKEN", "agent-token")
+	t.Setenv("MC_MGMT_WS", "wss://minecraft.invalid")
+	t.Setenv("MC_MGMT_TOKEN", "mc-token")
+	t.Setenv("MC_TLS_PIN_SHA256", hex.EncodeToString(sum[:]))
+
+	tests := []struct {
+		name    string
+		mode    string
+		wantErr bool
+	}{
+		{"strict", "strict", false},
+		{"skip", "skip", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MC_TLS_MODE", tt.mode)
+			_, err := loadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,43 +24,401 @@ import (
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-	pgDSN := os.Getenv("PG_DSN")
+	pgDSN, err := secretFromEnv("PG_DSN")
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
 	if pgDSN == "" {
 		logger.Error("PG_DSN is required")
 		os.Exit(1)
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
+	jwtSecret, err := secretFromEnv("JWT_SECRET")
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
 	if jwtSecret == "" {
 		logger.Error("JWT_SECRET is required")
 		os.Exit(1)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	listener, err := listenerFromEnv()
+	if err != nil {
+		logger.Error("failed to listen", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	tlsConfig, err := tlsConfigFromEnv()
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	maxClientsPerServer, err := intFromEnv("WS_MAX_CLIENTS_PER_SERVER", 100)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	maxClients, err := intFromEnv("WS_MAX_CLIENTS", 0)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	maxAgentsPerIP, err := intFromEnv("AGENT_MAX_CONNS_PER_IP", 100)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	maxServersPerOwner, err := intFromEnv("QUOTA_MAX_SERVERS_PER_OWNER", 0)
+	if err == nil && maxServersPerOwner < 0 {
+		err = errors.New("QUOTA_MAX_SERVERS_PER_OWNER must not be negative")
+	}
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	maxAgentsPerOwner, err := intFromEnv("QUOTA_MAX_AGENTS_PER_OWNER", 0)
+	if err == nil && maxAgentsPerOwner < 0 {
+		err = errors.New("QUOTA_MAX_AGENTS_PER_OWNER must not be negative")
+	}
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	queryTimeout, err := durationFromEnv("DB_QUERY_TIMEOUT", 5*time.Second)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	exportQueryTimeout, err := durationFromEnv("DB_EXPORT_TIMEOUT", 2*time.Minute)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	auditStoreParams, err := boolFromEnv("AUDIT_STORE_PARAMS", false)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	clientIdleTimeout, err := durationFromEnv("WS_CLIENT_IDLE_TIMEOUT", 0)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	cacheLastResponses, err := boolFromEnv("RPC_CACHE_LAST_RESPONSES", false)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	strictJSONRPC, err := boolFromEnv("RPC_STRICT_JSONRPC", false)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
 	}
 
+	hubRelay, err := boolFromEnv("HUB_RELAY", false)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	rpcTimeoutMax, err := durationFromEnv("RPC_TIMEOUT_MAX", 2*time.Minute)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	rpcReadRetries, err := intFromEnv("RPC_READ_RETRIES", 0)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	rpcSlowThreshold, err := durationFromEnv("RPC_SLOW_THRESHOLD", 0)
+	if err == nil && rpcSlowThreshold < 0 {
+		err = errors.New("RPC_SLOW_THRESHOLD must not be negative")
+	}
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	disableBootstrap, err := boolFromEnv("BOOTSTRAP_ENDPOINT_DISABLED", false)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	commandRole := app.RoleOwner
+	switch raw := os.Getenv("COMMAND_MIN_ROLE"); raw {
+	case "", string(app.RoleOwner):
+	case string(app.RoleModerator):
+		commandRole = app.RoleModerator
+	default:
+		logger.Error("invalid configuration", slog.Any("err", fmt.Errorf("COMMAND_MIN_ROLE must be moderator or owner, got %q", raw)))
+		os.Exit(1)
+	}
+
+	bootstrapEmail := os.Getenv("BOOTSTRAP_EMAIL")
+	bootstrapPassword, err := secretFromEnv("BOOTSTRAP_PASSWORD")
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	if (bootstrapEmail == "") != (bootstrapPassword == "") {
+		logger.Error("BOOTSTRAP_EMAIL and BOOTSTRAP_PASSWORD must be set together")
+		os.Exit(1)
+	}
+
+	alertDebounce, err := durationFromEnv("CONNECTIVITY_ALERT_DEBOUNCE", 30*time.Second)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	alertWebhook, err := secretFromEnv("CONNECTIVITY_ALERT_WEBHOOK_URL")
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	agentLogBuffer, err := intFromEnv("AGENT_LOG_BUFFER", 200)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	auditQueueSize, err := intFromEnv("AUDIT_QUEUE_SIZE", 1024)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	dataKeys, err := secretFromEnv("DATA_ENCRYPTION_KEY")
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	dataCipher, err := app.ParseDataKeys(dataKeys)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	auditRedaction := app.ParseRedactionRules(os.Getenv("AUDIT_REDACT_KEYS"), os.Getenv("AUDIT_REDACT_PATHS"))
+	schemaStrip := app.ParseRedactionRules(os.Getenv("SCHEMA_STRIP_KEYS"), os.Getenv("SCHEMA_STRIP_PATHS"))
+	auditPolicy, err := app.ParseAuditPolicy(os.Getenv("AUDIT_METHOD_POLICY"))
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	var allowedOrigins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+
+	trustedProxies, err := app.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	var sudoActions []string
+	for _, action := range strings.Split(os.Getenv("SUDO_ACTIONS"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			sudoActions = append(sudoActions, action)
+		}
+	}
+	sudoWindow, err := durationFromEnv("SUDO_WINDOW", 5*time.Minute)
+	if err == nil && sudoWindow <= 0 {
+		err = errors.New("SUDO_WINDOW must be positive")
+	}
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	sessionIdleTimeout, err := durationFromEnv("SESSION_IDLE_TIMEOUT", 0)
+	if err == nil && sessionIdleTimeout < 0 {
+		err = errors.New("SESSION_IDLE_TIMEOUT must not be negative")
+	}
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	var streamMethods []string
+	for _, prefix := range strings.Split(os.Getenv("RPC_STREAM_METHODS"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			streamMethods = append(streamMethods, prefix)
+		}
+	}
+
+	rpcDrain, err := durationFromEnv("RPC_DRAIN_TIMEOUT", 5*time.Second)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	agentWriteTimeout, err := durationFromEnv("AGENT_WRITE_TIMEOUT", 10*time.Second)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	agentReadIdle, err := durationFromEnv("AGENT_READ_IDLE_TIMEOUT", 0)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	agentReplaceGrace, err := durationFromEnv("AGENT_REPLACE_GRACE", 2*time.Second)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	// Agents split large responses into chunks that fit the default 32 KiB
+	// frame, so a lower agent cap would reject them.
+	agentMaxFrame, err := intFromEnv("HUB_AGENT_MAX_FRAME", 32<<10)
+	if err == nil && agentMaxFrame < 32<<10 {
+		err = fmt.Errorf("HUB_AGENT_MAX_FRAME must be at least %d", 32<<10)
+	}
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	clientMaxFrame, err := intFromEnv("HUB_CLIENT_MAX_FRAME", 32<<10)
+	if err == nil && clientMaxFrame <= 0 {
+		err = errors.New("HUB_CLIENT_MAX_FRAME must be positive")
+	}
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	poolCfg, err := poolConfigFromEnv(pgDSN)
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+	logger.Info("database pool configured",
+		slog.Int("max_conns", int(poolCfg.MaxConns)),
+		slog.Int("min_conns", int(poolCfg.MinConns)),
+		slog.Duration("max_conn_lifetime", poolCfg.MaxConnLifetime),
+		slog.Duration("health_check_period", poolCfg.HealthCheckPeriod),
+	)
+
 	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, pgDSN)
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
 		logger.Error("failed to connect to database", slog.Any("err", err))
 		os.Exit(1)
 	}
 	defer pool.Close()
 
-	application := app.NewApp(pool, app.Config{JWTSecret: jwtSecret}, logger)
+	replicaDSN, err := secretFromEnv("PG_DSN_REPLICA")
+	if err != nil {
+		logger.Error("invalid configuration", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	var replica *pgxpool.Pool
+	if replicaDSN != "" {
+		replicaCfg, err := poolConfigFromEnv(replicaDSN)
+		if err != nil {
+			logger.Error("invalid configuration", slog.Any("err", err))
+			os.Exit(1)
+		}
+		replica, err = pgxpool.NewWithConfig(ctx, replicaCfg)
+		if err != nil {
+			logger.Error("failed to connect to read replica", slog.Any("err", err))
+			os.Exit(1)
+		}
+		defer replica.Close()
+	}
+
+	application := app.NewApp(pool, app.Config{
+		JWTSecret:           jwtSecret,
+		ReadReplica:         replica,
+		MaxClientsPerServer: maxClientsPerServer,
+		MaxClients:          maxClients,
+		MaxAgentsPerIP:      maxAgentsPerIP,
+		TrustedProxies:      trustedProxies,
+		MaxServersPerOwner:  maxServersPerOwner,
+		MaxAgentsPerOwner:   maxAgentsPerOwner,
+		SchemaStrip:         schemaStrip,
+		QueryTimeout:        queryTimeout,
+		ExportQueryTimeout:  exportQueryTimeout,
+		AgentWriteTimeout:   agentWriteTimeout,
+		AgentReadIdle:       agentReadIdle,
+		AgentReplaceGrace:   agentReplaceGrace,
+		AuditStoreParams:    auditStoreParams,
+		AuditRedaction:      auditRedaction,
+		AuditPolicy:         auditPolicy,
+		AuditQueueSize:      auditQueueSize,
+		DataCipher:          dataCipher,
+		CacheLastResponses:  cacheLastResponses,
+		StrictJSONRPC:       strictJSONRPC,
+		HubRelay:            hubRelay,
+		RPCTimeoutMax:       rpcTimeoutMax,
+		RPCReadRetries:      rpcReadRetries,
+		RPCSlowThreshold:    rpcSlowThreshold,
+		DisableBootstrap:    disableBootstrap,
+		CommandRole:         commandRole,
+		ClientIdleTimeout:   clientIdleTimeout,
+		AgentConnectURL:     os.Getenv("AGENT_CONNECT_URL"),
+		AgentLogBuffer:      agentLogBuffer,
+		StreamMethods:       streamMethods,
+		AllowedOrigins:      allowedOrigins,
+		AlertDebounce:       alertDebounce,
+		AlertWebhook:        strings.TrimSpace(alertWebhook),
+		AgentMaxFrame:       int64(agentMaxFrame),
+		ClientMaxFrame:      int64(clientMaxFrame),
+		SudoActions:         sudoActions,
+		SudoWindow:          sudoWindow,
+		SessionIdleTimeout:  sessionIdleTimeout,
+	}, logger)
+
+	// Agents reconnect to this process from scratch, so connected_at values
+	// left by the previous one are stale whether or not it shut down cleanly.
+	if cleared, err := application.ResetConnections(ctx); err != nil {
+		logger.Error("failed to reset connection state", slog.Any("err", err))
+		os.Exit(1)
+	} else if cleared > 0 {
+		logger.Info("cleared stale connection state", slog.Int64("servers", cleared))
+	}
+
+	if bootstrapEmail != "" {
+		err := application.BootstrapOwner(ctx, bootstrapEmail, bootstrapPassword)
+		switch {
+		case err == nil:
+			logger.Info("bootstrapped owner from environment", slog.String("email", bootstrapEmail))
+		case app.IsBootstrapCompleted(err):
+			logger.Info("skipping environment bootstrap; users already exist")
+		default:
+			logger.Error("environment bootstrap failed", slog.Any("err", err))
+			os.Exit(1)
+		}
+	}
 
 	srv := &http.Server{
-		Addr:              ":" + port,
 		Handler:           application.Router,
+		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: 15 * time.Second,
 		IdleTimeout:       60 * time.Second,
 	}
 
 	go func() {
-		logger.Info("api listening", slog.String("addr", srv.Addr))
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("api listening", slog.String("addr", listener.Addr().String()), slog.String("network", listener.Addr().Network()), slog.Bool("tls", tlsConfig != nil))
+		var err error
+		if tlsConfig != nil {
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("server error", slog.Any("err", err))
 			os.Exit(1)
 		}
@@ -67,7 +432,194 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
+	drained := make(chan struct{})
+	go func() {
+		application.DrainRPC(rpcDrain)
+		close(drained)
+	}()
+
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("graceful shutdown failed", slog.Any("err", err))
 	}
+	<-drained
+	// Shutdown closes the listener, which unlinks a Unix socket; this only
+	// catches the case where it did not.
+	if addr, ok := listener.Addr().(*net.UnixAddr); ok {
+		if err := os.Remove(addr.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error("failed to remove unix socket", slog.String("path", addr.Name), slog.Any("err", err))
+		}
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFlush()
+	if err := application.FlushAudit(flushCtx); err != nil {
+		logger.Error("audit flush incomplete", slog.Any("err", err))
+	}
+}
+
+// listenerFromEnv binds BIND_ADDR and PORT over TCP, or a Unix domain socket
+// when BIND_ADDR is unix:///path or an absolute path. A stale socket file is
+// replaced and the new one is chmodded to BIND_SOCKET_MODE (default 0660).
+func listenerFromEnv() (net.Listener, error) {
+	bind := os.Getenv("BIND_ADDR")
+	path, isUnix := strings.CutPrefix(bind, "unix://")
+	if !isUnix && strings.HasPrefix(bind, "/") {
+		path, isUnix = bind, true
+	}
+	if !isUnix {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		return net.Listen("tcp", net.JoinHostPort(bind, port))
+	}
+
+	if path == "" {
+		return nil, errors.New("BIND_ADDR unix socket path is empty")
+	}
+	mode := os.FileMode(0o660)
+	if raw := os.Getenv("BIND_SOCKET_MODE"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 8, 32)
+		if err != nil || parsed > 0o777 {
+			return nil, fmt.Errorf("invalid BIND_SOCKET_MODE %q: expected octal permissions such as 0660", raw)
+		}
+		mode = os.FileMode(parsed)
+	}
+
+	// Only remove what a previous run left behind, never a regular file.
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("BIND_ADDR %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return listener, nil
+}
+
+// poolConfigFromEnv parses dsn and applies the PG_* pool overrides. Unset
+// variables keep pgxpool's defaults (or whatever the DSN's pool_* parameters
+// set).
+func poolConfigFromEnv(dsn string) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		// The DSN holds the password, so keep it out of the message.
+		return nil, errors.New("invalid database DSN")
+	}
+
+	maxConns, err := intFromEnv("PG_MAX_CONNS", int(cfg.MaxConns))
+	if err != nil {
+		return nil, err
+	}
+	minConns, err := intFromEnv("PG_MIN_CONNS", int(cfg.MinConns))
+	if err != nil {
+		return nil, err
+	}
+	if maxConns < 1 || maxConns > math.MaxInt32 {
+		return nil, fmt.Errorf("PG_MAX_CONNS must be between 1 and %d", math.MaxInt32)
+	}
+	if minConns < 0 || minConns > maxConns {
+		return nil, errors.New("PG_MIN_CONNS must be between 0 and PG_MAX_CONNS")
+	}
+	lifetime, err := durationFromEnv("PG_MAX_CONN_LIFETIME", cfg.MaxConnLifetime)
+	if err != nil {
+		return nil, err
+	}
+	if lifetime <= 0 {
+		return nil, errors.New("PG_MAX_CONN_LIFETIME must be positive")
+	}
+	healthCheck, err := durationFromEnv("PG_HEALTH_CHECK_PERIOD", cfg.HealthCheckPeriod)
+	if err != nil {
+		return nil, err
+	}
+	if healthCheck <= 0 {
+		return nil, errors.New("PG_HEALTH_CHECK_PERIOD must be positive")
+	}
+
+	cfg.MaxConns = int32(maxConns)
+	cfg.MinConns = int32(minConns)
+	cfg.MaxConnLifetime = lifetime
+	cfg.HealthCheckPeriod = healthCheck
+	return cfg, nil
+}
+
+// tlsConfigFromEnv loads TLS_CERT_FILE and TLS_KEY_FILE when both are set.
+// A nil config means the server keeps serving plain HTTP.
+func tlsConfigFromEnv() (*tls.Config, error) {
+	certFile := os.Getenv("TLS_CERT_FILE")
+	keyFile := os.Getenv("TLS_KEY_FILE")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS key pair: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// secretFromEnv returns the contents of the file named by key_FILE when set,
+// falling back to the plain key, so secrets can be mounted rather than
+// exported into the process environment.
+func secretFromEnv(key string) (string, error) {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read %s_FILE: %w", key, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return os.Getenv(key), nil
+}
+
+func intFromEnv(key string, def int) (int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer for %s: %w", key, err)
+	}
+	return v, nil
+}
+
+func durationFromEnv(key string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration for %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func boolFromEnv(key string, def bool) (bool, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean for %s: %w", key, err)
+	}
+	return v, nil
 }
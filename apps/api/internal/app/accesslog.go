@@ -0,0 +1,63 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// accessLogUser is filled in by authMiddleware so the access log, which runs
+// outside it, can report the authenticated user.
+type accessLogUser struct {
+	id string
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// accessLogMiddleware replaces chi's text logger with a structured slog entry
+// per request so access logs share the process's JSON format.
+func (a *App) accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		holder := &accessLogUser{}
+		ctx := contextWithAccessLogUser(r.Context(), holder)
+		// ContentLength is -1 for chunked bodies, so count what the handler
+		// actually reads.
+		body := &countingBody{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+
+		defer func() {
+			attrs := []any{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", ww.Status()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.Int64("bytes_in", body.n),
+				slog.Int("bytes_out", ww.BytesWritten()),
+			}
+			if holder.id != "" {
+				attrs = append(attrs, slog.String("user_id", holder.id))
+			}
+			a.Logger.Info("http request", attrs...)
+		}()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogBytesIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    io.Reader
+		length  int64
+		read    bool
+		wantIn  int64
+		wantOut int64
+	}{
+		{"sized body", strings.NewReader("hello"), 5, true, 5, 2},
+		{"chunked body", strings.NewReader("chunked body"), -1, true, 12, 2},
+		{"unread body", strings.NewReader("ignored"), 7, false, 0, 2},
+		{"no body", nil, 0, true, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			a := &App{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+			handler := a.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.read {
+					io.Copy(io.Discard, r.Body)
+				}
+				w.Write([]byte("ok"))
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/servers", tt.body)
+			req.ContentLength = tt.length
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry struct {
+				BytesIn  int64 `json:"bytes_in"`
+				BytesOut int64 `json:"bytes_out"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log entry %q: %v", logs.String(), err)
+			}
+			if entry.BytesIn != tt.wantIn || entry.BytesOut != tt.wantOut {
+				t.Fatalf("bytes_in=%d bytes_out=%d, want %d and %d", entry.BytesIn, entry.BytesOut, tt.wantIn, tt.wantOut)
+			}
+		})
+	}
+}
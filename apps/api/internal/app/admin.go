@@ -0,0 +1,24 @@
+package app
+
+import "net/http"
+
+type adminConnectionsResponse struct {
+	Servers []hubConnectionSummary `json:"servers"`
+	Agents  hubAgentStats          `json:"agents"`
+	Clients hubClientStats         `json:"clients"`
+	Audit   auditWriterStats       `json:"audit"`
+	RPC     rpcStats               `json:"rpc"`
+	// Relay is null unless HUB_RELAY is on.
+	Relay *relayStats `json:"relay"`
+}
+
+func (a *App) handleAdminConnections(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, adminConnectionsResponse{
+		Servers: a.Hub.Snapshot(),
+		Agents:  a.Hub.AgentStats(),
+		Clients: a.Hub.ClientStats(),
+		Audit:   a.audit.stats(),
+		RPC:     rpcStats{Retries: a.rpcRetries.Load(), SlowCalls: a.rpcSlowCalls.Load()},
+		Relay:   a.Hub.RelayStats(),
+	})
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"nhooyr.io/websocket"
+)
+
+const agentTokenPlaceholder = "replace-with-token"
+
+// rotateAgentToken issues a new agent token for serverID and disconnects the
+// agent holding the old one. It returns pgx.ErrNoRows for unknown servers.
+func (a *App) rotateAgentToken(ctx context.Context, serverID string) (string, error) {
+	agentToken, err := generateAgentToken()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+	tag, err := a.DB.Exec(ctx, `UPDATE servers SET agent_token_hash = $1 WHERE id = $2`, hashToken(agentToken), serverID)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", pgx.ErrNoRows
+	}
+
+	// The connected agent authenticated with the old token; force it to reconnect.
+	if agent := a.Hub.AgentFor(serverID); agent != nil {
+		agent.Close(websocket.StatusPolicyViolation, "agent token rotated")
+	}
+	return agentToken, nil
+}
+
+// agentConnectURL returns the WebSocket URL agents should dial, preferring
+// the configured AGENT_CONNECT_URL over one derived from the request.
+func (a *App) agentConnectURL(r *http.Request) string {
+	if a.agentURL != "" {
+		return a.agentURL
+	}
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	return scheme + "://" + r.Host + "/agent/connect"
+}
+
+// envValue keeps a single env file line intact whatever the server name holds.
+func envValue(v string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(v)
+}
+
+// handleAgentConfig renders an agent env file for the server. The agent
+// token is only stored hashed, so including it means rotating it; without
+// include_token=true a placeholder is written instead.
+func (a *App) handleAgentConfig(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+
+	includeToken := false
+	if raw := r.URL.Query().Get("include_token"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "invalid include_token", http.StatusBadRequest)
+			return
+		}
+		includeToken = v
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	var name string
+	err := a.DB.QueryRow(ctx, `SELECT name FROM servers WHERE id = $1`, serverID).Scan(&name)
+	cancel()
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	agentToken := agentTokenPlaceholder
+	if includeToken {
+		agentToken, err = a.rotateAgentToken(r.Context(), serverID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.NotFound(w, r)
+				return
+			}
+			a.internalError(w, err)
+			return
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conduit agent configuration for %s (%s)\n", envValue(name), serverID)
+	if includeToken {
+		b.WriteString("# The agent token was rotated when this file was generated; agents using the old token were disconnected.\n")
+	}
+	fmt.Fprintf(&b, "CONDUIT_API_WS=%s\n", a.agentConnectURL(r))
+	fmt.Fprintf(&b, "CONDUIT_AGENT_TOKEN=%s\n", agentToken)
+	fmt.Fprintf(&b, "AGENT_NAME=%s\n", envValue(name))
+	b.WriteString("MC_MGMT_WS=wss://localhost:24464\n")
+	b.WriteString("MC_MGMT_TOKEN=replace-with-management-token\n")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "conduit-agent-"+serverID+".env"))
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxAgentLogMessage = 2048
+	maxAgentLogAttrs   = 4096
+)
+
+type agentLogEntry struct {
+	Time       time.Time       `json:"time"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Level      string          `json:"level"`
+	Message    string          `json:"message"`
+	Attrs      json.RawMessage `json:"attrs,omitempty"`
+	Dropped    uint64          `json:"dropped,omitempty"`
+}
+
+// agentLogStore keeps the most recent forwarded agent log records per server
+// in a fixed-size ring, so a chatty agent cannot grow API memory.
+type agentLogStore struct {
+	mu       sync.RWMutex
+	capacity int
+	rings    map[string]*agentLogRing
+}
+
+type agentLogRing struct {
+	entries []agentLogEntry
+	next    int
+	full    bool
+}
+
+func newAgentLogStore(capacity int) *agentLogStore {
+	return &agentLogStore{capacity: capacity, rings: make(map[string]*agentLogRing)}
+}
+
+// parseAgentLog turns a "log" control message into a bounded entry.
+func parseAgentLog(env map[string]json.RawMessage) (agentLogEntry, bool) {
+	var entry agentLogEntry
+	if err := json.Unmarshal(env["message"], &entry.Message); err != nil {
+		return entry, false
+	}
+	_ = json.Unmarshal(env["level"], &entry.Level)
+	_ = json.Unmarshal(env["time"], &entry.Time)
+	_ = json.Unmarshal(env["dropped"], &entry.Dropped)
+	entry.Level = strings.ToUpper(strings.TrimSpace(entry.Level))
+	if len(entry.Message) > maxAgentLogMessage {
+		entry.Message = entry.Message[:maxAgentLogMessage]
+	}
+	if attrs := env["attrs"]; len(attrs) > 0 && len(attrs) <= maxAgentLogAttrs {
+		entry.Attrs = append(json.RawMessage(nil), attrs...)
+	}
+	entry.ReceivedAt = time.Now().UTC()
+	return entry, true
+}
+
+func (s *agentLogStore) add(serverID string, entry agentLogEntry) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring, ok := s.rings[serverID]
+	if !ok {
+		ring = &agentLogRing{entries: make([]agentLogEntry, s.capacity)}
+		s.rings[serverID] = ring
+	}
+	ring.entries[ring.next] = entry
+	ring.next = (ring.next + 1) % s.capacity
+	if ring.next == 0 {
+		ring.full = true
+	}
+}
+
+// list returns up to limit entries, newest first, optionally restricted to
+// one level.
+func (s *agentLogStore) list(serverID, level string, limit int) []agentLogEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []agentLogEntry{}
+	ring, ok := s.rings[serverID]
+	if !ok {
+		return out
+	}
+	count := ring.next
+	if ring.full {
+		count = s.capacity
+	}
+	for i := 1; i <= count && len(out) < limit; i++ {
+		entry := ring.entries[(ring.next-i+s.capacity)%s.capacity]
+		if level != "" && entry.Level != level {
+			continue
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func (a *App) handleAgentLogs(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	if a.Hub.agentLogs == nil {
+		http.Error(w, "agent log storage disabled; set AGENT_LOG_BUFFER above 0", http.StatusNotFound)
+		return
+	}
+
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			if parsed < 1 {
+				parsed = 1
+			}
+			if parsed > a.Hub.agentLogs.capacity {
+				parsed = a.Hub.agentLogs.capacity
+			}
+			limit = parsed
+		}
+	}
+	level := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("level")))
+
+	a.writeJSON(w, a.Hub.agentLogs.list(serverID, level, limit))
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// agentRetryCap is the suggested Retry-After for an agent that has been
+// gone a while or never connected, matching the agent's default
+// AGENT_BACKOFF_MAX.
+const agentRetryCap = 30 * time.Second
+
+type agentOfflineResponse struct {
+	Error    string `json:"error"`
+	ServerID string `json:"server_id"`
+	// EverConnected is false for a server whose agent has not connected
+	// since it was created, which usually means a missing or wrong token.
+	EverConnected bool       `json:"ever_connected"`
+	LastSeenAt    *time.Time `json:"last_seen_at"`
+	LastSeenAgoMs *int64     `json:"last_seen_ago_ms"`
+	RetryAfterSec int        `json:"retry_after_seconds"`
+}
+
+// agentRetryAfter suggests when to retry a call to an agent last seen at
+// lastSeen. Agents back off exponentially after a disconnect, so their
+// next attempt is roughly as far away as the outage is long, up to the
+// backoff cap.
+func agentRetryAfter(lastSeen *time.Time, now time.Time) time.Duration {
+	if lastSeen == nil {
+		return agentRetryCap
+	}
+	return min(max(now.Sub(*lastSeen), time.Second), agentRetryCap)
+}
+
+// writeAgentOffline answers a call for a server without a live agent: 404
+// when the server does not exist, otherwise 503 with its connection history
+// and a Retry-After hint. It returns false for unknown servers so callers
+// can skip auditing them.
+func (a *App) writeAgentOffline(w http.ResponseWriter, r *http.Request, serverID string) bool {
+	if _, err := uuid.Parse(serverID); err != nil {
+		http.NotFound(w, r)
+		return false
+	}
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	var lastSeen *time.Time
+	if err := a.DB.QueryRow(ctx, `SELECT agent_last_seen_at FROM servers WHERE id = $1`, serverID).Scan(&lastSeen); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return false
+		}
+		a.internalError(w, err)
+		return true
+	}
+
+	resp := newAgentOfflineResponse(serverID, lastSeen, time.Now())
+	w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfterSec))
+	a.writeJSONStatus(w, http.StatusServiceUnavailable, resp)
+	return true
+}
+
+// newAgentOfflineResponse describes a known server whose agent, last seen
+// at lastSeen, is not connected.
+func newAgentOfflineResponse(serverID string, lastSeen *time.Time, now time.Time) agentOfflineResponse {
+	resp := agentOfflineResponse{
+		Error:         "agent_not_connected",
+		ServerID:      serverID,
+		EverConnected: lastSeen != nil,
+		LastSeenAt:    lastSeen,
+		RetryAfterSec: int(agentRetryAfter(lastSeen, now) / time.Second),
+	}
+	if lastSeen != nil {
+		ago := now.Sub(*lastSeen).Milliseconds()
+		resp.LastSeenAgoMs = &ago
+	}
+	return resp
+}
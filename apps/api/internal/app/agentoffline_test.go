@@ -0,0 +1,122 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestAgentOfflineHandlers runs the RPC and preset handlers for servers
+// without a live agent. Unknown ids, malformed or not, get 404 before the
+// agent is looked up: an agent is registered under each id with no
+// connection behind it, so a handler that reached it would fail rather than
+// answer. Known servers get 503 with a Retry-After hint.
+func TestAgentOfflineHandlers(t *testing.T) {
+	const known = "7d3c3a52-52b4-4a7e-9a55-1d6a8f1e0c11"
+	const unknown = "0b9f4a3e-2c1d-4e8f-9a7b-6c5d4e3f2a1b"
+	missing := map[string][][]any{"SELECT EXISTS": {{false}}}
+	offline := func(lastSeen *time.Time) map[string][][]any {
+		return map[string][][]any{
+			"SELECT EXISTS":        {{true}},
+			"rpc_method_allowlist": nil,
+			"SELECT suspended":     {{false}},
+			"agent_last_seen_at":   {{lastSeen}},
+		}
+	}
+	seen := time.Now().Add(-12 * time.Second)
+	handlers := []struct {
+		name    string
+		body    string
+		handler func(*App) http.HandlerFunc
+	}{
+		{"rpc", `{"method":"minecraft:players"}`, func(a *App) http.HandlerFunc { return a.handleServerRPC }},
+		{"preset", `{"preset":"builder-friendly"}`, func(a *App) http.HandlerFunc { return a.handleApplyGameRulePreset }},
+	}
+	tests := []struct {
+		name      string
+		id        string
+		results   map[string][][]any
+		wantCode  int
+		wantRetry string
+		wantEver  bool
+	}{
+		{"malformed id", "not-a-uuid", missing, http.StatusNotFound, "", false},
+		{"short id", "42", missing, http.StatusNotFound, "", false},
+		{"unknown server", unknown, missing, http.StatusNotFound, "", false},
+		{"agent offline", known, offline(&seen), http.StatusServiceUnavailable, "12", true},
+		{"agent never connected", known, offline(nil), http.StatusServiceUnavailable, "30", false},
+	}
+	for _, h := range handlers {
+		for _, tt := range tests {
+			t.Run(h.name+"/"+tt.name, func(t *testing.T) {
+				a := testApp(t, tt.results)
+				if tt.wantCode == http.StatusNotFound {
+					a.Hub.agents[tt.id] = &AgentConn{hub: a.Hub, serverID: tt.id}
+				}
+				rec := httptest.NewRecorder()
+				h.handler(a)(rec, serverRequest(t, http.MethodPost, tt.id, h.body, &AuthUser{ID: "u1", Role: RoleOwner}))
+				if rec.Code != tt.wantCode {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+				}
+				if tt.wantCode != http.StatusServiceUnavailable {
+					return
+				}
+				if got := rec.Header().Get("Retry-After"); got != tt.wantRetry {
+					t.Fatalf("Retry-After = %q, want %q", got, tt.wantRetry)
+				}
+				var body agentOfflineResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error != "agent_not_connected" || body.ServerID != tt.id || body.EverConnected != tt.wantEver {
+					t.Fatalf("body = %+v", body)
+				}
+			})
+		}
+	}
+}
+
+func TestNewAgentOfflineResponse(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ago time.Duration) *time.Time {
+		t := now.Add(-ago)
+		return &t
+	}
+	tests := []struct {
+		name      string
+		lastSeen  *time.Time
+		wantEver  bool
+		wantRetry int
+		wantAgoMs int64
+	}{
+		{"never connected", nil, false, 30, 0},
+		{"just dropped", at(200 * time.Millisecond), true, 1, 200},
+		{"short outage", at(12 * time.Second), true, 12, 12000},
+		{"long outage", at(time.Hour), true, 30, 3600000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := newAgentOfflineResponse("srv", tt.lastSeen, now)
+			if resp.Error != "agent_not_connected" || resp.ServerID != "srv" {
+				t.Fatalf("response = %+v", resp)
+			}
+			if resp.EverConnected != tt.wantEver {
+				t.Fatalf("ever_connected = %v, want %v", resp.EverConnected, tt.wantEver)
+			}
+			if resp.RetryAfterSec != tt.wantRetry {
+				t.Fatalf("retry_after_seconds = %d, want %d", resp.RetryAfterSec, tt.wantRetry)
+			}
+			if tt.lastSeen == nil {
+				if resp.LastSeenAt != nil || resp.LastSeenAgoMs != nil {
+					t.Fatalf("last seen reported for a server never connected: %+v", resp)
+				}
+				return
+			}
+			if resp.LastSeenAgoMs == nil || *resp.LastSeenAgoMs != tt.wantAgoMs {
+				t.Fatalf("last_seen_ago_ms = %v, want %d", resp.LastSeenAgoMs, tt.wantAgoMs)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	actionAgentPolicyOverride = "conduit:agent-policy/override"
+	// agentFeaturePolicyOverride is advertised by agents that run a method
+	// policy and accept temporary overrides of it.
+	agentFeaturePolicyOverride = "policy_override"
+	maxPolicyOverride          = time.Hour
+)
+
+type policyOverrideRequest struct {
+	Methods    []string `json:"methods"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+type policyOverrideControl struct {
+	Control    string   `json:"_control"`
+	Methods    []string `json:"methods"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+type policyOverrideResponse struct {
+	ServerID string   `json:"server_id"`
+	Methods  []string `json:"methods"`
+	// ExpiresAt is when the override ends if the agent accepts the full
+	// duration; it caps overrides at its own AGENT_POLICY_OVERRIDE_MAX.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleAgentPolicyOverride asks a server's agent to allow methods its
+// AGENT_METHOD_POLICY_MAX_ROLE blocks for a limited time, as a maintenance
+// escape hatch. The agent applies and expires the override itself.
+func (a *App) handleAgentPolicyOverride(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+
+	var req policyOverrideRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	methods, err := normalizeAllowlist(req.Methods)
+	if err == nil && len(methods) == 0 {
+		err = errors.New("methods required")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	duration := time.Duration(req.DurationMS) * time.Millisecond
+	if duration <= 0 || duration > maxPolicyOverride {
+		http.Error(w, fmt.Sprintf("duration_ms must be between 1 and %d", maxPolicyOverride.Milliseconds()), http.StatusBadRequest)
+		return
+	}
+
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		return
+	}
+	if !agent.features[agentFeaturePolicyOverride] {
+		http.Error(w, "agent does not accept policy overrides; it needs a method policy and AGENT_POLICY_OVERRIDE_MAX", http.StatusConflict)
+		return
+	}
+
+	params, _ := json.Marshal(policyOverrideRequest{Methods: methods, DurationMS: req.DurationMS})
+	payload, err := json.Marshal(policyOverrideControl{Control: "policy_override", Methods: methods, DurationMS: req.DurationMS})
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if err := agent.write(r.Context(), payload); err != nil {
+		a.recordAudit(r.Context(), user.ID, serverID, actionAgentPolicyOverride, params, "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	a.recordAudit(r.Context(), user.ID, serverID, actionAgentPolicyOverride, params, "ok", nil)
+	a.writeJSONStatus(w, http.StatusAccepted, policyOverrideResponse{
+		ServerID:  serverID,
+		Methods:   methods,
+		ExpiresAt: time.Now().Add(duration).UTC(),
+	})
+}
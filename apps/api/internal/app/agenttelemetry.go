@@ -0,0 +1,158 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// hubFeatures is sent to agents as X-Conduit-Hub-Features. Agents only
+	// push telemetry, and only gzip it, when the API lists support.
+	hubFeatures = "telemetry,telemetry_gzip"
+
+	maxTelemetrySamples  = 100
+	maxTelemetryDecoded  = 256 << 10
+	maxTelemetryCounters = 64
+	maxTelemetryName     = 64
+)
+
+type agentTelemetrySample struct {
+	Time      time.Time         `json:"time"`
+	Counters  map[string]uint64 `json:"counters"`
+	LastError string            `json:"last_error"`
+}
+
+// agentTelemetry sums the counter deltas an agent has pushed to this API
+// instance.
+type agentTelemetry struct {
+	Totals       map[string]uint64 `json:"totals"`
+	LastSampleAt time.Time         `json:"last_sample_at"`
+	LastError    string            `json:"last_error,omitempty"`
+	Samples      uint64            `json:"samples_total"`
+	Batches      uint64            `json:"batches_total"`
+	GzipBatches  uint64            `json:"gzip_batches_total"`
+	// Dropped counts samples the agent discarded before sending them.
+	Dropped uint64 `json:"dropped_total"`
+}
+
+type agentTelemetryStore struct {
+	mu      sync.RWMutex
+	servers map[string]*agentTelemetry
+}
+
+func newAgentTelemetryStore() *agentTelemetryStore {
+	return &agentTelemetryStore{servers: make(map[string]*agentTelemetry)}
+}
+
+// parseAgentTelemetry decodes a "telemetry" control message. Samples come
+// inline, or with encoding "gzip" as a gzipped JSON array in data, which is
+// inflated up to maxTelemetryDecoded bytes.
+func parseAgentTelemetry(env map[string]json.RawMessage) (samples []agentTelemetrySample, dropped uint64, gzipped bool, err error) {
+	var encoding string
+	if raw, ok := env["encoding"]; ok {
+		if err := json.Unmarshal(raw, &encoding); err != nil {
+			return nil, 0, false, errors.New("invalid encoding")
+		}
+	}
+	_ = json.Unmarshal(env["dropped"], &dropped)
+
+	raw := []byte(env["samples"])
+	switch encoding {
+	case "":
+	case "gzip":
+		var data []byte
+		if err := json.Unmarshal(env["data"], &data); err != nil {
+			return nil, 0, false, errors.New("invalid gzip data")
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		raw, err = io.ReadAll(io.LimitReader(zr, maxTelemetryDecoded+1))
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		if len(raw) > maxTelemetryDecoded {
+			return nil, 0, false, fmt.Errorf("telemetry exceeds %d bytes once decompressed", maxTelemetryDecoded)
+		}
+		gzipped = true
+	default:
+		return nil, 0, false, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	if err := json.Unmarshal(raw, &samples); err != nil {
+		return nil, 0, false, errors.New("invalid samples")
+	}
+	if len(samples) > maxTelemetrySamples {
+		return nil, 0, false, fmt.Errorf("more than %d samples in one message", maxTelemetrySamples)
+	}
+	return samples, dropped, gzipped, nil
+}
+
+// add folds a batch into the server's totals. Counter names past
+// maxTelemetryCounters, or longer than maxTelemetryName, are ignored so an
+// agent cannot grow API memory without bound.
+func (s *agentTelemetryStore) add(serverID string, samples []agentTelemetrySample, dropped uint64, gzipped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.servers[serverID]
+	if !ok {
+		t = &agentTelemetry{Totals: make(map[string]uint64)}
+		s.servers[serverID] = t
+	}
+	t.Batches++
+	if gzipped {
+		t.GzipBatches++
+	}
+	t.Dropped += dropped
+	for _, sample := range samples {
+		t.Samples++
+		for name, delta := range sample.Counters {
+			if _, known := t.Totals[name]; !known && (len(t.Totals) >= maxTelemetryCounters || len(name) > maxTelemetryName) {
+				continue
+			}
+			t.Totals[name] += delta
+		}
+		if sample.Time.After(t.LastSampleAt) {
+			t.LastSampleAt = sample.Time
+			t.LastError = sample.LastError
+			if len(t.LastError) > maxAgentLogMessage {
+				t.LastError = t.LastError[:maxAgentLogMessage]
+			}
+		}
+	}
+}
+
+func (s *agentTelemetryStore) get(serverID string) agentTelemetry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.servers[serverID]
+	if !ok {
+		return agentTelemetry{Totals: map[string]uint64{}}
+	}
+	out := *t
+	out.Totals = make(map[string]uint64, len(t.Totals))
+	for name, n := range t.Totals {
+		out.Totals[name] = n
+	}
+	return out
+}
+
+// handleAgentTelemetry reports the telemetry the server's agent has pushed
+// to this instance. Totals start from zero when the API restarts.
+func (a *App) handleAgentTelemetry(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+	a.writeJSON(w, a.Hub.agentTelemetry.get(serverID))
+}
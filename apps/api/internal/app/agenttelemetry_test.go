@@ -0,0 +1,113 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gzipTelemetry(t *testing.T, raw string) json.RawMessage {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseAgentTelemetry(t *testing.T) {
+	samples := `[{"time":"2026-01-02T03:04:05Z","counters":{"sessions_total":2}}]`
+	tooMany := "[" + strings.TrimSuffix(strings.Repeat(`{"time":"2026-01-02T03:04:05Z"},`, maxTelemetrySamples+1), ",") + "]"
+	bomb := `[{"time":"2026-01-02T03:04:05Z","last_error":"` + strings.Repeat("x", maxTelemetryDecoded) + `"}]`
+
+	tests := []struct {
+		name        string
+		env         map[string]json.RawMessage
+		wantSamples int
+		wantDropped uint64
+		wantGzip    bool
+		wantErr     bool
+	}{
+		{"plain", map[string]json.RawMessage{"samples": json.RawMessage(samples), "dropped": json.RawMessage(`3`)}, 1, 3, false, false},
+		{"gzip", map[string]json.RawMessage{"encoding": json.RawMessage(`"gzip"`), "data": gzipTelemetry(t, samples)}, 1, 0, true, false},
+		{"unknown encoding", map[string]json.RawMessage{"encoding": json.RawMessage(`"br"`), "data": gzipTelemetry(t, samples)}, 0, 0, false, true},
+		{"gzip data not gzip", map[string]json.RawMessage{"encoding": json.RawMessage(`"gzip"`), "data": json.RawMessage(`"aGVsbG8="`)}, 0, 0, false, true},
+		{"gzip data not base64", map[string]json.RawMessage{"encoding": json.RawMessage(`"gzip"`), "data": json.RawMessage(`"%%%"`)}, 0, 0, false, true},
+		{"decompresses too large", map[string]json.RawMessage{"encoding": json.RawMessage(`"gzip"`), "data": gzipTelemetry(t, bomb)}, 0, 0, false, true},
+		{"too many samples", map[string]json.RawMessage{"samples": json.RawMessage(tooMany)}, 0, 0, false, true},
+		{"missing samples", map[string]json.RawMessage{}, 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped, gzipped, err := parseAgentTelemetry(tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.wantSamples || dropped != tt.wantDropped || gzipped != tt.wantGzip {
+				t.Fatalf("got %d samples, dropped %d, gzip %v; want %d, %d, %v", len(got), dropped, gzipped, tt.wantSamples, tt.wantDropped, tt.wantGzip)
+			}
+		})
+	}
+}
+
+func TestAgentTelemetryStore(t *testing.T) {
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := newAgentTelemetryStore()
+	s.add("srv", []agentTelemetrySample{
+		{Time: t0, Counters: map[string]uint64{"sessions_total": 1, "messages_forwarded_api_to_mc": 4}},
+		{Time: t0.Add(time.Minute), Counters: map[string]uint64{"messages_forwarded_api_to_mc": 6}, LastError: "dial refused"},
+	}, 2, true)
+	// A late sample still adds to the totals but does not replace the
+	// latest error.
+	s.add("srv", []agentTelemetrySample{
+		{Time: t0.Add(-time.Minute), Counters: map[string]uint64{"sessions_total": 1}},
+	}, 0, false)
+
+	got := s.get("srv")
+	want := agentTelemetry{
+		Totals:       map[string]uint64{"sessions_total": 2, "messages_forwarded_api_to_mc": 10},
+		LastSampleAt: t0.Add(time.Minute),
+		LastError:    "dial refused",
+		Samples:      3,
+		Batches:      2,
+		GzipBatches:  1,
+		Dropped:      2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if other := s.get("other"); other.Samples != 0 || len(other.Totals) != 0 {
+		t.Fatalf("unknown server = %+v, want empty", other)
+	}
+}
+
+func TestAgentTelemetryStoreBounded(t *testing.T) {
+	counters := make(map[string]uint64)
+	for i := 0; i < maxTelemetryCounters+10; i++ {
+		counters[fmt.Sprintf("counter_%d", i)] = 1
+	}
+	counters[strings.Repeat("n", maxTelemetryName+1)] = 1
+
+	s := newAgentTelemetryStore()
+	s.add("srv", []agentTelemetrySample{{Counters: counters}}, 0, false)
+	got := s.get("srv")
+	if len(got.Totals) > maxTelemetryCounters {
+		t.Fatalf("kept %d counters, want at most %d", len(got.Totals), maxTelemetryCounters)
+	}
+	if _, ok := got.Totals[strings.Repeat("n", maxTelemetryName+1)]; ok {
+		t.Fatal("kept a counter name over the length limit")
+	}
+}
@@ -0,0 +1,286 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	actionAllowlistGlobal = "conduit:rpc-allowlist/global"
+	actionAllowlistServer = "conduit:rpc-allowlist"
+
+	maxAllowlistEntries = 500
+	maxAllowlistPattern = 200
+)
+
+var errMethodNotAllowed = errors.New("method not allowed")
+
+type allowlistRequest struct {
+	Methods []string `json:"methods"`
+}
+
+type allowlistResponse struct {
+	ServerID string   `json:"server_id,omitempty"`
+	Methods  []string `json:"methods"`
+}
+
+type allowlistErrorResponse struct {
+	Error  string `json:"error"`
+	Method string `json:"method"`
+}
+
+// methodAllowed reports whether method matches one of patterns. A pattern
+// ending in "*" matches any method with that prefix; anything else must
+// match exactly. An empty list allows everything.
+func methodAllowed(patterns []string, method string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAllowlist trims, validates, de-duplicates, and sorts patterns.
+func normalizeAllowlist(methods []string) ([]string, error) {
+	if len(methods) > maxAllowlistEntries {
+		return nil, fmt.Errorf("at most %d methods allowed", maxAllowlistEntries)
+	}
+	out := make([]string, 0, len(methods))
+	for _, method := range methods {
+		method = strings.TrimSpace(method)
+		if method == "" {
+			return nil, errors.New("methods must not be empty")
+		}
+		if len(method) > maxAllowlistPattern {
+			return nil, fmt.Errorf("method %q is longer than %d characters", method, maxAllowlistPattern)
+		}
+		if i := strings.IndexByte(method, '*'); i >= 0 && i != len(method)-1 {
+			return nil, fmt.Errorf("method %q: '*' is only allowed at the end", method)
+		}
+		out = append(out, method)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// effectiveAllowlist returns the patterns that apply to serverID: its own
+// list when it has one, otherwise the global list. Nil means unrestricted.
+func (a *App) effectiveAllowlist(ctx context.Context, serverID string) ([]string, error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+
+	rows, err := a.DB.Query(ctx, `SELECT server_id IS NOT NULL, pattern FROM rpc_method_allowlist WHERE server_id = $1 OR server_id IS NULL`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var global, server []string
+	for rows.Next() {
+		var (
+			scoped  bool
+			pattern string
+		)
+		if err := rows.Scan(&scoped, &pattern); err != nil {
+			return nil, err
+		}
+		if scoped {
+			server = append(server, pattern)
+		} else {
+			global = append(global, pattern)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(server) > 0 {
+		return server, nil
+	}
+	return global, nil
+}
+
+// checkMethodAllowed returns errMethodNotAllowed when the allowlist in effect
+// for serverID does not cover method.
+func (a *App) checkMethodAllowed(ctx context.Context, serverID, method string) error {
+	patterns, err := a.effectiveAllowlist(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	if !methodAllowed(patterns, method) {
+		return errMethodNotAllowed
+	}
+	return nil
+}
+
+// rejectIfNotAllowed writes 403 and returns true when method is outside the
+// server's allowlist.
+func (a *App) rejectIfNotAllowed(w http.ResponseWriter, r *http.Request, userID, serverID string, req JSONRPC) bool {
+	err := a.checkMethodAllowed(r.Context(), serverID, req.Method)
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, errMethodNotAllowed) {
+		a.internalError(w, err)
+		return true
+	}
+	a.writeJSONStatus(w, http.StatusForbidden, allowlistErrorResponse{Error: err.Error(), Method: req.Method})
+	a.recordAudit(r.Context(), userID, serverID, req.Method, req.Params, "error", err)
+	return true
+}
+
+// loadAllowlist returns the patterns stored for serverID, or the global
+// patterns when serverID is empty.
+func (a *App) loadAllowlist(ctx context.Context, serverID string) ([]string, error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+
+	rows, err := a.DB.Query(ctx, `SELECT pattern FROM rpc_method_allowlist WHERE server_id IS NOT DISTINCT FROM $1 ORDER BY pattern`, nullableUUID(serverID))
+	if err != nil {
+		return nil, err
+	}
+	methods, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if methods == nil {
+		methods = []string{}
+	}
+	return methods, nil
+}
+
+// storeAllowlist replaces the patterns stored for serverID (global when
+// empty) in one transaction.
+func (a *App) storeAllowlist(ctx context.Context, serverID string, methods []string) error {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+
+	scope := nullableUUID(serverID)
+	return pgx.BeginFunc(ctx, a.DB, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM rpc_method_allowlist WHERE server_id IS NOT DISTINCT FROM $1`, scope); err != nil {
+			return err
+		}
+		if len(methods) == 0 {
+			return nil
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO rpc_method_allowlist (server_id, pattern) SELECT $1, unnest($2::text[])`, scope, methods)
+		return err
+	})
+}
+
+func nullableUUID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
+
+func (a *App) serverExists(ctx context.Context, serverID string) (bool, error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+	var exists bool
+	err := a.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM servers WHERE id = $1)`, serverID).Scan(&exists)
+	return exists, err
+}
+
+func (a *App) handleGetGlobalAllowlist(w http.ResponseWriter, r *http.Request) {
+	methods, err := a.loadAllowlist(r.Context(), "")
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	a.writeJSON(w, allowlistResponse{Methods: methods})
+}
+
+func (a *App) handlePutGlobalAllowlist(w http.ResponseWriter, r *http.Request) {
+	a.putAllowlist(w, r, "")
+}
+
+func (a *App) handleGetServerAllowlist(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+	methods, err := a.loadAllowlist(r.Context(), serverID)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	a.writeJSON(w, allowlistResponse{ServerID: serverID, Methods: methods})
+}
+
+func (a *App) handlePutServerAllowlist(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+	a.putAllowlist(w, r, serverID)
+}
+
+// requireServer writes 404 and returns false when serverID is not a known
+// server.
+func (a *App) requireServer(w http.ResponseWriter, r *http.Request, serverID string) bool {
+	if _, err := uuid.Parse(serverID); err != nil {
+		http.NotFound(w, r)
+		return false
+	}
+	exists, err := a.serverExists(r.Context(), serverID)
+	if err != nil {
+		a.internalError(w, err)
+		return false
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return false
+	}
+	return true
+}
+
+func (a *App) putAllowlist(w http.ResponseWriter, r *http.Request, serverID string) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req allowlistRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	methods, err := normalizeAllowlist(req.Methods)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.storeAllowlist(r.Context(), serverID, methods); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	action := actionAllowlistServer
+	if serverID == "" {
+		action = actionAllowlistGlobal
+	}
+	params, _ := json.Marshal(allowlistRequest{Methods: methods})
+	a.recordAudit(r.Context(), user.ID, serverID, action, params, "ok", nil)
+
+	a.writeJSON(w, allowlistResponse{ServerID: serverID, Methods: methods})
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMethodAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		method   string
+		want     bool
+	}{
+		{"no list allows everything", nil, "minecraft:server/stop", true},
+		{"exact match", []string{"minecraft:players"}, "minecraft:players", true},
+		{"exact does not match longer", []string{"minecraft:players"}, "minecraft:players/kick", false},
+		{"exact does not match shorter", []string{"minecraft:players/kick"}, "minecraft:players", false},
+		{"prefix matches longer", []string{"minecraft:players*"}, "minecraft:players/kick", true},
+		{"prefix matches itself", []string{"minecraft:players*"}, "minecraft:players", true},
+		{"prefix with slash excludes bare", []string{"minecraft:players/*"}, "minecraft:players", false},
+		{"bare star matches all", []string{"*"}, "minecraft:server/stop", true},
+		{"no pattern matches", []string{"minecraft:players", "minecraft:bans/*"}, "minecraft:server/stop", false},
+		{"any pattern matches", []string{"minecraft:players", "minecraft:bans/*"}, "minecraft:bans/add", true},
+		{"case sensitive", []string{"minecraft:players"}, "Minecraft:players", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := methodAllowed(tt.patterns, tt.method); got != tt.want {
+				t.Fatalf("methodAllowed(%v, %q) = %v, want %v", tt.patterns, tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		methods []string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", nil, []string{}, false},
+		{"trims, sorts, dedupes", []string{" minecraft:players ", "minecraft:bans/*", "minecraft:players"}, []string{"minecraft:bans/*", "minecraft:players"}, false},
+		{"blank entry", []string{"minecraft:players", "  "}, nil, true},
+		{"star not at end", []string{"minecraft:*/kick"}, nil, true},
+		{"too long", []string{"minecraft:" + strings.Repeat("x", maxAllowlistPattern)}, nil, true},
+		{"too many", make([]string, maxAllowlistEntries+1), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeAllowlist(tt.methods)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
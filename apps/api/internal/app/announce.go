@@ -0,0 +1,126 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	actionAnnounce       = "conduit:announce"
+	actionAnnounceGlobal = "conduit:announce/global"
+	maxAnnouncementLen   = 1000
+)
+
+type announceRequest struct {
+	Message string `json:"message"`
+	Level   string `json:"level"`
+}
+
+type announcementEvent struct {
+	Event    string    `json:"_event"`
+	ServerID string    `json:"server_id,omitempty"`
+	Message  string    `json:"message"`
+	Level    string    `json:"level"`
+	From     string    `json:"from"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+type announceResponse struct {
+	Delivered int `json:"delivered"`
+}
+
+func decodeAnnounceRequest(w http.ResponseWriter, r *http.Request) (announceRequest, bool) {
+	var req announceRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		http.Error(w, "message required", http.StatusBadRequest)
+		return req, false
+	}
+	if len(req.Message) > maxAnnouncementLen {
+		http.Error(w, "message too long", http.StatusBadRequest)
+		return req, false
+	}
+	switch req.Level {
+	case "":
+		req.Level = "info"
+	case "info", "warning", "critical":
+	default:
+		http.Error(w, "level must be info, warning, or critical", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+func (a *App) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+	req, ok := decodeAnnounceRequest(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := json.Marshal(announcementEvent{
+		Event:    "announcement",
+		ServerID: serverID,
+		Message:  req.Message,
+		Level:    req.Level,
+		From:     user.Email,
+		SentAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	delivered := a.Hub.broadcast(serverID, payload, true)
+	params, _ := json.Marshal(req)
+	a.recordAudit(r.Context(), user.ID, serverID, actionAnnounce, params, "ok", nil)
+	a.writeJSON(w, announceResponse{Delivered: delivered})
+}
+
+func (a *App) handleAnnounceGlobal(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	req, ok := decodeAnnounceRequest(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := json.Marshal(announcementEvent{
+		Event:   "announcement",
+		Message: req.Message,
+		Level:   req.Level,
+		From:    user.Email,
+		SentAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	delivered := 0
+	for _, serverID := range a.Hub.clientServerIDs() {
+		delivered += a.Hub.broadcast(serverID, payload, true)
+	}
+	params, _ := json.Marshal(req)
+	a.recordAudit(r.Context(), user.ID, "", actionAnnounceGlobal, params, "ok", nil)
+	a.writeJSON(w, announceResponse{Delivered: delivered})
+}
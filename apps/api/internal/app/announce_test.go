@@ -0,0 +1,39 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAnnounceUnknownServer checks that an unknown server id is answered
+// with 404 before the body is read, whatever the body holds, and that the
+// body is only validated once the server is known to exist.
+func TestAnnounceUnknownServer(t *testing.T) {
+	const unknown = "7d3b8f6e-2c1a-4b5e-9f0d-3a6c8e1b2d4f"
+	tests := []struct {
+		name   string
+		id     string
+		exists bool
+		body   string
+		want   int
+	}{
+		{"valid body", "not-a-uuid", false, `{"message":"restart soon"}`, http.StatusNotFound},
+		{"invalid body", "not-a-uuid", false, `{`, http.StatusNotFound},
+		{"empty message", "42", false, `{"message":""}`, http.StatusNotFound},
+		{"well-formed unknown id", unknown, false, `{`, http.StatusNotFound},
+		{"known server invalid body", unknown, true, `{`, http.StatusBadRequest},
+		{"known server empty message", unknown, true, `{"message":" "}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testApp(t, map[string][][]any{"SELECT EXISTS": {{tt.exists}}})
+			req := serverRequest(t, http.MethodPost, tt.id, tt.body, &AuthUser{ID: "u1", Role: RoleModerator})
+			rec := httptest.NewRecorder()
+			a.handleAnnounce(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +25,9 @@ type apiKeyWithSecret struct {
 	Secret string `json:"secret"`
 }
 
+// likeEscaper makes user input match literally inside an ILIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 type createAPIKeyRequest struct {
 	Name string `json:"name"`
 }
@@ -36,7 +39,54 @@ func (a *App) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := a.DB.Query(r.Context(), `SELECT id, name, created_at FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`, user.ID)
+	query := `SELECT id, name, created_at FROM api_keys WHERE user_id = $1`
+	args := []any{user.ID}
+	if name := strings.TrimSpace(r.URL.Query().Get("name")); name != "" {
+		args = append(args, likeEscaper.Replace(name))
+		query += ` AND name ILIKE '%' || $` + strconv.Itoa(len(args)) + ` || '%'`
+	}
+
+	paged := wantsPage(r)
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if paged {
+		if cursor != nil {
+			args = append(args, cursor.At, cursor.ID)
+			query += ` AND (created_at, id) < ($` + strconv.Itoa(len(args)-1) + `, $` + strconv.Itoa(len(args)) + `)`
+		}
+		args = append(args, limit+1)
+		query += ` ORDER BY created_at DESC, id DESC LIMIT $` + strconv.Itoa(len(args))
+	} else {
+		query += ` ORDER BY created_at DESC, id`
+	}
+
+	// Without limit every key is returned, as before pagination existed.
+	if raw := r.URL.Query().Get("limit"); raw != "" && !paged {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			if parsed < 1 {
+				parsed = 1
+			}
+			if parsed > 500 {
+				parsed = 500
+			}
+			args = append(args, parsed)
+			query += ` LIMIT $` + strconv.Itoa(len(args))
+		}
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" && !paged {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			args = append(args, parsed)
+			query += ` OFFSET $` + strconv.Itoa(len(args))
+		}
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+
+	rows, err := a.DB.Query(ctx, query, args...)
 	if err != nil {
 		a.internalError(w, err)
 		return
@@ -53,6 +103,12 @@ func (a *App) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 		keys = append(keys, item)
 	}
 
+	if paged {
+		a.writeJSON(w, newListPage(keys, limit, func(k apiKey) pageCursor {
+			return pageCursor{At: k.CreatedAt, ID: k.ID}
+		}))
+		return
+	}
 	a.writeJSON(w, keys)
 }
 
@@ -65,9 +121,7 @@ func (a *App) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 
 	var req createAPIKeyRequest
 	defer r.Body.Close()
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	if err := decoder.Decode(&req); err != nil {
+	if err := decodeJSONBody(r, &req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -86,7 +140,9 @@ func (a *App) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 
 	id := uuid.NewString()
 	now := time.Now()
-	if _, err := a.DB.Exec(r.Context(), `INSERT INTO api_keys (id, user_id, name, secret, created_at) VALUES ($1, $2, $3, $4, $5)`, id, user.ID, name, secretHash, now); err != nil {
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	if _, err := a.DB.Exec(ctx, `INSERT INTO api_keys (id, user_id, name, secret, created_at) VALUES ($1, $2, $3, $4, $5)`, id, user.ID, name, secretHash, now); err != nil {
 		a.internalError(w, err)
 		return
 	}
@@ -114,7 +170,10 @@ func (a *App) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tag, err := a.DB.Exec(r.Context(), `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, keyID, user.ID)
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+
+	tag, err := a.DB.Exec(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, keyID, user.ID)
 	if err != nil {
 		a.internalError(w, err)
 		return
@@ -1,25 +1,35 @@
 package app
 
 import (
+	"compress/gzip"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type auditLogItem struct {
-	ID         int64     `json:"id"`
-	Timestamp  time.Time `json:"timestamp"`
-	UserID     *string   `json:"user_id,omitempty"`
-	UserEmail  *string   `json:"user_email,omitempty"`
-	Action     string    `json:"action"`
-	ParamsHash string    `json:"params_sha256"`
-	Result     string    `json:"result_status"`
-	Error      *string   `json:"error_message,omitempty"`
+	ID         int64           `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	UserID     *string         `json:"user_id,omitempty"`
+	UserEmail  *string         `json:"user_email,omitempty"`
+	GroupID    *string         `json:"group_id,omitempty"`
+	Action     string          `json:"action"`
+	ParamsHash string          `json:"params_sha256"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Result     string          `json:"result_status"`
+	Error      *string         `json:"error_message,omitempty"`
+	Attempts   int             `json:"attempts"`
+	// ReplayOf is set on entries recorded by an audit replay.
+	ReplayOf *int64 `json:"replay_of,omitempty"`
 }
 
 func (a *App) handleListAuditLogs(w http.ResponseWriter, r *http.Request) {
@@ -30,20 +40,36 @@ func (a *App) handleListAuditLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	serverID := chi.URLParam(r, "id")
-	limit := 100
-	if raw := r.URL.Query().Get("limit"); raw != "" {
-		if parsed, err := strconv.Atoi(raw); err == nil {
-			if parsed < 1 {
-				parsed = 1
-			}
-			if parsed > 500 {
-				parsed = 500
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	paged := wantsPage(r)
+
+	query := `SELECT al.id, al.ts, al.user_id, u.email, al.group_id, al.action, al.params_sha256, al.params_json, al.result_status, al.error_message, al.attempts, al.replay_of FROM audit_logs al LEFT JOIN users u ON u.id = al.user_id WHERE al.server_id = $1`
+	args := []any{serverID}
+	if paged {
+		if cursor != nil {
+			afterID, err := strconv.ParseInt(cursor.ID, 10, 64)
+			if err != nil {
+				http.Error(w, errInvalidCursor.Error(), http.StatusBadRequest)
+				return
 			}
-			limit = parsed
+			args = append(args, cursor.At, afterID)
+			query += ` AND (al.ts, al.id) < ($2, $3)`
 		}
+		args = append(args, limit+1)
+		query += fmt.Sprintf(` ORDER BY al.ts DESC, al.id DESC LIMIT $%d`, len(args))
+	} else {
+		args = append(args, limit)
+		query += ` ORDER BY al.ts DESC LIMIT $2`
 	}
 
-	rows, err := a.DB.Query(r.Context(), `SELECT al.id, al.ts, al.user_id, u.email, al.action, al.params_sha256, al.result_status, al.error_message FROM audit_logs al LEFT JOIN users u ON u.id = al.user_id WHERE al.server_id = $1 ORDER BY al.ts DESC LIMIT $2`, serverID, limit)
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+
+	rows, err := a.ReadDB.Query(ctx, query, args...)
 	if err != nil {
 		a.internalError(w, err)
 		return
@@ -58,7 +84,11 @@ func (a *App) handleListAuditLogs(w http.ResponseWriter, r *http.Request) {
 			email  *string
 			errMsg *string
 		)
-		if err := rows.Scan(&item.ID, &item.Timestamp, &userID, &email, &item.Action, &item.ParamsHash, &item.Result, &errMsg); err != nil {
+		if err := rows.Scan(&item.ID, &item.Timestamp, &userID, &email, &item.GroupID, &item.Action, &item.ParamsHash, &item.Params, &item.Result, &errMsg, &item.Attempts, &item.ReplayOf); err != nil {
+			a.internalError(w, err)
+			return
+		}
+		if item.Params, err = a.cipher.open(item.Params, aadAuditParams); err != nil {
 			a.internalError(w, err)
 			return
 		}
@@ -68,9 +98,43 @@ func (a *App) handleListAuditLogs(w http.ResponseWriter, r *http.Request) {
 		items = append(items, item)
 	}
 
+	if paged {
+		a.writeJSON(w, newListPage(items, limit, func(item auditLogItem) pageCursor {
+			return pageCursor{At: item.Timestamp, ID: strconv.FormatInt(item.ID, 10)}
+		}))
+		return
+	}
 	a.writeJSON(w, items)
 }
 
+// auditExportFlushRows is how many rows an export writes between flushes,
+// so large downloads stream rather than arrive all at once.
+const auditExportFlushRows = 500
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, "gzip") && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				q, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		return q > 0
+	}
+	return false
+}
+
+// handleExportAuditLogs streams a server's audit entries as CSV. With
+// ?compress=gzip the download is a .csv.gz file; otherwise a client that
+// sends Accept-Encoding: gzip gets the same CSV gzip-encoded in transit.
+// ?chain=true adds a chain_sha256 column and a trailing #chain_final row
+// (see auditChain), also sent as the X-Audit-Chain-SHA256 trailer.
 func (a *App) handleExportAuditLogs(w http.ResponseWriter, r *http.Request) {
 	user := userFromContext(r.Context())
 	if user == nil || !user.Role.Meets(RoleViewer) {
@@ -97,36 +161,33 @@ func (a *App) handleExportAuditLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	query := `SELECT al.ts, u.email, al.action, al.params_sha256, al.result_status, al.error_message FROM audit_logs al LEFT JOIN users u ON u.id = al.user_id WHERE al.server_id = $1`
-	args := []any{serverID}
-	param := 2
-
-	if fromRaw := r.URL.Query().Get("from"); fromRaw != "" {
-		from, err := time.Parse(time.RFC3339, fromRaw)
-		if err != nil {
-			http.Error(w, "invalid from timestamp", http.StatusBadRequest)
-			return
-		}
-		query += fmt.Sprintf(" AND al.ts >= $%d", param)
-		args = append(args, from)
-		param++
+	gzipFile := false
+	switch r.URL.Query().Get("compress") {
+	case "":
+	case "gzip":
+		gzipFile = true
+	default:
+		http.Error(w, "compress must be gzip", http.StatusBadRequest)
+		return
 	}
+	gzipTransfer := !gzipFile && acceptsGzip(r.Header.Get("Accept-Encoding"))
+	chained, _ := strconv.ParseBool(r.URL.Query().Get("chain"))
 
-	if toRaw := r.URL.Query().Get("to"); toRaw != "" {
-		to, err := time.Parse(time.RFC3339, toRaw)
-		if err != nil {
-			http.Error(w, "invalid to timestamp", http.StatusBadRequest)
-			return
-		}
-		query += fmt.Sprintf(" AND al.ts <= $%d", param)
-		args = append(args, to)
-		param++
+	where, args, err := auditRangeFilter(r, serverID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	query += fmt.Sprintf(" ORDER BY al.ts ASC LIMIT $%d", param)
+	query := `SELECT al.ts, u.email, al.action, al.params_sha256, al.result_status, al.error_message FROM audit_logs al LEFT JOIN users u ON u.id = al.user_id WHERE ` + where
+	// The id breaks timestamp ties so a chained export is reproducible.
+	query += fmt.Sprintf(" ORDER BY al.ts ASC, al.id ASC LIMIT $%d", len(args)+1)
 	args = append(args, limit)
 
-	rows, err := a.DB.Query(r.Context(), query, args...)
+	// Exports stream up to thousands of rows, so they get a longer budget.
+	ctx, cancel := a.exportQueryContext(r.Context())
+	defer cancel()
+
+	rows, err := a.ReadDB.Query(ctx, query, args...)
 	if err != nil {
 		a.internalError(w, err)
 		return
@@ -134,19 +195,55 @@ func (a *App) handleExportAuditLogs(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	filename := fmt.Sprintf("server-%s-audit.csv", serverID)
-	w.Header().Set("Content-Type", "text/csv")
+	contentType := "text/csv"
+	if gzipFile {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Add("Vary", "Accept-Encoding")
+	if gzipTransfer {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	if chained {
+		w.Header().Set("Trailer", "X-Audit-Chain-SHA256")
+	}
 	w.WriteHeader(http.StatusOK)
 
-	writer := csv.NewWriter(w)
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if gzipFile || gzipTransfer {
+		gz = gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	writer := csv.NewWriter(out)
 	defer writer.Flush()
+	flusher, _ := w.(http.Flusher)
+	// flush pushes buffered rows through the csv and gzip writers to the
+	// client.
+	flush := func() {
+		writer.Flush()
+		if gz != nil {
+			_ = gz.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
 
-	if err := writer.Write([]string{"timestamp", "user_email", "action", "params_sha256", "result_status", "error_message"}); err != nil {
+	header := []string{"timestamp", "user_email", "action", "params_sha256", "result_status", "error_message"}
+	var chain auditChain
+	if chained {
+		header = append(header, "chain_sha256")
+	}
+	if err := writer.Write(header); err != nil {
 		a.Logger.Error("failed to write csv header", slog.Any("err", err))
 		return
 	}
 
-	for rows.Next() {
+	for n := 1; rows.Next(); n++ {
 		var (
 			ts     time.Time
 			email  *string
@@ -170,10 +267,16 @@ func (a *App) handleExportAuditLogs(w http.ResponseWriter, r *http.Request) {
 		}
 
 		record := []string{ts.UTC().Format(time.RFC3339), emailVal, action, params, result, errVal}
+		if chained {
+			record = append(record, chain.next(record))
+		}
 		if err := writer.Write(record); err != nil {
 			a.Logger.Error("failed to write csv row", slog.Any("err", err))
 			return
 		}
+		if n%auditExportFlushRows == 0 {
+			flush()
+		}
 	}
 
 	if err := rows.Err(); err != nil {
@@ -181,8 +284,221 @@ func (a *App) handleExportAuditLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if chained {
+		final := make([]string, len(header))
+		final[0] = auditChainFinalMarker
+		final[len(final)-1] = chain.last
+		if err := writer.Write(final); err != nil {
+			a.Logger.Error("failed to write csv row", slog.Any("err", err))
+			return
+		}
+		w.Header().Set("X-Audit-Chain-SHA256", chain.last)
+	}
+
 	writer.Flush()
 	if err := writer.Error(); err != nil {
 		a.Logger.Error("csv writer error", slog.Any("err", err))
 	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			a.Logger.Error("gzip writer error", slog.Any("err", err))
+		}
+	}
+}
+
+// auditRangeFilter builds the WHERE clause shared by audit exports and stats:
+// the server plus optional RFC 3339 from/to bounds on al.ts.
+func auditRangeFilter(r *http.Request, serverID string) (string, []any, error) {
+	where := "al.server_id = $1"
+	args := []any{serverID}
+
+	if fromRaw := r.URL.Query().Get("from"); fromRaw != "" {
+		from, err := time.Parse(time.RFC3339, fromRaw)
+		if err != nil {
+			return "", nil, errors.New("invalid from timestamp")
+		}
+		args = append(args, from)
+		where += fmt.Sprintf(" AND al.ts >= $%d", len(args))
+	}
+
+	if toRaw := r.URL.Query().Get("to"); toRaw != "" {
+		to, err := time.Parse(time.RFC3339, toRaw)
+		if err != nil {
+			return "", nil, errors.New("invalid to timestamp")
+		}
+		args = append(args, to)
+		where += fmt.Sprintf(" AND al.ts <= $%d", len(args))
+	}
+
+	return where, args, nil
+}
+
+type auditCount struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type auditUserCount struct {
+	UserID    *string `json:"user_id,omitempty"`
+	UserEmail *string `json:"user_email,omitempty"`
+	Count     int64   `json:"count"`
+}
+
+type auditStatsResponse struct {
+	Total      int64            `json:"total"`
+	ByStatus   []auditCount     `json:"by_status"`
+	TopActions []auditCount     `json:"top_actions"`
+	ByUser     []auditUserCount `json:"by_user"`
+}
+
+const auditStatsTopActions = 10
+
+func (a *App) handleAuditStats(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	where, args, err := auditRangeFilter(r, serverID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+
+	resp := auditStatsResponse{
+		ByStatus:   make([]auditCount, 0),
+		TopActions: make([]auditCount, 0),
+		ByUser:     make([]auditUserCount, 0),
+	}
+
+	rows, err := a.ReadDB.Query(ctx, `SELECT al.result_status, COUNT(*) FROM audit_logs al WHERE `+where+` GROUP BY al.result_status ORDER BY al.result_status`, args...)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	for rows.Next() {
+		var item auditCount
+		if err := rows.Scan(&item.Key, &item.Count); err != nil {
+			rows.Close()
+			a.internalError(w, err)
+			return
+		}
+		resp.Total += item.Count
+		resp.ByStatus = append(resp.ByStatus, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	rows, err = a.ReadDB.Query(ctx, `SELECT al.action, COUNT(*) AS n FROM audit_logs al WHERE `+where+fmt.Sprintf(` GROUP BY al.action ORDER BY n DESC, al.action LIMIT %d`, auditStatsTopActions), args...)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	for rows.Next() {
+		var item auditCount
+		if err := rows.Scan(&item.Key, &item.Count); err != nil {
+			rows.Close()
+			a.internalError(w, err)
+			return
+		}
+		resp.TopActions = append(resp.TopActions, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	rows, err = a.ReadDB.Query(ctx, `SELECT al.user_id, u.email, COUNT(*) AS n FROM audit_logs al LEFT JOIN users u ON u.id = al.user_id WHERE `+where+` GROUP BY al.user_id, u.email ORDER BY n DESC`, args...)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item auditUserCount
+		if err := rows.Scan(&item.UserID, &item.UserEmail, &item.Count); err != nil {
+			a.internalError(w, err)
+			return
+		}
+		resp.ByUser = append(resp.ByUser, item)
+	}
+	if err := rows.Err(); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	a.writeJSON(w, resp)
+}
+
+type retentionServerCount struct {
+	ServerID   *string `json:"server_id"`
+	ServerName *string `json:"server_name,omitempty"`
+	Count      int64   `json:"count"`
+}
+
+type retentionPreviewResponse struct {
+	Cutoff  time.Time              `json:"cutoff"`
+	Total   int64                  `json:"total"`
+	Servers []retentionServerCount `json:"servers"`
+}
+
+// parseRetentionCutoff accepts older_than as a Go duration measured back
+// from now (e.g. 2160h) or as an RFC 3339 timestamp.
+func parseRetentionCutoff(raw string, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, errors.New("older_than required")
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		if d <= 0 {
+			return time.Time{}, errors.New("older_than must be positive")
+		}
+		return now.Add(-d), nil
+	}
+	cutoff, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, errors.New("older_than must be a duration such as 2160h or an RFC 3339 timestamp")
+	}
+	return cutoff, nil
+}
+
+// handleRetentionPreview counts the audit rows older than the cutoff per
+// server without deleting anything. Entries with no server (e.g. global
+// announcements) are reported with a null server_id.
+func (a *App) handleRetentionPreview(w http.ResponseWriter, r *http.Request) {
+	cutoff, err := parseRetentionCutoff(r.URL.Query().Get("older_than"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The count may scan most of the table, so it gets the export budget.
+	ctx, cancel := a.exportQueryContext(r.Context())
+	defer cancel()
+
+	rows, err := a.ReadDB.Query(ctx, `SELECT al.server_id, s.name, COUNT(*) AS n FROM audit_logs al LEFT JOIN servers s ON s.id = al.server_id WHERE al.ts < $1 GROUP BY al.server_id, s.name ORDER BY n DESC, al.server_id`, cutoff)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	resp := retentionPreviewResponse{Cutoff: cutoff.UTC(), Servers: make([]retentionServerCount, 0)}
+	for rows.Next() {
+		var item retentionServerCount
+		if err := rows.Scan(&item.ServerID, &item.ServerName, &item.Count); err != nil {
+			a.internalError(w, err)
+			return
+		}
+		resp.Total += item.Count
+		resp.Servers = append(resp.Servers, item)
+	}
+	if err := rows.Err(); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	a.writeJSON(w, resp)
 }
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// auditChainFinalMarker starts the trailing row of a chained export, which
+// carries the final chain hash.
+const auditChainFinalMarker = "#chain_final"
+
+// auditChain computes the running hash of a chained audit export. Each
+// row's hash is the hex SHA-256 of the previous row's hash followed by the
+// row's exported fields, all separated by NUL bytes; the first row starts
+// from an empty previous hash. Postgres text cannot hold NUL, so the input
+// is unambiguous, and changing, dropping, or reordering any row changes
+// every hash after it.
+type auditChain struct {
+	last string
+}
+
+// next returns the chain hash for a row and advances the chain.
+func (c *auditChain) next(fields []string) string {
+	h := sha256.New()
+	h.Write([]byte(c.last))
+	for _, field := range fields {
+		h.Write([]byte{0})
+		h.Write([]byte(field))
+	}
+	c.last = hex.EncodeToString(h.Sum(nil))
+	return c.last
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AuditVerbosity says which calls to a method are written to the audit log.
+type AuditVerbosity string
+
+const (
+	AuditAlways     AuditVerbosity = "always"
+	AuditErrorsOnly AuditVerbosity = "errors_only"
+	AuditOff        AuditVerbosity = "off"
+)
+
+// AuditPolicyRule sets the verbosity for methods matching Pattern, which
+// uses the RPC allowlist syntax: an exact method or a prefix ending in *.
+type AuditPolicyRule struct {
+	Pattern   string
+	Verbosity AuditVerbosity
+}
+
+// ParseAuditPolicy reads comma-separated pattern=verbosity pairs, e.g.
+// "minecraft:server/status=errors_only,minecraft:players*=always".
+func ParseAuditPolicy(raw string) ([]AuditPolicyRule, error) {
+	var rules []AuditPolicyRule
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, verbosity, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("audit policy %q must be pattern=verbosity", entry)
+		}
+		switch v := AuditVerbosity(strings.TrimSpace(verbosity)); v {
+		case AuditAlways, AuditErrorsOnly, AuditOff:
+			rules = append(rules, AuditPolicyRule{Pattern: pattern, Verbosity: v})
+		default:
+			return nil, fmt.Errorf("audit policy %q: verbosity must be always, errors_only, or off", entry)
+		}
+	}
+	return rules, nil
+}
+
+// auditVerbosity returns the verbosity of the most specific rule matching
+// action: an exact pattern beats any prefix, and a longer prefix beats a
+// shorter one. Unmatched methods and conduit: actions are always audited.
+func auditVerbosity(rules []AuditPolicyRule, action string) AuditVerbosity {
+	if strings.HasPrefix(action, "conduit:") {
+		return AuditAlways
+	}
+	verbosity := AuditAlways
+	best := -1
+	for _, rule := range rules {
+		prefix, wildcard := strings.CutSuffix(rule.Pattern, "*")
+		switch {
+		case !wildcard && action == rule.Pattern:
+			return rule.Verbosity
+		case wildcard && strings.HasPrefix(action, prefix) && len(prefix) > best:
+			verbosity, best = rule.Verbosity, len(prefix)
+		}
+	}
+	return verbosity
+}
+
+// auditRecords reports whether an entry for action with status is kept
+// under the configured AUDIT_METHOD_POLICY.
+func (a *App) auditRecords(action, status string) bool {
+	switch auditVerbosity(a.auditPolicy, action) {
+	case AuditOff:
+		return false
+	case AuditErrorsOnly:
+		return status == "error"
+	default:
+		return true
+	}
+}
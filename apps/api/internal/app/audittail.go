@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"nhooyr.io/websocket"
+)
+
+// auditTailBuffer is how many entries a slow tail client may fall behind
+// before new entries are dropped for it.
+const auditTailBuffer = 64
+
+// auditTailEvent is one audit entry pushed to tail clients. It carries the
+// same fields as the audit list, minus the row id, which does not exist
+// until the batch is written.
+type auditTailEvent struct {
+	Event      string          `json:"_event"`
+	Timestamp  time.Time       `json:"timestamp"`
+	UserID     *string         `json:"user_id,omitempty"`
+	GroupID    *string         `json:"group_id,omitempty"`
+	Action     string          `json:"action"`
+	ParamsHash string          `json:"params_sha256"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Result     string          `json:"result_status"`
+	Error      *string         `json:"error_message,omitempty"`
+	Attempts   int             `json:"attempts"`
+	ReplayOf   *int64          `json:"replay_of,omitempty"`
+}
+
+// auditTail fans audit entries out to live tail subscribers by server.
+type auditTail struct {
+	mu   sync.Mutex
+	subs map[string]map[chan auditTailEvent]struct{}
+}
+
+func newAuditTail() *auditTail {
+	return &auditTail{subs: make(map[string]map[chan auditTailEvent]struct{})}
+}
+
+func (t *auditTail) subscribe(serverID string) (<-chan auditTailEvent, func()) {
+	ch := make(chan auditTailEvent, auditTailBuffer)
+	t.mu.Lock()
+	if t.subs[serverID] == nil {
+		t.subs[serverID] = make(map[chan auditTailEvent]struct{})
+	}
+	t.subs[serverID][ch] = struct{}{}
+	t.mu.Unlock()
+
+	return ch, func() {
+		t.mu.Lock()
+		delete(t.subs[serverID], ch)
+		if len(t.subs[serverID]) == 0 {
+			delete(t.subs, serverID)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// publish hands e to every subscriber of its server without blocking;
+// subscribers that are full miss it.
+func (t *auditTail) publish(e auditEntry) {
+	if e.serverID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	subs := t.subs[e.serverID]
+	if len(subs) == 0 {
+		return
+	}
+
+	event := auditTailEvent{
+		Event:      "audit",
+		Timestamp:  e.ts,
+		Action:     e.action,
+		ParamsHash: e.paramsHash,
+		Params:     e.redacted,
+		Result:     e.status,
+		Error:      e.errMsg,
+		Attempts:   max(e.attempts, 1),
+	}
+	if e.userID != "" {
+		event.UserID = &e.userID
+	}
+	if e.groupID != "" {
+		event.GroupID = &e.groupID
+	}
+	if e.replayOf != 0 {
+		event.ReplayOf = &e.replayOf
+	}
+	for ch := range subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// submitAudit queues e for storage and shows it to live tail clients,
+// unless AUDIT_METHOD_POLICY leaves it out.
+func (a *App) submitAudit(e auditEntry) {
+	if !a.auditRecords(e.action, e.status) {
+		a.audit.skipped.Add(1)
+		return
+	}
+	a.audit.enqueue(e)
+	a.auditTail.publish(e)
+}
+
+// handleAuditTail streams a server's audit entries as they are recorded.
+// Params appear only when AUDIT_STORE_PARAMS is on, already redacted, as in
+// the audit list.
+func (a *App) handleAuditTail(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !user.Role.Meets(RoleModerator) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+
+	if err := a.Hub.acquireClientSlot(serverID); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer a.Hub.releaseClientSlot(serverID)
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+		Subprotocols:    []string{"jwt"},
+		OriginPatterns:  a.wsOriginPatterns,
+	})
+	if err != nil {
+		a.Logger.Error("ws accept failed", slog.Any("err", err))
+		return
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "normal closure")
+
+	events, unsubscribe := a.auditTail.subscribe(serverID)
+	defer unsubscribe()
+
+	// Tail clients only listen; CloseRead answers pings and cancels ctx
+	// when the client goes away.
+	ctx := conn.CloseRead(r.Context())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			payload, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err = conn.Write(writeCtx, websocket.MessageText, payload)
+			cancel()
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					a.Logger.Info("audit tail client write failed", slog.String("server_id", serverID), slog.Any("err", err))
+				}
+				return
+			}
+		}
+	}
+}
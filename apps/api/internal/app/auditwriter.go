@@ -0,0 +1,251 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	auditBatchSize     = 100
+	auditFlushInterval = 500 * time.Millisecond
+)
+
+type auditEntry struct {
+	ts         time.Time
+	userID     string
+	serverID   string
+	groupID    string
+	action     string
+	paramsHash string
+	params     json.RawMessage
+	status     string
+	errMsg     *string
+	// attempts is how many times the call was sent to the agent; zero is
+	// stored as one.
+	attempts int
+	// redacted is params before encryption; it is shown to live tail
+	// clients and never written.
+	redacted json.RawMessage
+	// replayOf is the audit entry a replayed call re-issued; zero otherwise.
+	replayOf int64
+}
+
+const auditInsertSQL = `INSERT INTO audit_logs (ts, user_id, server_id, group_id, action, params_sha256, params_json, result_status, error_message, attempts, replay_of) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+// auditDB is the part of *pgxpool.Pool the writer uses.
+type auditDB interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+type auditWriterStats struct {
+	QueueDepth    int    `json:"queue_depth"`
+	QueueCapacity int    `json:"queue_capacity"`
+	Written       uint64 `json:"written_total"`
+	Dropped       uint64 `json:"dropped_total"`
+	Failed        uint64 `json:"failed_total"`
+	// Skipped counts entries AUDIT_METHOD_POLICY chose not to record.
+	Skipped uint64 `json:"skipped_total"`
+}
+
+// auditWriter decouples audit inserts from request latency. Entries are
+// queued on a bounded channel and inserted in batches by a single worker;
+// when the queue is full new entries are dropped and counted rather than
+// blocking the caller.
+type auditWriter struct {
+	db           auditDB
+	logger       *slog.Logger
+	queryTimeout time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan auditEntry
+	done   chan struct{}
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+	skipped atomic.Uint64
+}
+
+func newAuditWriter(db auditDB, size int, queryTimeout time.Duration, logger *slog.Logger) *auditWriter {
+	if size <= 0 {
+		size = 1024
+	}
+	w := &auditWriter{
+		db:           db,
+		logger:       logger,
+		queryTimeout: queryTimeout,
+		queue:        make(chan auditEntry, size),
+		done:         make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *auditWriter) enqueue(entry auditEntry) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return
+	}
+	// A malformed id would fail the insert, so it is refused here rather
+	// than in the worker.
+	if !entry.validIDs() {
+		w.failed.Add(1)
+		w.logger.Warn("dropping audit entry with invalid id", slog.String("action", entry.action), slog.String("server_id", entry.serverID), slog.String("user_id", entry.userID), slog.String("group_id", entry.groupID))
+		return
+	}
+	select {
+	case w.queue <- entry:
+	default:
+		w.dropped.Add(1)
+		w.logger.Warn("audit queue full; dropping entry", slog.String("action", entry.action), slog.String("server_id", entry.serverID))
+	}
+}
+
+// validIDs reports whether the entry's ids are UUIDs or, for the optional
+// server and group, empty.
+func (e auditEntry) validIDs() bool {
+	if _, err := uuid.Parse(e.userID); err != nil {
+		return false
+	}
+	for _, id := range []string{e.serverID, e.groupID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// insertArgs returns the arguments for auditInsertSQL.
+func (e auditEntry) insertArgs() []any {
+	// Entries not tied to a server (e.g. global announcements) store NULL.
+	var serverID, groupID *string
+	if e.serverID != "" {
+		serverID = &e.serverID
+	}
+	if e.groupID != "" {
+		groupID = &e.groupID
+	}
+	var replayOf *int64
+	if e.replayOf != 0 {
+		replayOf = &e.replayOf
+	}
+	return []any{e.ts, e.userID, serverID, groupID, e.action, e.paramsHash, e.params, e.status, e.errMsg, max(e.attempts, 1), replayOf}
+}
+
+func (w *auditWriter) stats() auditWriterStats {
+	return auditWriterStats{
+		QueueDepth:    len(w.queue),
+		QueueCapacity: cap(w.queue),
+		Written:       w.written.Load(),
+		Dropped:       w.dropped.Load(),
+		Failed:        w.failed.Load(),
+		Skipped:       w.skipped.Load(),
+	}
+}
+
+// Close stops accepting entries and waits for the queue to be flushed, or
+// for ctx to end.
+func (w *auditWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *auditWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]auditEntry, 0, auditBatchSize)
+	for {
+		select {
+		case entry, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= auditBatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (w *auditWriter) flush(entries []auditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		batch.Queue(auditInsertSQL, e.insertArgs()...)
+	}
+
+	ctx, cancel := withQueryTimeout(context.Background(), w.queryTimeout)
+	defer cancel()
+	if err := w.db.SendBatch(ctx, batch).Close(); err != nil {
+		// The batch runs as one transaction, so a single bad row rolls
+		// back the rest. Retry one at a time to keep the good ones.
+		w.logger.Warn("audit log batch failed; retrying entries individually", slog.Int("entries", len(entries)), slog.Any("err", err))
+		w.flushEach(entries)
+		return
+	}
+	w.written.Add(uint64(len(entries)))
+}
+
+// flushEach inserts entries one by one, dropping only those the database
+// rejects. An error that is not from Postgres (the pool is down, or the
+// timeout passed) fails the remaining entries without trying them.
+func (w *auditWriter) flushEach(entries []auditEntry) {
+	for i, e := range entries {
+		ctx, cancel := withQueryTimeout(context.Background(), w.queryTimeout)
+		_, err := w.db.Exec(ctx, auditInsertSQL, e.insertArgs()...)
+		cancel()
+		if err == nil {
+			w.written.Add(1)
+			continue
+		}
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) {
+			w.failed.Add(uint64(len(entries) - i))
+			w.logger.Error("failed to write audit log entries", slog.Int("entries", len(entries)-i), slog.Any("err", err))
+			return
+		}
+		w.failed.Add(1)
+		w.logger.Error("failed to write audit log entry", slog.String("action", e.action), slog.String("server_id", e.serverID), slog.Any("err", err))
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeAuditDB fails a batch containing any server in reject, as Postgres
+// would, and single inserts for those servers only. When down is set every
+// call fails with a non-Postgres error.
+type fakeAuditDB struct {
+	reject map[string]bool
+	down   bool
+	execs  int
+}
+
+type fakeBatchResults struct{ err error }
+
+func (r fakeBatchResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, r.err }
+func (r fakeBatchResults) Query() (pgx.Rows, error)         { return nil, r.err }
+func (r fakeBatchResults) QueryRow() pgx.Row                { return nil }
+func (r fakeBatchResults) Close() error                     { return r.err }
+
+func (f *fakeAuditDB) insertErr(args []any) error {
+	if f.down {
+		return errors.New("connection refused")
+	}
+	if serverID, _ := args[2].(*string); serverID != nil && f.reject[*serverID] {
+		return &pgconn.PgError{Code: "23503", Message: "violates foreign key constraint"}
+	}
+	return nil
+}
+
+func (f *fakeAuditDB) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	for _, q := range b.QueuedQueries {
+		if err := f.insertErr(q.Arguments); err != nil {
+			return fakeBatchResults{err: err}
+		}
+	}
+	return fakeBatchResults{}
+}
+
+func (f *fakeAuditDB) Exec(_ context.Context, _ string, args ...any) (pgconn.CommandTag, error) {
+	f.execs++
+	return pgconn.CommandTag{}, f.insertErr(args)
+}
+
+func TestAuditWriterFlush(t *testing.T) {
+	good, bad := uuid.NewString(), uuid.NewString()
+	entry := func(serverID string) auditEntry {
+		return auditEntry{userID: uuid.NewString(), serverID: serverID, action: "minecraft:players", status: "ok"}
+	}
+
+	tests := []struct {
+		name        string
+		down        bool
+		entries     []auditEntry
+		wantWritten uint64
+		wantFailed  uint64
+		wantExecs   int
+	}{
+		{"all good", false, []auditEntry{entry(good), entry(""), entry(good)}, 3, 0, 0},
+		{"one bad row", false, []auditEntry{entry(good), entry(bad), entry(good)}, 2, 1, 3},
+		{"every row bad", false, []auditEntry{entry(bad), entry(bad)}, 0, 2, 2},
+		{"database down", true, []auditEntry{entry(good), entry(good), entry(good)}, 0, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeAuditDB{reject: map[string]bool{bad: true}, down: tt.down}
+			w := &auditWriter{db: db, logger: testLogger()}
+			w.flush(tt.entries)
+			if got := w.written.Load(); got != tt.wantWritten {
+				t.Errorf("written = %d, want %d", got, tt.wantWritten)
+			}
+			if got := w.failed.Load(); got != tt.wantFailed {
+				t.Errorf("failed = %d, want %d", got, tt.wantFailed)
+			}
+			if db.execs != tt.wantExecs {
+				t.Errorf("single inserts = %d, want %d", db.execs, tt.wantExecs)
+			}
+		})
+	}
+}
+
+func TestAuditWriterRejectsInvalidIDs(t *testing.T) {
+	id := uuid.NewString()
+	tests := []struct {
+		name   string
+		entry  auditEntry
+		queued bool
+	}{
+		{"valid", auditEntry{userID: id, serverID: id, groupID: id}, true},
+		{"no server or group", auditEntry{userID: id}, true},
+		{"bad server", auditEntry{userID: id, serverID: "not-a-uuid"}, false},
+		{"bad group", auditEntry{userID: id, groupID: "g1"}, false},
+		{"missing user", auditEntry{serverID: id}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &auditWriter{logger: testLogger(), queue: make(chan auditEntry, 1)}
+			w.enqueue(tt.entry)
+			if queued := len(w.queue) == 1; queued != tt.queued {
+				t.Fatalf("queued = %v, want %v", queued, tt.queued)
+			}
+			if failed := w.failed.Load() == 1; failed == tt.queued {
+				t.Fatalf("failed_total = %d with queued = %v", w.failed.Load(), tt.queued)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bootstrapLockKey serializes bootstrap attempts across API replicas so two
+// concurrent requests cannot both see an empty users table.
+const bootstrapLockKey = 0x636f6e64756974 // "conduit"
+
+var errBootstrapCompleted = errors.New("bootstrap already completed")
+
+// BootstrapOwner creates the first owner account. It returns
+// errBootstrapCompleted once any user exists, so it is safe to call on every
+// startup.
+func (a *App) BootstrapOwner(ctx context.Context, email, password string) error {
+	_, err := a.bootstrapOwner(ctx, email, password)
+	return err
+}
+
+// bootstrapOwner is BootstrapOwner returning the new owner's id.
+func (a *App) bootstrapOwner(ctx context.Context, email, password string) (string, error) {
+	email = strings.TrimSpace(strings.ToLower(email))
+	if email == "" || password == "" {
+		return "", errors.New("email and password required")
+	}
+
+	id := uuid.NewString()
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+	err := pgx.BeginFunc(ctx, a.DB, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, bootstrapLockKey); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users)`).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return errBootstrapCompleted
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO users (id, email, password_hash, role) VALUES ($1, $2, $3, 'owner')`, id, email, string(hash))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// IsBootstrapCompleted reports whether err came from BootstrapOwner finding
+// an existing user.
+func IsBootstrapCompleted(err error) bool {
+	return errors.Is(err, errBootstrapCompleted)
+}
+
+func (a *App) handleBootstrap(w http.ResponseWriter, r *http.Request) {
+	if a.disableBootstrap {
+		http.Error(w, "bootstrap disabled", http.StatusForbidden)
+		return
+	}
+
+	var req bootstrapRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Email) == "" || req.Password == "" {
+		http.Error(w, "email and password required", http.StatusBadRequest)
+		return
+	}
+
+	// With ?login=true the new owner's session is issued in the same
+	// request, so a setup wizard needs no separate login.
+	login, _ := strconv.ParseBool(r.URL.Query().Get("login"))
+
+	id, err := a.bootstrapOwner(r.Context(), req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, errBootstrapCompleted) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if !login {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	resp, err := a.issueSession(r.Context(), id, strings.TrimSpace(strings.ToLower(req.Email)), RoleOwner)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	a.writeJSONStatus(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"nhooyr.io/websocket"
+)
+
+// maxClientRPCInFlight bounds the RPCs one event client may have running at
+// once, so a single socket cannot tie up the agent.
+const maxClientRPCInFlight = 8
+
+var errSessionEnded = errors.New("session ended")
+
+// currentSessionUser reloads the user behind the socket's session. It fails
+// with errSessionEnded when the session has been revoked or has expired.
+func (a *App) currentSessionUser(ctx context.Context) (*AuthUser, error) {
+	hash := sessionHashFromContext(ctx)
+	if hash == "" {
+		return nil, errSessionEnded
+	}
+	user, _, err := a.lookupSessionHash(ctx, hash)
+	switch {
+	case err == nil:
+		return user, nil
+	case errors.Is(err, pgx.ErrNoRows), errors.Is(err, errSessionRevoked), errors.Is(err, errSessionExpired):
+		return nil, errSessionEnded
+	}
+	return nil, err
+}
+
+// clientRPCResult answers a {"type":"rpc"} message on the event socket.
+// Status is the HTTP status POST /rpc would have returned for the call.
+type clientRPCResult struct {
+	Type     string          `json:"type"`
+	Ref      string          `json:"ref,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// handleClientRPC runs a JSON-RPC call sent over the event socket with the
+// same allowlist, role, sudo, suspension, and audit handling as POST /rpc,
+// and replies with an rpc_result frame carrying msg.Ref. The call runs in
+// its own goroutine so events keep flowing while it is outstanding.
+// Notifications and streamed methods are not accepted here.
+//
+// The session is looked up again for every call, so role changes and sudo
+// windows apply at once. A session that has been revoked or has expired
+// closes the socket.
+func (a *App) handleClientRPC(ctx context.Context, serverID string, client *ClientConn, msg clientMessage) {
+	reply := func(res clientRPCResult) {
+		res.Type = "rpc_result"
+		res.Ref = msg.Ref
+		payload, err := json.Marshal(res)
+		if err != nil {
+			return
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := client.Send(sendCtx, payload); err != nil {
+			a.Logger.Warn("failed to send rpc result", slog.String("server_id", serverID), slog.Any("err", err))
+		}
+	}
+	fail := func(status int, err error) {
+		reply(clientRPCResult{Status: status, Error: err.Error()})
+	}
+
+	switch {
+	case msg.Method == "":
+		fail(http.StatusBadRequest, errors.New("method required"))
+		return
+	case msg.Method == commandMethod:
+		fail(http.StatusBadRequest, errCommandViaRPC)
+		return
+	case a.streamsMethod(msg.Method):
+		fail(http.StatusBadRequest, fmt.Errorf("%s streams its response; use POST /v1/servers/{id}/rpc", msg.Method))
+		return
+	}
+
+	select {
+	case client.rpcSlots <- struct{}{}:
+	default:
+		fail(http.StatusTooManyRequests, fmt.Errorf("at most %d rpc calls may be in flight per connection", maxClientRPCInFlight))
+		return
+	}
+
+	go func() {
+		defer func() { <-client.rpcSlots }()
+
+		user, err := a.currentSessionUser(ctx)
+		if err != nil {
+			if !errors.Is(err, errSessionEnded) {
+				a.Logger.Error("internal error", slog.Any("err", err))
+				fail(http.StatusInternalServerError, errors.New("internal server error"))
+				return
+			}
+			fail(http.StatusUnauthorized, err)
+			_ = client.conn.Close(websocket.StatusPolicyViolation, "session ended")
+			return
+		}
+
+		if err := a.checkMethodAllowed(ctx, serverID, msg.Method); err != nil {
+			if !errors.Is(err, errMethodNotAllowed) {
+				a.Logger.Error("internal error", slog.Any("err", err))
+				fail(http.StatusInternalServerError, errors.New("internal server error"))
+				return
+			}
+			a.recordAudit(ctx, user.ID, serverID, msg.Method, msg.Params, "error", err)
+			fail(http.StatusForbidden, err)
+			return
+		}
+		if minRole := roleForMethod(msg.Method); !user.Role.Meets(minRole) {
+			a.recordAudit(ctx, user.ID, serverID, msg.Method, msg.Params, "error", errors.New("rbac denied"))
+			fail(http.StatusForbidden, fmt.Errorf("%s requires role %s", msg.Method, minRole))
+			return
+		}
+		if a.needsSudo(msg.Method) && !time.Now().Before(user.sudoUntil) {
+			a.recordAudit(ctx, user.ID, serverID, msg.Method, msg.Params, "error", errors.New("sudo required"))
+			fail(http.StatusForbidden, errors.New("sudo_required"))
+			return
+		}
+		suspended, err := a.serverSuspended(ctx, serverID)
+		if err != nil {
+			a.Logger.Error("internal error", slog.Any("err", err))
+			fail(http.StatusInternalServerError, errors.New("internal server error"))
+			return
+		}
+		if suspended {
+			fail(http.StatusLocked, errors.New("server suspended"))
+			return
+		}
+
+		agent := a.Hub.AgentFor(serverID)
+		if agent == nil && !a.Hub.RemoteAgent(ctx, serverID) {
+			a.recordAudit(ctx, user.ID, serverID, msg.Method, msg.Params, "error", errors.New("agent disconnected"))
+			fail(http.StatusServiceUnavailable, errors.New("agent not connected"))
+			return
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, a.serverRPCTimeout(ctx, serverID))
+		defer cancel()
+		req := JSONRPC{Method: msg.Method, Params: msg.Params}
+		started := time.Now()
+		resp, attempts, err := a.callAgent(callCtx, serverID, agent, req)
+		a.logCallLatency(serverID, user.ID, req, time.Since(started))
+		if err != nil {
+			a.recordCallAudit(ctx, "", user.ID, serverID, msg.Method, msg.Params, "error", err, attempts)
+			fail(callErrorStatus(err), err)
+			return
+		}
+		status, httpStatus := "ok", http.StatusOK
+		if rpcErr := decodeJSONRPCError(resp); rpcErr != nil {
+			status, httpStatus, err = "error", http.StatusUnprocessableEntity, rpcErr
+		}
+		a.recordCallAudit(ctx, "", user.ID, serverID, msg.Method, msg.Params, status, err, attempts)
+		reply(clientRPCResult{Status: httpStatus, Response: resp})
+	}()
+}
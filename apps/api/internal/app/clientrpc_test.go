@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestServerEventsUnknownServer checks that unknown and suspended servers
+// are refused before the upgrade and before any client slot is taken.
+func TestServerEventsUnknownServer(t *testing.T) {
+	const id = "7d3b8f6e-2c1a-4b5e-9f0d-3a6c8e1b2d4f"
+	tests := []struct {
+		name    string
+		id      string
+		results map[string][][]any
+		want    int
+	}{
+		{"not a uuid", "not-a-uuid", nil, http.StatusNotFound},
+		{"numeric", "42", nil, http.StatusNotFound},
+		{"well-formed unknown id", id, map[string][][]any{"SELECT EXISTS": {{false}}}, http.StatusNotFound},
+		{"suspended", id, map[string][][]any{"SELECT EXISTS": {{true}}, "SELECT suspended": {{true}}}, http.StatusLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testApp(t, tt.results)
+			rec := httptest.NewRecorder()
+			a.handleServerEvents(rec, serverRequest(t, http.MethodGet, tt.id, "", &AuthUser{ID: "u1", Role: RoleViewer}))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := a.Hub.ClientStats().Connected; got != 0 {
+				t.Fatalf("client slots held = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestCurrentSessionUserWithoutSession(t *testing.T) {
+	a := NewApp(nil, Config{}, testLogger())
+	ctx := context.WithValue(context.Background(), contextKeyUser, &AuthUser{ID: "u1", Role: RoleOwner})
+	if _, err := a.currentSessionUser(ctx); !errors.Is(err, errSessionEnded) {
+		t.Fatalf("err = %v, want errSessionEnded", err)
+	}
+}
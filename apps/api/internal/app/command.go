@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	commandMethod = "minecraft:server/command"
+	maxCommandLen = 1000
+)
+
+// errCommandViaRPC keeps raw commands off the generic RPC endpoints so the
+// command endpoint's role, per-server switch, and schema checks always apply.
+var errCommandViaRPC = errors.New("use POST /v1/servers/{id}/command to run console commands")
+
+type commandRequest struct {
+	Command string `json:"command"`
+}
+
+type commandParams struct {
+	Command string `json:"command"`
+}
+
+type commandResponse struct {
+	// Output is the command's text output when the server returns one,
+	// either as a bare string result or as result.output.
+	Output *string         `json:"output,omitempty"`
+	Result json.RawMessage `json:"result"`
+}
+
+// normalizeCommand strips a leading slash and rejects control characters,
+// so one request cannot smuggle a second command on another line.
+func normalizeCommand(raw string) (string, error) {
+	cmd := strings.TrimPrefix(strings.TrimSpace(raw), "/")
+	if cmd == "" {
+		return "", errors.New("command required")
+	}
+	if len(cmd) > maxCommandLen {
+		return "", fmt.Errorf("command exceeds %d characters", maxCommandLen)
+	}
+	if strings.IndexFunc(cmd, unicode.IsControl) >= 0 {
+		return "", errors.New("command must not contain control characters")
+	}
+	return cmd, nil
+}
+
+func commandOutput(result json.RawMessage) *string {
+	var text string
+	if err := json.Unmarshal(result, &text); err == nil {
+		return &text
+	}
+	var obj struct {
+		Output *string `json:"output"`
+	}
+	if err := json.Unmarshal(result, &obj); err == nil {
+		return obj.Output
+	}
+	return nil
+}
+
+// handleServerCommand runs a raw console command. The route requires
+// COMMAND_MIN_ROLE; the server must also have commands_enabled and a schema
+// that advertises the command method. Every command that passes those
+// checks is audited, even when the agent is not connected.
+func (a *App) handleServerCommand(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req commandRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	command, err := normalizeCommand(req.Command)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		enabled   bool
+		suspended bool
+		schema    json.RawMessage
+	)
+	queryCtx, cancelQuery := a.queryContext(r.Context())
+	err = a.DB.QueryRow(queryCtx, `SELECT commands_enabled, suspended, schema_json FROM servers WHERE id=$1`, serverID).Scan(&enabled, &suspended, &schema)
+	cancelQuery()
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	if suspended {
+		http.Error(w, "server suspended", http.StatusLocked)
+		return
+	}
+	if !enabled {
+		http.Error(w, "commands are disabled for this server", http.StatusForbidden)
+		return
+	}
+	if schema, err = a.cipher.open(schema, aadServerSchema); err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if !schemaAdvertises(schema, commandMethod) {
+		http.Error(w, fmt.Sprintf("server does not advertise %s in its discovered schema", commandMethod), http.StatusNotImplemented)
+		return
+	}
+
+	params, err := json.Marshal(commandParams{Command: command})
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	// A nil agent with a remote owner is reached through the hub relay.
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		a.recordAudit(r.Context(), user.ID, serverID, commandMethod, params, "error", errAgentDisconnected)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.serverRPCTimeout(r.Context(), serverID))
+	defer cancel()
+
+	resp, err := a.Hub.call(ctx, serverID, agent, JSONRPC{Method: commandMethod, Params: params})
+	if err == nil {
+		err = decodeJSONRPCError(resp)
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	// Stored under AUDIT_REDACT_KEYS / AUDIT_REDACT_PATHS like any RPC, so
+	// operators can mask the command text if they must.
+	a.recordAudit(r.Context(), user.ID, serverID, commandMethod, params, status, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var env struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &env); err != nil {
+		http.Error(w, fmt.Sprintf("decode response: %v", err), http.StatusBadGateway)
+		return
+	}
+	a.writeJSON(w, commandResponse{Output: commandOutput(env.Result), Result: env.Result})
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// connectivityWebhookTimeout bounds each webhook delivery, including the
+// server name lookup.
+const connectivityWebhookTimeout = 10 * time.Second
+
+// connectivityEvent is logged, and posted to CONNECTIVITY_ALERT_WEBHOOK_URL, once a
+// server's agent has stayed connected or disconnected for the debounce
+// window.
+type connectivityEvent struct {
+	Event       string    `json:"event"`
+	ServerID    string    `json:"server_id"`
+	ServerName  string    `json:"server_name,omitempty"`
+	Since       time.Time `json:"since"`
+	StableForMs int64     `json:"stable_for_ms"`
+}
+
+type connectivityStats struct {
+	OfflineAlerts uint64 `json:"offline_alerts_total"`
+	OnlineAlerts  uint64 `json:"online_alerts_total"`
+	WebhookErrors uint64 `json:"webhook_errors_total"`
+}
+
+// serverConnectivity tracks one server. reported is the state last alerted
+// on; since is when connected last changed.
+type serverConnectivity struct {
+	connected bool
+	reported  bool
+	since     time.Time
+	timer     *time.Timer
+}
+
+// connectivityNotifier turns agent connects and disconnects into debounced
+// online/offline alerts. A server that flaps within the window produces no
+// alert unless it settles in a state other than the one last reported.
+type connectivityNotifier struct {
+	hub      *Hub
+	debounce time.Duration
+	webhook  string
+	client   *http.Client
+	mu       sync.Mutex
+	servers  map[string]*serverConnectivity
+	stats    connectivityStats
+}
+
+func newConnectivityNotifier(hub *Hub, debounce time.Duration, webhook string) *connectivityNotifier {
+	return &connectivityNotifier{
+		hub:      hub,
+		debounce: max(debounce, 0),
+		webhook:  webhook,
+		client:   &http.Client{Timeout: connectivityWebhookTimeout},
+		servers:  make(map[string]*serverConnectivity),
+	}
+}
+
+// observe records a connect or disconnect and (re)starts the server's
+// debounce timer.
+func (n *connectivityNotifier) observe(serverID string, connected bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	st, ok := n.servers[serverID]
+	if !ok {
+		// An agent always connects before it can disconnect, so a server
+		// starts out reported online and its first connect alerts nobody.
+		st = &serverConnectivity{connected: true, reported: true, since: time.Now()}
+		n.servers[serverID] = st
+	}
+	if st.connected != connected {
+		st.connected = connected
+		st.since = time.Now()
+	}
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	if st.connected != st.reported {
+		st.timer = time.AfterFunc(n.debounce, func() { n.settle(serverID) })
+	}
+}
+
+// settle runs once a server's state has held for the debounce window.
+func (n *connectivityNotifier) settle(serverID string) {
+	n.mu.Lock()
+	st := n.servers[serverID]
+	if st == nil || st.connected == st.reported || time.Since(st.since) < n.debounce {
+		n.mu.Unlock()
+		return
+	}
+	st.reported = st.connected
+	event := connectivityEvent{
+		Event:       "server_offline",
+		ServerID:    serverID,
+		Since:       st.since.UTC(),
+		StableForMs: time.Since(st.since).Milliseconds(),
+	}
+	if st.connected {
+		event.Event = "server_online"
+		n.stats.OnlineAlerts++
+	} else {
+		n.stats.OfflineAlerts++
+	}
+	n.mu.Unlock()
+
+	logger := n.hub.logger.With(slog.String("server_id", serverID), slog.Time("since", event.Since))
+	if event.Event == "server_offline" {
+		logger.Warn("server agent offline")
+	} else {
+		logger.Info("server agent back online")
+	}
+	if n.webhook != "" {
+		go n.deliver(event)
+	}
+}
+
+func (n *connectivityNotifier) deliver(event connectivityEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), connectivityWebhookTimeout)
+	defer cancel()
+
+	dbCtx, cancelQuery := withQueryTimeout(ctx, n.hub.cfg.QueryTimeout)
+	_ = n.hub.db.QueryRow(dbCtx, `SELECT name FROM servers WHERE id = $1`, event.ServerID).Scan(&event.ServerName)
+	cancelQuery()
+
+	if err := n.post(ctx, event); err != nil {
+		n.mu.Lock()
+		n.stats.WebhookErrors++
+		n.mu.Unlock()
+		n.hub.logger.Error("connectivity webhook failed", slog.String("server_id", event.ServerID), slog.String("event", event.Event), slog.Any("err", err))
+	}
+}
+
+func (n *connectivityNotifier) post(ctx context.Context, event connectivityEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhook, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *connectivityNotifier) snapshot() connectivityStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
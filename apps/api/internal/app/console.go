@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	consoleMethod             = "minecraft:server/console"
+	consoleNotificationMethod = "minecraft:notification/server/console"
+	defaultConsoleLines       = 100
+	maxConsoleLines           = 1000
+)
+
+type consoleResponse struct {
+	Lines []string `json:"lines"`
+}
+
+// schemaMethod is the part of an OpenRPC method object the API reads.
+type schemaMethod struct {
+	Name string `json:"name"`
+}
+
+// schemaAdvertises reports whether an rpc.discover document lists method.
+func schemaAdvertises(schema json.RawMessage, method string) bool {
+	var doc struct {
+		Methods []schemaMethod `json:"methods"`
+	}
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		return false
+	}
+	for _, m := range doc.Methods {
+		if m.Name == method {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSchemaMethods returns schema with only the methods keep accepts.
+// Other members of the document, and of each kept method, pass through
+// untouched.
+func filterSchemaMethods(schema json.RawMessage, keep func(method string) bool) (json.RawMessage, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		return nil, err
+	}
+	var methods []json.RawMessage
+	if raw, ok := doc["methods"]; ok {
+		if err := json.Unmarshal(raw, &methods); err != nil {
+			return nil, err
+		}
+	}
+	kept := make([]json.RawMessage, 0, len(methods))
+	for _, raw := range methods {
+		var m schemaMethod
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, err
+		}
+		if keep(m.Name) {
+			kept = append(kept, raw)
+		}
+	}
+	filtered, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	doc["methods"] = filtered
+	return json.Marshal(doc)
+}
+
+func (a *App) handleServerConsole(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lines := defaultConsoleLines
+	if raw := r.URL.Query().Get("lines"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxConsoleLines {
+			http.Error(w, fmt.Sprintf("lines must be between 1 and %d", maxConsoleLines), http.StatusBadRequest)
+			return
+		}
+		lines = n
+	}
+
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+
+	var schema json.RawMessage
+	queryCtx, cancelQuery := a.queryContext(r.Context())
+	err := a.DB.QueryRow(queryCtx, `SELECT schema_json FROM servers WHERE id=$1`, serverID).Scan(&schema)
+	cancelQuery()
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	if schema, err = a.cipher.open(schema, aadServerSchema); err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if !schemaAdvertises(schema, consoleMethod) {
+		http.Error(w, fmt.Sprintf("server does not advertise %s in its discovered schema", consoleMethod), http.StatusNotImplemented)
+		return
+	}
+
+	// A nil agent with a remote owner is reached through the hub relay.
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	params, err := json.Marshal(map[string]int{"lines": lines})
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.serverRPCTimeout(r.Context(), serverID))
+	defer cancel()
+
+	resp, err := a.Hub.call(ctx, serverID, agent, JSONRPC{Method: consoleMethod, Params: params})
+	if err == nil {
+		err = decodeJSONRPCError(resp)
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	a.recordAudit(r.Context(), user.ID, serverID, consoleMethod, params, status, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var env struct {
+		Result consoleResponse `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &env); err != nil {
+		http.Error(w, fmt.Sprintf("decode response: %v", err), http.StatusBadGateway)
+		return
+	}
+	if env.Result.Lines == nil {
+		env.Result.Lines = []string{}
+	}
+	a.writeJSON(w, env.Result)
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB answers queries with canned rows, picked by the fragment of
+// results that the query's SQL contains. Fragments should not overlap. A
+// query matching none fails the test, as does starting a transaction.
+type fakeDB struct {
+	t       *testing.T
+	results map[string][][]any
+}
+
+func (f *fakeDB) rowsFor(sql string) [][]any {
+	f.t.Helper()
+	for fragment, rows := range f.results {
+		if strings.Contains(sql, fragment) {
+			return rows
+		}
+	}
+	f.t.Errorf("unexpected query: %s", sql)
+	return nil
+}
+
+func (f *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	f.t.Error("unexpected transaction")
+	return nil, errors.New("transactions are not supported")
+}
+
+func (f *fakeDB) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	f.rowsFor(sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (f *fakeDB) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	return &fakeRows{rows: f.rowsFor(sql)}, nil
+}
+
+func (f *fakeDB) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	rows := f.rowsFor(sql)
+	if len(rows) == 0 {
+		return fakeRow{err: pgx.ErrNoRows}
+	}
+	return fakeRow{values: rows[0]}
+}
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanFake(r.values, dest)
+}
+
+type fakeRows struct {
+	rows [][]any
+	next int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *fakeRows) Next() bool {
+	if r.next >= len(r.rows) {
+		return false
+	}
+	r.next++
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	return scanFake(r.rows[r.next-1], dest)
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	return r.rows[r.next-1], nil
+}
+
+// scanFake assigns values to dest by type; a nil value zeroes its target.
+func scanFake(values, dest []any) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("scanning %d values into %d targets", len(values), len(dest))
+	}
+	for i, d := range dest {
+		target := reflect.ValueOf(d).Elem()
+		if values[i] == nil {
+			target.SetZero()
+			continue
+		}
+		target.Set(reflect.ValueOf(values[i]))
+	}
+	return nil
+}
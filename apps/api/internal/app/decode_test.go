@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"known fields", `{"email":"a@example.com","password":"pw"}`, ""},
+		{"misspelled field", `{"email":"a@example.com","pasword":"pw"}`, `unknown field "pasword"`},
+		{"malformed", `{"email":`, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			var v bootstrapRequest
+			err := decodeJSONBody(req, &v)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestHandlersRejectUnknownFields sends a misspelled field to handlers that
+// decode before touching the database and expects a 400 naming it.
+func TestHandlersRejectUnknownFields(t *testing.T) {
+	a := NewApp(nil, Config{}, testLogger())
+	owner := &AuthUser{ID: "u1", Role: RoleOwner}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		field   string
+	}{
+		{"login", a.handleLogin, `{"emial":"a@example.com","password":"pw"}`, "emial"},
+		{"bootstrap", a.handleBootstrap, `{"email":"a@example.com","passwd":"pw"}`, "passwd"},
+		{"create server", a.handleCreateServer, `{"name":"survival","descriptoin":"x"}`, "descriptoin"},
+		{"create api key", a.handleCreateAPIKey, `{"name":"ci","scope":"all"}`, "scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, owner))
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), `unknown field "`+tt.field+`"`) {
+				t.Fatalf("body %q does not name %q", rec.Body.String(), tt.field)
+			}
+		})
+	}
+}
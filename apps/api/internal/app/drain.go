@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	actionAgentsDrain = "conduit:agents/drain"
+	// agentFeatureDrain is advertised by agents that understand the drain
+	// control frame; older agents never receive one.
+	agentFeatureDrain = "drain"
+	defaultDrainDelay = 5 * time.Second
+	maxDrainDelay     = 30 * time.Second
+)
+
+// parseAgentFeatures reads the comma-separated X-Conduit-Agent-Features
+// header an agent sends when it connects.
+func parseAgentFeatures(raw string) map[string]bool {
+	features := make(map[string]bool)
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(strings.ToLower(f)); f != "" {
+			features[f] = true
+		}
+	}
+	return features
+}
+
+type drainRequest struct {
+	DelayMS  *int64 `json:"delay_ms"`
+	URL      string `json:"url"`
+	ServerID string `json:"server_id"`
+}
+
+type drainControl struct {
+	Control string `json:"_control"`
+	DelayMS int64  `json:"delay_ms"`
+	URL     string `json:"url,omitempty"`
+}
+
+type drainResponse struct {
+	Drained []string `json:"drained"`
+	// Unsupported lists connected agents too old to drain; they keep their
+	// sessions until they are disconnected.
+	Unsupported []string `json:"unsupported"`
+	Failed      []string `json:"failed"`
+}
+
+// DrainAgents tells connected agents to close their session after delay and
+// dial again, to target when it is set. serverID limits it to one agent.
+func (h *Hub) DrainAgents(ctx context.Context, serverID string, delay time.Duration, target string) (drainResponse, error) {
+	payload, err := json.Marshal(drainControl{Control: "drain", DelayMS: delay.Milliseconds(), URL: target})
+	if err != nil {
+		return drainResponse{}, err
+	}
+
+	h.mu.RLock()
+	agents := make([]*AgentConn, 0, len(h.agents))
+	for id, agent := range h.agents {
+		if serverID == "" || id == serverID {
+			agents = append(agents, agent)
+		}
+	}
+	h.mu.RUnlock()
+
+	resp := drainResponse{Drained: []string{}, Unsupported: []string{}, Failed: []string{}}
+	for _, agent := range agents {
+		if !agent.features[agentFeatureDrain] {
+			resp.Unsupported = append(resp.Unsupported, agent.serverID)
+			continue
+		}
+		if err := agent.write(ctx, payload); err != nil {
+			h.logger.Warn("agent drain failed", slog.String("server_id", agent.serverID), slog.Any("err", err))
+			resp.Failed = append(resp.Failed, agent.serverID)
+			continue
+		}
+		resp.Drained = append(resp.Drained, agent.serverID)
+	}
+	h.logger.Info("agents drained", slog.Int("drained", len(resp.Drained)), slog.Int("unsupported", len(resp.Unsupported)), slog.Int("failed", len(resp.Failed)), slog.Duration("delay", delay), slog.String("url", target))
+	return resp, nil
+}
+
+// handleDrainAgents asks agents to reconnect, for moving them to a new API
+// deployment ahead of shutting the old one down.
+func (a *App) handleDrainAgents(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req drainRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delay := defaultDrainDelay
+	if req.DelayMS != nil {
+		delay = time.Duration(*req.DelayMS) * time.Millisecond
+		if delay < 0 || delay > maxDrainDelay {
+			http.Error(w, fmt.Sprintf("delay_ms must be between 0 and %d", maxDrainDelay.Milliseconds()), http.StatusBadRequest)
+			return
+		}
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL != "" {
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			http.Error(w, "url must be a ws:// or wss:// URL", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ServerID != "" && !a.requireServer(w, r, req.ServerID) {
+		return
+	}
+
+	resp, err := a.Hub.DrainAgents(r.Context(), req.ServerID, delay, req.URL)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	params, _ := json.Marshal(req)
+	a.recordAudit(r.Context(), user.ID, req.ServerID, actionAgentsDrain, params, "ok", nil)
+	a.writeJSON(w, resp)
+}
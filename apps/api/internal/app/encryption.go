@@ -0,0 +1,121 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Encrypted columns hold a JSON string of the form "enc:<key id>:<base64>",
+// so they stay valid JSONB and plaintext rows written before a key was
+// configured remain readable.
+const encryptedValuePrefix = "enc:"
+
+const (
+	aadServerSchema = "servers.schema_json"
+	aadAuditParams  = "audit_logs.params_json"
+)
+
+// DataCipher encrypts designated JSONB columns with AES-256-GCM. The first
+// key is used for writes; every key can decrypt, which allows rotation by
+// prepending a new key and keeping the old one until rows are rewritten.
+// A nil *DataCipher passes values through unchanged.
+type DataCipher struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// ParseDataKeys parses "id:base64key[,id:base64key...]". Keys must decode to
+// 32 bytes. An empty string returns a nil cipher.
+func ParseDataKeys(raw string) (*DataCipher, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	dc := &DataCipher{keys: make(map[string]cipher.AEAD)}
+	for _, part := range strings.Split(raw, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, errors.New("DATA_ENCRYPTION_KEY entries must be id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("DATA_ENCRYPTION_KEY %q: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("DATA_ENCRYPTION_KEY %q must be 32 bytes, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := dc.keys[id]; dup {
+			return nil, fmt.Errorf("duplicate DATA_ENCRYPTION_KEY id %q", id)
+		}
+		dc.keys[id] = aead
+		if dc.activeID == "" {
+			dc.activeID = id
+		}
+	}
+	return dc, nil
+}
+
+// seal encrypts value with the active key. aad names the column so a
+// ciphertext cannot be replayed into another one.
+func (dc *DataCipher) seal(value json.RawMessage, aad string) (json.RawMessage, error) {
+	if dc == nil || value == nil {
+		return value, nil
+	}
+	aead := dc.keys[dc.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, value, []byte(aad))
+	return json.Marshal(encryptedValuePrefix + dc.activeID + ":" + base64.StdEncoding.EncodeToString(sealed))
+}
+
+// open reverses seal. Values that are not in the encrypted form are
+// returned as-is.
+func (dc *DataCipher) open(value json.RawMessage, aad string) (json.RawMessage, error) {
+	if len(value) == 0 || value[0] != '"' {
+		return value, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil || !strings.HasPrefix(s, encryptedValuePrefix) {
+		return value, nil
+	}
+	if dc == nil {
+		return nil, errors.New("encrypted value found but DATA_ENCRYPTION_KEY is not configured")
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(s, encryptedValuePrefix), ":")
+	if !ok {
+		return nil, errors.New("malformed encrypted value")
+	}
+	aead, ok := dc.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key id %q", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt value: %w", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const actionEventFilter = "conduit:event-filter"
+
+// eventFilter is an owner-set policy on which agent notifications a server's
+// event clients receive. Entries are method prefixes. A notification is
+// dropped when it matches Deny, or when Allow is non-empty and it matches
+// none of Allow. API events such as snapshots and announcements always pass.
+type eventFilter struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+type eventFilterResponse struct {
+	ServerID string `json:"server_id"`
+	eventFilter
+}
+
+func (f eventFilter) empty() bool {
+	return len(f.Allow) == 0 && len(f.Deny) == 0
+}
+
+// passes reports whether a notification for method is fanned out.
+func (f eventFilter) passes(method string) bool {
+	for _, prefix := range f.Deny {
+		if strings.HasPrefix(method, prefix) {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, prefix := range f.Allow {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEventFilter trims, validates, de-duplicates, and sorts both lists.
+func normalizeEventFilter(f eventFilter) (eventFilter, error) {
+	normalize := func(name string, prefixes []string) ([]string, error) {
+		if len(prefixes) > maxAllowlistEntries {
+			return nil, fmt.Errorf("%s: at most %d prefixes allowed", name, maxAllowlistEntries)
+		}
+		out := make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			prefix = strings.TrimSpace(prefix)
+			if prefix == "" {
+				return nil, fmt.Errorf("%s: prefixes must not be empty", name)
+			}
+			if len(prefix) > maxAllowlistPattern {
+				return nil, fmt.Errorf("%s: prefix %q is longer than %d characters", name, prefix, maxAllowlistPattern)
+			}
+			out = append(out, prefix)
+		}
+		slices.Sort(out)
+		return slices.Compact(out), nil
+	}
+	allow, err := normalize("allow", f.Allow)
+	if err != nil {
+		return eventFilter{}, err
+	}
+	deny, err := normalize("deny", f.Deny)
+	if err != nil {
+		return eventFilter{}, err
+	}
+	return eventFilter{Allow: allow, Deny: deny}, nil
+}
+
+// setEventFilter replaces the filter broadcast applies for serverID. It takes
+// effect for the next notification; connected clients stay connected.
+func (h *Hub) setEventFilter(serverID string, f eventFilter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if f.empty() {
+		delete(h.eventFilters, serverID)
+		return
+	}
+	h.eventFilters[serverID] = f
+}
+
+// loadEventFilter reads serverID's stored filter.
+func (h *Hub) loadEventFilter(ctx context.Context, serverID string) (eventFilter, error) {
+	ctx, cancel := withQueryTimeout(ctx, h.cfg.QueryTimeout)
+	defer cancel()
+	var f eventFilter
+	err := h.db.QueryRow(ctx, `SELECT event_filter_allow, event_filter_deny FROM servers WHERE id = $1`, serverID).Scan(&f.Allow, &f.Deny)
+	return f, err
+}
+
+// refreshEventFilter reloads serverID's filter into the cache. It runs when
+// the server's agent connects, so an instance that missed an update made
+// through another API instance catches up on the next reconnect.
+func (h *Hub) refreshEventFilter(ctx context.Context, serverID string) {
+	f, err := h.loadEventFilter(ctx, serverID)
+	if err != nil {
+		h.logger.Error("failed to load event filter", slog.String("server_id", serverID), slog.Any("err", err))
+		return
+	}
+	h.setEventFilter(serverID, f)
+}
+
+func (a *App) handleGetEventFilter(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+	f, err := a.Hub.loadEventFilter(r.Context(), serverID)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if f.Allow == nil {
+		f.Allow = []string{}
+	}
+	if f.Deny == nil {
+		f.Deny = []string{}
+	}
+	a.writeJSON(w, eventFilterResponse{ServerID: serverID, eventFilter: f})
+}
+
+// handlePutEventFilter stores a server's broadcast filter and applies it to
+// the live hub at once.
+func (a *App) handlePutEventFilter(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+
+	var req eventFilter
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := normalizeEventFilter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	tag, err := a.DB.Exec(ctx, `UPDATE servers SET event_filter_allow = $2, event_filter_deny = $3 WHERE id = $1`, serverID, f.Allow, f.Deny)
+	cancel()
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	a.Hub.setEventFilter(serverID, f)
+
+	params, _ := json.Marshal(f)
+	a.recordAudit(r.Context(), user.ID, serverID, actionEventFilter, params, "ok", nil)
+	a.writeJSON(w, eventFilterResponse{ServerID: serverID, eventFilter: f})
+}
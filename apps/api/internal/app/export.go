@@ -0,0 +1,282 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	actionServerExport = "conduit:server/export"
+	actionServerImport = "conduit:server/import"
+
+	// serverBundleFormat and serverBundleVersion identify export documents.
+	// Bump the version when a field changes meaning; adding optional fields
+	// does not need a bump.
+	serverBundleFormat  = "conduit.server"
+	serverBundleVersion = 1
+)
+
+// serverBundle is a server's configuration for backup or migration. It never
+// carries the agent token; importing issues a new one.
+type serverBundle struct {
+	Format       string          `json:"format"`
+	Version      int             `json:"version"`
+	ExportedAt   time.Time       `json:"exported_at"`
+	Server       bundledServer   `json:"server"`
+	RPCAllowlist []string        `json:"rpc_allowlist"`
+	Groups       []string        `json:"groups"`
+	Schema       json.RawMessage `json:"schema"`
+}
+
+type bundledServer struct {
+	Name        string   `json:"name"`
+	Description *string  `json:"description,omitempty"`
+	Tags        []string `json:"tags"`
+	Suspended   bool     `json:"suspended"`
+	RPCTimeout  *int     `json:"default_rpc_timeout_ms,omitempty"`
+	Commands    bool     `json:"commands_enabled"`
+	// EventFilter is omitted when the server has none.
+	EventFilter *eventFilter `json:"event_filter,omitempty"`
+}
+
+type importServerResponse struct {
+	createServerResponse
+	// MissingGroups lists bundle groups with no group of that name here;
+	// the server was not added to them.
+	MissingGroups []string `json:"missing_groups"`
+}
+
+func (a *App) handleExportServer(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := uuid.Parse(serverID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	bundle, err := a.exportServer(r.Context(), serverID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	a.recordAudit(r.Context(), user.ID, serverID, actionServerExport, nil, "ok", nil)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="server-%s.json"`, serverID))
+	a.writeJSON(w, bundle)
+}
+
+func (a *App) exportServer(ctx context.Context, serverID string) (serverBundle, error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+
+	bundle := serverBundle{
+		Format:     serverBundleFormat,
+		Version:    serverBundleVersion,
+		ExportedAt: time.Now().UTC(),
+	}
+	s := &bundle.Server
+	var filter eventFilter
+	err := a.DB.QueryRow(ctx, `SELECT name, description, tags, suspended, default_rpc_timeout_ms, commands_enabled, event_filter_allow, event_filter_deny, schema_json FROM servers WHERE id = $1`, serverID).
+		Scan(&s.Name, &s.Description, &s.Tags, &s.Suspended, &s.RPCTimeout, &s.Commands, &filter.Allow, &filter.Deny, &bundle.Schema)
+	if err != nil {
+		return serverBundle{}, err
+	}
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	if !filter.empty() {
+		s.EventFilter = &filter
+	}
+	if bundle.Schema, err = a.cipher.open(bundle.Schema, aadServerSchema); err != nil {
+		return serverBundle{}, err
+	}
+	if bundle.Schema == nil {
+		bundle.Schema = json.RawMessage("null")
+	}
+
+	rows, err := a.DB.Query(ctx, `SELECT pattern FROM rpc_method_allowlist WHERE server_id = $1 ORDER BY pattern`, serverID)
+	if err != nil {
+		return serverBundle{}, err
+	}
+	if bundle.RPCAllowlist, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		return serverBundle{}, err
+	}
+	rows, err = a.DB.Query(ctx, `SELECT g.name FROM server_groups g JOIN server_group_members m ON m.group_id = g.id WHERE m.server_id = $1 ORDER BY g.name`, serverID)
+	if err != nil {
+		return serverBundle{}, err
+	}
+	if bundle.Groups, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		return serverBundle{}, err
+	}
+	if bundle.RPCAllowlist == nil {
+		bundle.RPCAllowlist = []string{}
+	}
+	if bundle.Groups == nil {
+		bundle.Groups = []string{}
+	}
+	return bundle, nil
+}
+
+// validateBundle checks the envelope and normalizes the fields import uses.
+func validateBundle(b *serverBundle) error {
+	if b.Format != serverBundleFormat {
+		return fmt.Errorf("format must be %q", serverBundleFormat)
+	}
+	if b.Version != serverBundleVersion {
+		return fmt.Errorf("unsupported bundle version %d; this API reads version %d", b.Version, serverBundleVersion)
+	}
+	b.Server.Name = strings.TrimSpace(b.Server.Name)
+	if b.Server.Name == "" {
+		return errors.New("server.name required")
+	}
+	if b.Server.RPCTimeout != nil && *b.Server.RPCTimeout <= 0 {
+		return errors.New("server.default_rpc_timeout_ms must be positive")
+	}
+	b.Server.Tags = normalizeTags(b.Server.Tags)
+	if b.Server.EventFilter != nil {
+		filter, err := normalizeEventFilter(*b.Server.EventFilter)
+		if err != nil {
+			return fmt.Errorf("server.event_filter: %w", err)
+		}
+		b.Server.EventFilter = &filter
+	}
+	methods, err := normalizeAllowlist(b.RPCAllowlist)
+	if err != nil {
+		return fmt.Errorf("rpc_allowlist: %w", err)
+	}
+	b.RPCAllowlist = methods
+	groups := make([]string, 0, len(b.Groups))
+	for _, g := range b.Groups {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	slices.Sort(groups)
+	b.Groups = slices.Compact(groups)
+	return nil
+}
+
+// handleImportServer recreates a server from an export bundle under a new id
+// and agent token. The schema is restored so the UI has it before the agent
+// first connects; the agent replaces it on discovery.
+func (a *App) handleImportServer(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var bundle serverBundle
+	if err := decodeJSONBody(r, &bundle); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateBundle(&bundle); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var schema json.RawMessage
+	var schemaSum *string
+	if len(bundle.Schema) > 0 && string(bundle.Schema) != "null" {
+		digest := schemaDigest(bundle.Schema)
+		schemaSum = &digest
+		sealed, err := a.cipher.seal(bundle.Schema, aadServerSchema)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		schema = sealed
+	}
+
+	agentToken, err := generateAgentToken()
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	s := bundle.Server
+	filter := eventFilter{Allow: []string{}, Deny: []string{}}
+	if s.EventFilter != nil {
+		filter = *s.EventFilter
+	}
+	id := uuid.NewString()
+	now := time.Now()
+	missing := []string{}
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	err = pgx.BeginFunc(ctx, a.DB, func(tx pgx.Tx) error {
+		if err := a.checkServerQuota(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO servers (id, name, description, tags, suspended, default_rpc_timeout_ms, commands_enabled, event_filter_allow, event_filter_deny, agent_token_hash, schema_json, schema_sha256, owner_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+			id, s.Name, s.Description, s.Tags, s.Suspended, s.RPCTimeout, s.Commands, filter.Allow, filter.Deny, hashToken(agentToken), schema, schemaSum, user.ID, now); err != nil {
+			return err
+		}
+		if len(bundle.RPCAllowlist) > 0 {
+			if _, err := tx.Exec(ctx, `INSERT INTO rpc_method_allowlist (server_id, pattern) SELECT $1, unnest($2::text[])`, id, bundle.RPCAllowlist); err != nil {
+				return err
+			}
+		}
+		if len(bundle.Groups) == 0 {
+			return nil
+		}
+		rows, err := tx.Query(ctx, `WITH ins AS (
+			INSERT INTO server_group_members (group_id, server_id)
+			SELECT id, $1 FROM server_groups WHERE name = ANY($2)
+			ON CONFLICT DO NOTHING
+		)
+		SELECT n FROM unnest($2::text[]) AS n
+		WHERE NOT EXISTS (SELECT 1 FROM server_groups g WHERE g.name = n)
+		ORDER BY n`, id, bundle.Groups)
+		if err != nil {
+			return err
+		}
+		names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		missing = append(missing, names...)
+		return nil
+	})
+	if err != nil {
+		if !a.rejectServerQuota(w, user.ID, err) {
+			a.internalError(w, err)
+		}
+		return
+	}
+
+	params, _ := json.Marshal(map[string]any{"name": s.Name, "version": bundle.Version, "exported_at": bundle.ExportedAt})
+	a.recordAudit(r.Context(), user.ID, id, actionServerImport, params, "ok", nil)
+
+	a.writeJSONStatus(w, http.StatusCreated, importServerResponse{
+		createServerResponse: createServerResponse{
+			ID:          id,
+			AgentToken:  agentToken,
+			Name:        s.Name,
+			Description: s.Description,
+			Tags:        s.Tags,
+			CreatedAt:   now,
+		},
+		MissingGroups: missing,
+	})
+}
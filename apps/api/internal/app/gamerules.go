@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +22,18 @@ type GameRulePreset struct {
 	Settings    map[string]any `json:"settings,omitempty"`
 }
 
+// Preset sources reported by the preset list.
+const presetSourceBuiltin = "builtin"
+
+// presetListEntry is a preset as listed to clients. Source says where it is
+// defined and Editable whether it can be changed through the API; built-in
+// presets are compiled in and never editable.
+type presetListEntry struct {
+	GameRulePreset
+	Source   string `json:"source"`
+	Editable bool   `json:"editable"`
+}
+
 type presetApplicationResult struct {
 	Type    string `json:"type"`
 	Name    string `json:"name"`
@@ -31,41 +44,141 @@ type presetApplicationResult struct {
 
 type applyPresetRequest struct {
 	Preset string `json:"preset"`
+	// Atomic stops at the first failure and reverts the keys already applied
+	// to the values read before applying. This is best-effort: the revert
+	// itself can fail and other writers may race it.
+	Atomic bool `json:"atomic"`
 }
 
 type applyPresetResponse struct {
-	Preset   GameRulePreset            `json:"preset"`
-	Results  []presetApplicationResult `json:"results"`
-	Duration int64                     `json:"duration_ms"`
+	Preset     GameRulePreset            `json:"preset"`
+	Results    []presetApplicationResult `json:"results"`
+	Atomic     bool                      `json:"atomic"`
+	RolledBack bool                      `json:"rolled_back"`
+	Rollback   []presetApplicationResult `json:"rollback,omitempty"`
+	Duration   int64                     `json:"duration_ms"`
+}
+
+type presetDiffEntry struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Current any    `json:"current"`
+	Target  any    `json:"target"`
+	Changed bool   `json:"changed"`
+}
+
+type presetDiffResponse struct {
+	Preset  GameRulePreset    `json:"preset"`
+	Entries []presetDiffEntry `json:"entries"`
+	Changed int               `json:"changed"`
+}
+
+type gameRuleValue struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+	// Type is the rule's kind as the server reports it, such as "boolean"
+	// or "integer"; omitted by servers that do not send one.
+	Type string `json:"type,omitempty"`
+}
+
+type presetStep struct {
+	Type  string
+	Name  string
+	Value any
+}
+
+// presetSteps flattens a preset into a stable order so atomic application
+// and rollback are reproducible.
+func presetSteps(preset *GameRulePreset) []presetStep {
+	steps := make([]presetStep, 0, len(preset.GameRules)+len(preset.Settings))
+	for _, name := range sortedKeys(preset.GameRules) {
+		steps = append(steps, presetStep{Type: "gamerule", Name: name, Value: preset.GameRules[name]})
+	}
+	for _, name := range sortedKeys(preset.Settings) {
+		steps = append(steps, presetStep{Type: "setting", Name: name, Value: preset.Settings[name]})
+	}
+	return steps
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
+const (
+	settingTypeBool   = "bool"
+	settingTypeInt    = "int"
+	settingTypeEnum   = "enum"
+	settingTypeString = "string"
+)
+
 type serverSettingRPC struct {
-	Method string
-	Param  string
-	Coerce func(any) (any, error)
+	Method  string
+	Param   string
+	Type    string
+	Choices []string
+	Min     *int
+	Max     *int
+}
+
+func intPtr(v int) *int { return &v }
+
+// Coerce converts a preset or request value to the setting's wire type and
+// enforces its bounds.
+func (c serverSettingRPC) Coerce(value any) (any, error) {
+	switch c.Type {
+	case settingTypeBool:
+		return coerceBoolValue(value)
+	case settingTypeEnum:
+		return coerceEnumValue(c.Choices...)(value)
+	case settingTypeInt:
+		v, err := coerceIntValue(value)
+		if err != nil {
+			return nil, err
+		}
+		n := v.(int)
+		if c.Min != nil && n < *c.Min {
+			return nil, fmt.Errorf("value %d below minimum %d", n, *c.Min)
+		}
+		if c.Max != nil && n > *c.Max {
+			return nil, fmt.Errorf("value %d above maximum %d", n, *c.Max)
+		}
+		return n, nil
+	default:
+		return coerceStringValue(value)
+	}
+}
+
+// getMethod is the read counterpart of a setting's set method.
+func (c serverSettingRPC) getMethod() string {
+	return strings.TrimSuffix(c.Method, "/set")
 }
 
 var serverSettingCommands = map[string]serverSettingRPC{
-	"difficulty":                     {Method: "minecraft:serversettings/difficulty/set", Param: "difficulty", Coerce: coerceEnumValue("peaceful", "easy", "normal", "hard")},
-	"allow_flight":                   {Method: "minecraft:serversettings/allow_flight/set", Param: "allow", Coerce: coerceBoolValue},
-	"enforce_allowlist":              {Method: "minecraft:serversettings/enforce_allowlist/set", Param: "enforce", Coerce: coerceBoolValue},
-	"use_allowlist":                  {Method: "minecraft:serversettings/use_allowlist/set", Param: "use", Coerce: coerceBoolValue},
-	"max_players":                    {Method: "minecraft:serversettings/max_players/set", Param: "max", Coerce: coerceIntValue},
-	"pause_when_empty_seconds":       {Method: "minecraft:serversettings/pause_when_empty_seconds/set", Param: "seconds", Coerce: coerceIntValue},
-	"player_idle_timeout":            {Method: "minecraft:serversettings/player_idle_timeout/set", Param: "seconds", Coerce: coerceIntValue},
-	"motd":                           {Method: "minecraft:serversettings/motd/set", Param: "message", Coerce: coerceStringValue},
-	"spawn_protection_radius":        {Method: "minecraft:serversettings/spawn_protection_radius/set", Param: "radius", Coerce: coerceIntValue},
-	"force_game_mode":                {Method: "minecraft:serversettings/force_game_mode/set", Param: "force", Coerce: coerceBoolValue},
-	"game_mode":                      {Method: "minecraft:serversettings/game_mode/set", Param: "mode", Coerce: coerceEnumValue("survival", "creative", "adventure", "spectator")},
-	"view_distance":                  {Method: "minecraft:serversettings/view_distance/set", Param: "distance", Coerce: coerceIntValue},
-	"simulation_distance":            {Method: "minecraft:serversettings/simulation_distance/set", Param: "distance", Coerce: coerceIntValue},
-	"accept_transfers":               {Method: "minecraft:serversettings/accept_transfers/set", Param: "accept", Coerce: coerceBoolValue},
-	"status_heartbeat_interval":      {Method: "minecraft:serversettings/status_heartbeat_interval/set", Param: "seconds", Coerce: coerceIntValue},
-	"operator_user_permission_level": {Method: "minecraft:serversettings/operator_user_permission_level/set", Param: "level", Coerce: coerceIntValue},
-	"hide_online_players":            {Method: "minecraft:serversettings/hide_online_players/set", Param: "hide", Coerce: coerceBoolValue},
-	"status_replies":                 {Method: "minecraft:serversettings/status_replies/set", Param: "enable", Coerce: coerceBoolValue},
-	"entity_broadcast_range":         {Method: "minecraft:serversettings/entity_broadcast_range/set", Param: "percentage_points", Coerce: coerceIntValue},
-	"autosave":                       {Method: "minecraft:serversettings/autosave/set", Param: "enable", Coerce: coerceBoolValue},
+	"difficulty":                     {Method: "minecraft:serversettings/difficulty/set", Param: "difficulty", Type: settingTypeEnum, Choices: []string{"peaceful", "easy", "normal", "hard"}},
+	"allow_flight":                   {Method: "minecraft:serversettings/allow_flight/set", Param: "allow", Type: settingTypeBool},
+	"enforce_allowlist":              {Method: "minecraft:serversettings/enforce_allowlist/set", Param: "enforce", Type: settingTypeBool},
+	"use_allowlist":                  {Method: "minecraft:serversettings/use_allowlist/set", Param: "use", Type: settingTypeBool},
+	"max_players":                    {Method: "minecraft:serversettings/max_players/set", Param: "max", Type: settingTypeInt, Min: intPtr(0)},
+	"pause_when_empty_seconds":       {Method: "minecraft:serversettings/pause_when_empty_seconds/set", Param: "seconds", Type: settingTypeInt, Min: intPtr(0)},
+	"player_idle_timeout":            {Method: "minecraft:serversettings/player_idle_timeout/set", Param: "seconds", Type: settingTypeInt, Min: intPtr(0)},
+	"motd":                           {Method: "minecraft:serversettings/motd/set", Param: "message", Type: settingTypeString},
+	"spawn_protection_radius":        {Method: "minecraft:serversettings/spawn_protection_radius/set", Param: "radius", Type: settingTypeInt, Min: intPtr(0)},
+	"force_game_mode":                {Method: "minecraft:serversettings/force_game_mode/set", Param: "force", Type: settingTypeBool},
+	"game_mode":                      {Method: "minecraft:serversettings/game_mode/set", Param: "mode", Type: settingTypeEnum, Choices: []string{"survival", "creative", "adventure", "spectator"}},
+	"view_distance":                  {Method: "minecraft:serversettings/view_distance/set", Param: "distance", Type: settingTypeInt, Min: intPtr(2), Max: intPtr(32)},
+	"simulation_distance":            {Method: "minecraft:serversettings/simulation_distance/set", Param: "distance", Type: settingTypeInt, Min: intPtr(2), Max: intPtr(32)},
+	"accept_transfers":               {Method: "minecraft:serversettings/accept_transfers/set", Param: "accept", Type: settingTypeBool},
+	"status_heartbeat_interval":      {Method: "minecraft:serversettings/status_heartbeat_interval/set", Param: "seconds", Type: settingTypeInt, Min: intPtr(0)},
+	"operator_user_permission_level": {Method: "minecraft:serversettings/operator_user_permission_level/set", Param: "level", Type: settingTypeInt, Min: intPtr(0), Max: intPtr(4)},
+	"hide_online_players":            {Method: "minecraft:serversettings/hide_online_players/set", Param: "hide", Type: settingTypeBool},
+	"status_replies":                 {Method: "minecraft:serversettings/status_replies/set", Param: "enable", Type: settingTypeBool},
+	"entity_broadcast_range":         {Method: "minecraft:serversettings/entity_broadcast_range/set", Param: "percentage_points", Type: settingTypeInt, Min: intPtr(10), Max: intPtr(1000)},
+	"autosave":                       {Method: "minecraft:serversettings/autosave/set", Param: "enable", Type: settingTypeBool},
 }
 
 var defaultPresets = []GameRulePreset{
@@ -104,8 +217,47 @@ var defaultPresets = []GameRulePreset{
 	},
 }
 
+type serverSettingCatalogEntry struct {
+	Key       string   `json:"key"`
+	Method    string   `json:"method"`
+	GetMethod string   `json:"get_method"`
+	Param     string   `json:"param"`
+	Type      string   `json:"type"`
+	Choices   []string `json:"choices,omitempty"`
+	Min       *int     `json:"min,omitempty"`
+	Max       *int     `json:"max,omitempty"`
+}
+
+func (a *App) handleServerSettingsCatalog(w http.ResponseWriter, r *http.Request) {
+	keys := make([]string, 0, len(serverSettingCommands))
+	for key := range serverSettingCommands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	catalog := make([]serverSettingCatalogEntry, 0, len(keys))
+	for _, key := range keys {
+		cmd := serverSettingCommands[key]
+		catalog = append(catalog, serverSettingCatalogEntry{
+			Key:       key,
+			Method:    cmd.Method,
+			GetMethod: cmd.getMethod(),
+			Param:     cmd.Param,
+			Type:      cmd.Type,
+			Choices:   cmd.Choices,
+			Min:       cmd.Min,
+			Max:       cmd.Max,
+		})
+	}
+	a.writeJSON(w, catalog)
+}
+
 func (a *App) handleListGameRulePresets(w http.ResponseWriter, r *http.Request) {
-	a.writeJSON(w, defaultPresets)
+	presets := make([]presetListEntry, 0, len(defaultPresets))
+	for _, preset := range defaultPresets {
+		presets = append(presets, presetListEntry{GameRulePreset: preset, Source: presetSourceBuiltin})
+	}
+	a.writeJSON(w, presets)
 }
 
 func (a *App) handleApplyGameRulePreset(w http.ResponseWriter, r *http.Request) {
@@ -115,8 +267,11 @@ func (a *App) handleApplyGameRulePreset(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
 	var req applyPresetRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSONBody(r, &req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -133,43 +288,286 @@ func (a *App) handleApplyGameRulePreset(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+
+	// A nil agent with a remote owner is reached through the hub relay.
 	agent := a.Hub.AgentFor(serverID)
-	if agent == nil {
-		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		a.writeAgentOffline(w, r, serverID)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
 	defer cancel()
 
-	results := make([]presetApplicationResult, 0, len(preset.GameRules)+len(preset.Settings))
+	steps := presetSteps(preset)
+	results := make([]presetApplicationResult, 0, len(steps))
 	start := time.Now()
 
-	for name, value := range preset.GameRules {
-		res := a.applyMinecraftGameRule(ctx, agent, serverID, user, name, value)
-		res.Type = "gamerule"
-		res.Name = name
-		res.Value = value
-		results = append(results, res)
+	var prior []any
+	if req.Atomic {
+		prior, err = a.readPresetValues(ctx, serverID, agent, steps)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read current values: %v", err), http.StatusBadGateway)
+			return
+		}
 	}
 
-	for name, value := range preset.Settings {
-		res := a.applyMinecraftServerSetting(ctx, agent, serverID, user, name, value)
-		res.Type = "setting"
-		res.Name = name
-		res.Value = value
+	failed := -1
+	for i, step := range steps {
+		if failed >= 0 {
+			results = append(results, presetApplicationResult{Type: step.Type, Name: step.Name, Value: step.Value, Status: "skipped"})
+			continue
+		}
+		res := a.applyPresetStep(ctx, agent, serverID, user, step.Type, step.Name, step.Value)
 		results = append(results, res)
+		if req.Atomic && res.Status != "ok" {
+			failed = i
+		}
 	}
 
 	response := applyPresetResponse{
-		Preset:   *preset,
-		Results:  results,
-		Duration: time.Since(start).Milliseconds(),
+		Preset:  *preset,
+		Results: results,
+		Atomic:  req.Atomic,
+	}
+
+	if failed >= 0 {
+		response.RolledBack = true
+		for i := failed - 1; i >= 0; i-- {
+			step := steps[i]
+			res := a.applyPresetStep(ctx, agent, serverID, user, step.Type, step.Name, prior[i])
+			if res.Status != "ok" {
+				response.RolledBack = false
+			}
+			response.Rollback = append(response.Rollback, res)
+		}
 	}
 
+	response.Duration = time.Since(start).Milliseconds()
 	a.writeJSON(w, response)
 }
 
+func (a *App) handlePresetDiff(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+
+	key := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("preset")))
+	if key == "" {
+		http.Error(w, "preset required", http.StatusBadRequest)
+		return
+	}
+
+	preset, err := findPreset(key)
+	if err != nil {
+		http.Error(w, "preset not found", http.StatusNotFound)
+		return
+	}
+
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+
+	// A nil agent with a remote owner is reached through the hub relay.
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	steps := presetSteps(preset)
+	current, err := a.readPresetValues(ctx, serverID, agent, steps)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read current values: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	response := presetDiffResponse{
+		Preset:  *preset,
+		Entries: make([]presetDiffEntry, 0, len(steps)),
+	}
+	for i, step := range steps {
+		entry := presetDiffEntry{
+			Type:    step.Type,
+			Name:    step.Name,
+			Current: current[i],
+			Target:  step.Value,
+			Changed: !presetValueEqual(step, current[i]),
+		}
+		if entry.Changed {
+			response.Changed++
+		}
+		response.Entries = append(response.Entries, entry)
+	}
+
+	a.writeJSON(w, response)
+}
+
+// handleGetGameRule returns one gamerule's current value. The management
+// protocol only lists every rule, so this reads the list and picks the key.
+func (a *App) handleGetGameRule(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	key := strings.TrimSpace(chi.URLParam(r, "key"))
+	if key == "" {
+		http.Error(w, "gamerule key required", http.StatusBadRequest)
+		return
+	}
+
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+
+	// A nil agent with a remote owner is reached through the hub relay.
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.serverRPCTimeout(r.Context(), serverID))
+	defer cancel()
+
+	rules, err := a.fetchGameRuleList(ctx, serverID, agent)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read gamerules: %v", err), http.StatusBadGateway)
+		return
+	}
+	for _, rule := range rules {
+		if rule.Key == key {
+			a.writeJSON(w, rule)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("unknown gamerule %q", key), http.StatusNotFound)
+}
+
+// presetValueEqual compares a current value with a step's target after
+// normalizing both the way they would be sent to Minecraft.
+func presetValueEqual(step presetStep, current any) bool {
+	if step.Type == "gamerule" {
+		return stringifyGameRuleValue(current) == stringifyGameRuleValue(step.Value)
+	}
+	cmd, ok := serverSettingCommands[step.Name]
+	if !ok {
+		return fmt.Sprint(current) == fmt.Sprint(step.Value)
+	}
+	want, err := cmd.Coerce(step.Value)
+	if err != nil {
+		return false
+	}
+	have, err := cmd.Coerce(current)
+	if err != nil {
+		return false
+	}
+	return want == have
+}
+
+func (a *App) applyPresetStep(ctx context.Context, agent *AgentConn, serverID string, user *AuthUser, kind, name string, value any) presetApplicationResult {
+	var res presetApplicationResult
+	if kind == "gamerule" {
+		res = a.applyMinecraftGameRule(ctx, agent, serverID, user, name, value)
+	} else {
+		res = a.applyMinecraftServerSetting(ctx, agent, serverID, user, name, value)
+	}
+	res.Type = kind
+	res.Name = name
+	res.Value = value
+	return res
+}
+
+// readPresetValues returns the server's current value for each step, in
+// step order.
+func (a *App) readPresetValues(ctx context.Context, serverID string, agent *AgentConn, steps []presetStep) ([]any, error) {
+	var gameRules map[string]any
+	values := make([]any, len(steps))
+	for i, step := range steps {
+		if step.Type == "gamerule" {
+			if gameRules == nil {
+				var err error
+				if gameRules, err = a.fetchGameRules(ctx, serverID, agent); err != nil {
+					return nil, err
+				}
+			}
+			value, ok := gameRules[step.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown gamerule %q", step.Name)
+			}
+			values[i] = value
+			continue
+		}
+
+		cmd, ok := serverSettingCommands[step.Name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported setting %q", step.Name)
+		}
+		value, err := a.fetchServerSetting(ctx, serverID, agent, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", step.Name, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// callAgentResult calls method on agent, or through the hub relay when
+// agent is nil, and returns the result member of its response.
+func (a *App) callAgentResult(ctx context.Context, serverID string, agent *AgentConn, method string) (json.RawMessage, error) {
+	resp, err := a.Hub.call(ctx, serverID, agent, JSONRPC{Method: method, Params: json.RawMessage("[]")})
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeJSONRPCError(resp); err != nil {
+		return nil, err
+	}
+	var env struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &env); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return env.Result, nil
+}
+
+func (a *App) fetchGameRuleList(ctx context.Context, serverID string, agent *AgentConn) ([]gameRuleValue, error) {
+	result, err := a.callAgentResult(ctx, serverID, agent, "minecraft:gamerules")
+	if err != nil {
+		return nil, err
+	}
+	var rules []gameRuleValue
+	if err := json.Unmarshal(result, &rules); err != nil {
+		return nil, fmt.Errorf("decode gamerules: %w", err)
+	}
+	return rules, nil
+}
+
+func (a *App) fetchGameRules(ctx context.Context, serverID string, agent *AgentConn) (map[string]any, error) {
+	rules, err := a.fetchGameRuleList(ctx, serverID, agent)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(rules))
+	for _, rule := range rules {
+		values[rule.Key] = rule.Value
+	}
+	return values, nil
+}
+
+func (a *App) fetchServerSetting(ctx context.Context, serverID string, agent *AgentConn, cmd serverSettingRPC) (any, error) {
+	result, err := a.callAgentResult(ctx, serverID, agent, cmd.getMethod())
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(result, &value); err != nil {
+		return nil, fmt.Errorf("decode setting: %w", err)
+	}
+	return value, nil
+}
+
 func (a *App) applyMinecraftGameRule(ctx context.Context, agent *AgentConn, serverID string, user *AuthUser, name string, value any) presetApplicationResult {
 	params := map[string]any{
 		"gamerule": map[string]any{
@@ -185,7 +583,7 @@ func (a *App) applyMinecraftGameRule(ctx context.Context, agent *AgentConn, serv
 
 	frame := JSONRPC{Method: "minecraft:gamerules/update", Params: json.RawMessage(payload)}
 
-	resp, callErr := agent.Call(ctx, frame)
+	resp, callErr := a.Hub.call(ctx, serverID, agent, frame)
 	status := "ok"
 	message := ""
 	if callErr != nil {
@@ -214,13 +612,9 @@ func (a *App) applyMinecraftServerSetting(ctx context.Context, agent *AgentConn,
 		return presetApplicationResult{Status: "error", Message: fmt.Sprintf("unsupported setting %q", name)}
 	}
 
-	coerced := value
-	if cmd.Coerce != nil {
-		var err error
-		coerced, err = cmd.Coerce(value)
-		if err != nil {
-			return presetApplicationResult{Status: "error", Message: err.Error()}
-		}
+	coerced, err := cmd.Coerce(value)
+	if err != nil {
+		return presetApplicationResult{Status: "error", Message: err.Error()}
 	}
 
 	params := map[string]any{cmd.Param: coerced}
@@ -231,7 +625,7 @@ func (a *App) applyMinecraftServerSetting(ctx context.Context, agent *AgentConn,
 
 	frame := JSONRPC{Method: cmd.Method, Params: json.RawMessage(payload)}
 
-	resp, callErr := agent.Call(ctx, frame)
+	resp, callErr := a.Hub.call(ctx, serverID, agent, frame)
 	status := "ok"
 	message := ""
 	if callErr != nil {
@@ -0,0 +1,386 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type serverGroup struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description,omitempty"`
+	ServerIDs   []string  `json:"server_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type createGroupRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+}
+
+type groupRPCResult struct {
+	ServerID string          `json:"server_id"`
+	Status   string          `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type groupRPCSummary struct {
+	OK        int `json:"ok"`
+	Error     int `json:"error"`
+	Timeout   int `json:"timeout"`
+	Suspended int `json:"suspended"`
+}
+
+type groupRPCResponse struct {
+	GroupID string           `json:"group_id"`
+	Method  string           `json:"method"`
+	Results []groupRPCResult `json:"results"`
+	Summary groupRPCSummary  `json:"summary"`
+}
+
+// maxGroupRPCWait bounds how long a group RPC waits for its members. It stays
+// under the 60s route timeout so the results gathered so far are returned
+// instead of a 504.
+const maxGroupRPCWait = 55 * time.Second
+
+// groupRPCWait reads ?timeout_ms=, the overall deadline for a group RPC.
+func groupRPCWait(r *http.Request) (time.Duration, error) {
+	raw := r.URL.Query().Get("timeout_ms")
+	if raw == "" {
+		return maxGroupRPCWait, nil
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	wait := time.Duration(ms) * time.Millisecond
+	if err != nil || wait <= 0 || wait > maxGroupRPCWait {
+		return 0, fmt.Errorf("timeout_ms must be between 1 and %d", maxGroupRPCWait.Milliseconds())
+	}
+	return wait, nil
+}
+
+func summarizeGroupRPC(results []groupRPCResult) groupRPCSummary {
+	var s groupRPCSummary
+	for _, res := range results {
+		switch res.Status {
+		case "ok":
+			s.OK++
+		case "timeout":
+			s.Timeout++
+		case "suspended":
+			s.Suspended++
+		default:
+			s.Error++
+		}
+	}
+	return s
+}
+
+const groupColumns = `g.id, g.name, g.description, g.created_at,
+	COALESCE(array_agg(m.server_id::text ORDER BY m.server_id) FILTER (WHERE m.server_id IS NOT NULL), '{}')`
+
+const groupFrom = ` FROM server_groups g LEFT JOIN server_group_members m ON m.group_id = g.id`
+
+func scanGroup(row pgx.Row) (serverGroup, error) {
+	var g serverGroup
+	err := row.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt, &g.ServerIDs)
+	return g, err
+}
+
+func (a *App) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	rows, err := a.ReadDB.Query(ctx, `SELECT `+groupColumns+groupFrom+` GROUP BY g.id ORDER BY g.name`)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	groups := make([]serverGroup, 0)
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		groups = append(groups, g)
+	}
+	a.writeJSON(w, groups)
+}
+
+func (a *App) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "id")
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	g, err := scanGroup(a.ReadDB.QueryRow(ctx, `SELECT `+groupColumns+groupFrom+` WHERE g.id = $1 GROUP BY g.id`, groupID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	a.writeJSON(w, g)
+}
+
+func (a *App) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req createGroupRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+
+	g := serverGroup{Name: req.Name, Description: req.Description, ServerIDs: []string{}}
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	err := a.DB.QueryRow(ctx, `INSERT INTO server_groups (name, description) VALUES ($1, $2) RETURNING id, created_at`, req.Name, req.Description).Scan(&g.ID, &g.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "group name already exists", http.StatusConflict)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	a.writeJSONStatus(w, http.StatusCreated, g)
+}
+
+func (a *App) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "id")
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	tag, err := a.DB.Exec(ctx, `DELETE FROM server_groups WHERE id = $1`, groupID)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) handleAddGroupMember(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "id")
+	serverID := chi.URLParam(r, "serverID")
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+
+	// Adding an existing member is a no-op; the flag only tells us whether
+	// both sides exist.
+	var found bool
+	err := a.DB.QueryRow(ctx, `WITH ins AS (
+		INSERT INTO server_group_members (group_id, server_id)
+		SELECT g.id, s.id FROM server_groups g, servers s WHERE g.id = $1 AND s.id = $2
+		ON CONFLICT DO NOTHING
+	)
+	SELECT EXISTS (SELECT 1 FROM server_groups WHERE id = $1) AND EXISTS (SELECT 1 FROM servers WHERE id = $2)`, groupID, serverID).Scan(&found)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) handleRemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "id")
+	serverID := chi.URLParam(r, "serverID")
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	tag, err := a.DB.Exec(ctx, `DELETE FROM server_group_members WHERE group_id = $1 AND server_id = $2`, groupID, serverID)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type groupMember struct {
+	id        string
+	suspended bool
+}
+
+// groupMembers returns the group's servers, or pgx.ErrNoRows if the group
+// does not exist.
+func (a *App) groupMembers(ctx context.Context, groupID string) ([]groupMember, error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+
+	var exists bool
+	if err := a.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM server_groups WHERE id = $1)`, groupID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, pgx.ErrNoRows
+	}
+
+	rows, err := a.DB.Query(ctx, `SELECT s.id, s.suspended FROM server_group_members m JOIN servers s ON s.id = m.server_id WHERE m.group_id = $1 ORDER BY s.name`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []groupMember
+	for rows.Next() {
+		var m groupMember
+		if err := rows.Scan(&m.id, &m.suspended); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// handleGroupRPC checks RBAC once for the method, then calls every member's
+// agent concurrently. Each underlying call is audited against its server
+// with the group recorded alongside. When the overall deadline passes, the
+// results gathered so far are returned and members still in flight are
+// reported as "timeout"; their calls are canceled and audited as errors.
+func (a *App) handleGroupRPC(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req JSONRPC
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Method == "" {
+		http.Error(w, "method required", http.StatusBadRequest)
+		return
+	}
+	if req.Method == commandMethod {
+		http.Error(w, errCommandViaRPC.Error(), http.StatusBadRequest)
+		return
+	}
+
+	minRole := roleForMethod(req.Method)
+	if !user.Role.Meets(minRole) {
+		a.writeJSONStatus(w, http.StatusForbidden, rbacErrorResponse{
+			Error:        "forbidden",
+			Method:       req.Method,
+			RequiredRole: minRole,
+			CurrentRole:  user.Role,
+		})
+		return
+	}
+	if a.rejectWithoutSudo(w, r, req.Method) {
+		return
+	}
+	wait, err := groupRPCWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	members, err := a.groupMembers(r.Context(), groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	groupCtx, cancelGroup := context.WithTimeout(r.Context(), wait)
+	defer cancelGroup()
+
+	type completed struct {
+		index  int
+		result groupRPCResult
+	}
+	results := make([]groupRPCResult, len(members))
+	// Buffered so calls that finish after the deadline never block.
+	done := make(chan completed, len(members))
+	pending := 0
+	for i, m := range members {
+		results[i].ServerID = m.id
+		if m.suspended {
+			results[i].Status = "suspended"
+			continue
+		}
+		if err := a.checkMethodAllowed(r.Context(), m.id, req.Method); err != nil {
+			results[i].Status = "error"
+			results[i].Error = err.Error()
+			a.recordGroupAudit(r.Context(), groupID, user.ID, m.id, req.Method, req.Params, "error", err)
+			continue
+		}
+		agent := a.Hub.AgentFor(m.id)
+		if agent == nil && !a.Hub.RemoteAgent(r.Context(), m.id) {
+			results[i].Status = "error"
+			results[i].Error = "agent not connected"
+			a.recordGroupAudit(r.Context(), groupID, user.ID, m.id, req.Method, req.Params, "error", errors.New("agent disconnected"))
+			continue
+		}
+
+		results[i].Status = "timeout"
+		results[i].Error = "group deadline exceeded"
+		pending++
+		go func(i int, serverID string, agent *AgentConn) {
+			res := groupRPCResult{ServerID: serverID}
+			// Each server gets its own request id.
+			frame := req
+			frame.ID = nil
+			ctx, cancel := context.WithTimeout(groupCtx, a.serverRPCTimeout(groupCtx, serverID))
+			defer cancel()
+			resp, attempts, err := a.callAgent(ctx, serverID, agent, frame)
+			if err != nil {
+				res.Status = "error"
+				res.Error = err.Error()
+			} else {
+				res.Status = "ok"
+				res.Response = resp
+			}
+			a.recordCallAudit(groupCtx, groupID, user.ID, serverID, req.Method, req.Params, res.Status, err, attempts)
+			done <- completed{index: i, result: res}
+		}(i, m.id, agent)
+	}
+
+collect:
+	for ; pending > 0; pending-- {
+		select {
+		case c := <-done:
+			results[c.index] = c.result
+		case <-groupCtx.Done():
+			break collect
+		}
+	}
+
+	a.writeJSON(w, groupRPCResponse{
+		GroupID: groupID,
+		Method:  req.Method,
+		Results: results,
+		Summary: summarizeGroupRPC(results),
+	})
+}
@@ -1,11 +1,18 @@
 package app
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,57 +20,507 @@ import (
 	"nhooyr.io/websocket"
 )
 
+var (
+	errClientLimit       = errors.New("event client limit reached")
+	errAgentIPLimit      = errors.New("too many agent connections from this address")
+	errAgentDisconnected = errors.New("agent disconnected")
+	// errAgentWrite marks a call whose request frame never reached the
+	// agent, so the agent cannot have acted on it.
+	errAgentWrite = errors.New("agent write failed")
+	// errCallIDInUse rejects a call whose id matches one still in flight on
+	// the same agent; responses are routed by id, so it cannot be shared.
+	errCallIDInUse = errors.New("rpc id already in flight on this server; use a unique id")
+	// errDraining refuses calls that arrive after shutdown began draining.
+	errDraining = errors.New("api is shutting down")
+)
+
+// defaultMaxFrame is the WebSocket library's own read limit. Agents size
+// their response chunks to fit it, so the agent cap should not go lower.
+const defaultMaxFrame = 32 << 10
+
+// frameTooLarge reports whether a read failed because the peer sent a
+// message over the connection's read limit. The library has already closed
+// the connection with StatusMessageTooBig; it exports no sentinel, so this
+// matches its error text.
+func frameTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "read limited at")
+}
+
+type HubConfig struct {
+	// MaxClientsPerServer caps event stream connections for a single server; zero means unlimited.
+	MaxClientsPerServer int
+	// MaxClients caps event stream connections across all servers; zero means unlimited.
+	MaxClients int
+	// QueryTimeout bounds each hub database write; zero means no timeout.
+	QueryTimeout time.Duration
+	// AgentWriteTimeout bounds each frame written to an agent; zero means no timeout.
+	AgentWriteTimeout time.Duration
+	// AgentReadIdleTimeout closes an agent that sends no frame for this long; zero disables it.
+	AgentReadIdleTimeout time.Duration
+	// AgentReplaceGrace is how long a newly connecting agent waits for the
+	// server's existing agent to answer a ping. One that does not is taken
+	// for a dead socket and dropped quietly; zero skips the check.
+	AgentReplaceGrace time.Duration
+	// Cipher encrypts the persisted schema; nil stores it in plaintext.
+	Cipher *DataCipher
+	// CacheLastResponses keeps the latest response per read-only method for debugging.
+	CacheLastResponses bool
+	// StrictJSONRPC rejects agent responses whose jsonrpc field is not "2.0";
+	// by default a missing or different version is tolerated.
+	StrictJSONRPC bool
+	// AgentLogBuffer is how many forwarded agent log records are kept per server; zero disables storage.
+	AgentLogBuffer int
+	// ClientIdleTimeout closes event clients that send no frame and answer no ping for this long; zero disables it.
+	ClientIdleTimeout time.Duration
+	// NewCallID generates ids for calls that arrive without one; nil uses
+	// random UUIDs. Tests can supply a counter for deterministic ids.
+	NewCallID func() string
+	// ConnectivityDebounce is how long an agent must stay connected or
+	// disconnected before the change is alerted; zero alerts at once.
+	ConnectivityDebounce time.Duration
+	// ConnectivityWebhook receives a JSON POST for each alert; empty only logs.
+	ConnectivityWebhook string
+	// AgentMaxFrame and ClientMaxFrame cap the size of a single message read
+	// from an agent or event client; the connection is closed with
+	// StatusMessageTooBig when one is exceeded. Zero uses defaultMaxFrame.
+	AgentMaxFrame  int64
+	ClientMaxFrame int64
+	// MaxAgentsPerIP caps concurrent agent connections from one client
+	// address; zero means unlimited.
+	MaxAgentsPerIP int
+	// SchemaStrip removes matching members from the schema served to
+	// callers below owner; empty serves it whole.
+	SchemaStrip []RedactionRule
+	// Relay lets instances sharing the database forward calls to agents
+	// connected elsewhere; off, each instance only reaches its own agents.
+	Relay bool
+	// MaxAgentsPerOwner caps how many of one owner's servers may have an
+	// agent connected at once; zero means unlimited.
+	MaxAgentsPerOwner int
+}
+
 type Hub struct {
-	db      *pgxpool.Pool
-	logger  *slog.Logger
-	mu      sync.RWMutex
-	agents  map[string]*AgentConn
-	clients map[string]map[*ClientConn]struct{}
+	db              *pgxpool.Pool
+	logger          *slog.Logger
+	cfg             HubConfig
+	mu              sync.RWMutex
+	agents          map[string]*AgentConn
+	clients         map[string]map[*ClientConn]struct{}
+	clientSlots     map[string]int
+	clientSlotTotal int
+	clientsRejected uint64
+	agentReconnects uint64
+	// agentIPSlots counts agent connections per client address, including
+	// ones still authenticating.
+	agentIPSlots    map[string]int
+	agentIPRejected uint64
+	// ownerAgents counts agent connections per owner and server.
+	ownerAgents   map[string]map[string]int
+	ownerRejected uint64
+	subscriptions *subscriptionStore
+	callsCtx      context.Context
+	cancelCalls   context.CancelFunc
+	calls         sync.WaitGroup
+	// draining is set under mu once DrainCalls starts; calls.Add is only
+	// made under mu while it is false, so none races calls.Wait.
+	draining        bool
+	lastResponses   *lastResponseCache
+	agentLogs       *agentLogStore
+	agentTelemetry  *agentTelemetryStore
+	connectivity    *connectivityNotifier
+	invalidPayloads atomic.Uint64
+	// eventFilters holds each server's broadcast filter; servers without
+	// one are absent.
+	eventFilters   map[string]eventFilter
+	filteredEvents atomic.Uint64
+	// schemaDigests holds the schemaDigest of the schema last stored for
+	// each server, so an unchanged rediscovery costs no database write.
+	schemaDigests map[string]string
+	// relay is nil unless HubConfig.Relay is set.
+	relay *hubRelay
 }
 
-func NewHub(db *pgxpool.Pool, logger *slog.Logger) *Hub {
-	return &Hub{
-		db:      db,
-		logger:  logger,
-		agents:  make(map[string]*AgentConn),
-		clients: make(map[string]map[*ClientConn]struct{}),
+func NewHub(db *pgxpool.Pool, cfg HubConfig, logger *slog.Logger) *Hub {
+	callsCtx, cancelCalls := context.WithCancel(context.Background())
+	if cfg.AgentMaxFrame <= 0 {
+		cfg.AgentMaxFrame = defaultMaxFrame
+	}
+	if cfg.ClientMaxFrame <= 0 {
+		cfg.ClientMaxFrame = defaultMaxFrame
+	}
+	var lastResponses *lastResponseCache
+	if cfg.CacheLastResponses {
+		lastResponses = newLastResponseCache()
 	}
+	var agentLogs *agentLogStore
+	if cfg.AgentLogBuffer > 0 {
+		agentLogs = newAgentLogStore(cfg.AgentLogBuffer)
+	}
+	h := &Hub{
+		callsCtx:       callsCtx,
+		cancelCalls:    cancelCalls,
+		db:             db,
+		logger:         logger,
+		cfg:            cfg,
+		agents:         make(map[string]*AgentConn),
+		clients:        make(map[string]map[*ClientConn]struct{}),
+		clientSlots:    make(map[string]int),
+		agentIPSlots:   make(map[string]int),
+		ownerAgents:    make(map[string]map[string]int),
+		eventFilters:   make(map[string]eventFilter),
+		schemaDigests:  make(map[string]string),
+		subscriptions:  newSubscriptionStore(),
+		lastResponses:  lastResponses,
+		agentLogs:      agentLogs,
+		agentTelemetry: newAgentTelemetryStore(),
+	}
+	h.connectivity = newConnectivityNotifier(h, cfg.ConnectivityDebounce, cfg.ConnectivityWebhook)
+	if cfg.Relay {
+		h.relay = newHubRelay(h)
+		go h.relay.run()
+	}
+	return h
 }
 
-func (h *Hub) RegisterAgent(ctx context.Context, serverID string, conn *websocket.Conn) *AgentConn {
-	agent := newAgentConn(h, serverID, conn)
+// RegisterAgent makes conn the server's agent, replacing any earlier one.
+// features holds what the agent advertised when it connected.
+func (h *Hub) RegisterAgent(ctx context.Context, serverID string, conn *websocket.Conn, features map[string]bool) *AgentConn {
+	conn.SetReadLimit(h.cfg.AgentMaxFrame)
+	agent := newAgentConn(h, serverID, conn, features)
+
+	// A reconnect after a network blip often arrives before the old socket
+	// is noticed as dead. Probe it first so only a second live agent for
+	// the same server is reported as a conflict.
+	h.mu.RLock()
+	probed := h.agents[serverID]
+	h.mu.RUnlock()
+	live := probed != nil && probed.alive(ctx, h.cfg.AgentReplaceGrace)
 
 	h.mu.Lock()
 	if existing, ok := h.agents[serverID]; ok {
+		if existing == probed && !live {
+			h.logger.Info("replacing unresponsive agent", slog.String("server_id", serverID))
+		} else {
+			h.logger.Warn("replacing live agent; two agents may share this server's token", slog.String("server_id", serverID))
+		}
+		// Agents match this reason and wait AGENT_SLOW_RECONNECT_DELAY
+		// before dialing again, so keep it stable.
 		existing.Close(websocket.StatusPolicyViolation, "replaced")
 	}
 	h.agents[serverID] = agent
 	h.mu.Unlock()
+	h.connectivity.observe(serverID, true)
 
-	if _, err := h.db.Exec(ctx, "UPDATE servers SET connected_at = now() WHERE id = $1", serverID); err != nil {
+	dbCtx, cancel := withQueryTimeout(ctx, h.cfg.QueryTimeout)
+	defer cancel()
+	if _, err := h.db.Exec(dbCtx, "UPDATE servers SET connected_at = now(), agent_last_seen_at = now(), agent_instance = $2 WHERE id = $1", serverID, h.instanceID()); err != nil {
 		h.logger.Error("failed to update server connected_at", slog.String("server_id", serverID), slog.Any("err", err))
 	}
+	h.refreshEventFilter(ctx, serverID)
 
 	go agent.readLoop()
 	return agent
 }
 
+// DrainCalls waits up to grace for in-flight agent calls to finish and then
+// cancels whatever is still outstanding so shutdown is not held up by slow
+// agents.
+func (h *Hub) DrainCalls(grace time.Duration) {
+	h.mu.Lock()
+	h.draining = true
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.calls.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(grace):
+	}
+
+	h.logger.Warn("cancelling in-flight agent calls", slog.Duration("grace", grace))
+	h.cancelCalls()
+	<-done
+}
+
+// beginCall counts an agent call as in flight, or fails once draining has
+// started. Every successful call must be paired with h.calls.Done.
+func (h *Hub) beginCall() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return errDraining
+	}
+	h.calls.Add(1)
+	return nil
+}
+
 func (h *Hub) AgentFor(serverID string) *AgentConn {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	return h.agents[serverID]
 }
 
-func (h *Hub) RegisterClient(serverID string, conn *websocket.Conn) *ClientConn {
-	client := &ClientConn{conn: conn}
+// acquireClientSlot reserves capacity for an event client before the
+// WebSocket upgrade so over-limit requests can still be rejected over HTTP.
+func (h *Hub) acquireClientSlot(serverID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cfg.MaxClients > 0 && h.clientSlotTotal >= h.cfg.MaxClients {
+		h.clientsRejected++
+		return errClientLimit
+	}
+	if h.cfg.MaxClientsPerServer > 0 && h.clientSlots[serverID] >= h.cfg.MaxClientsPerServer {
+		h.clientsRejected++
+		return errClientLimit
+	}
+	h.clientSlots[serverID]++
+	h.clientSlotTotal++
+	return nil
+}
+
+func (h *Hub) releaseClientSlot(serverID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clientSlots[serverID] <= 1 {
+		delete(h.clientSlots, serverID)
+	} else {
+		h.clientSlots[serverID]--
+	}
+	if h.clientSlotTotal > 0 {
+		h.clientSlotTotal--
+	}
+}
 
+// acquireAgentIPSlot reserves one of ip's agent connections before the
+// upgrade, so a host opening sockets in a loop is turned away over HTTP.
+func (h *Hub) acquireAgentIPSlot(ip string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if h.cfg.MaxAgentsPerIP > 0 && h.agentIPSlots[ip] >= h.cfg.MaxAgentsPerIP {
+		h.agentIPRejected++
+		return errAgentIPLimit
+	}
+	h.agentIPSlots[ip]++
+	return nil
+}
+
+func (h *Hub) releaseAgentIPSlot(ip string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.agentIPSlots[ip] <= 1 {
+		delete(h.agentIPSlots, ip)
+	} else {
+		h.agentIPSlots[ip]--
+	}
+}
+
+type hubClientStats struct {
+	Connected int    `json:"connected"`
+	Rejected  uint64 `json:"rejected_total"`
+}
+
+func (h *Hub) ClientStats() hubClientStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return hubClientStats{Connected: h.clientSlotTotal, Rejected: h.clientsRejected}
+}
+
+type hubAgentStats struct {
+	Connected    int               `json:"connected"`
+	Reconnects   uint64            `json:"reconnects_total"`
+	Connectivity connectivityStats `json:"connectivity"`
+	// InvalidPayloads counts agent frames that were not JSON objects.
+	InvalidPayloads uint64 `json:"invalid_payloads_total"`
+	// FilteredEvents counts notifications dropped by server event filters.
+	FilteredEvents uint64 `json:"filtered_events_total"`
+	// ConnectionsByIP is the current agent connection count per client
+	// address; IPRejected counts connects refused by MaxAgentsPerIP.
+	ConnectionsByIP map[string]int `json:"connections_by_ip"`
+	IPRejected      uint64         `json:"ip_rejected_total"`
+	// OwnerRejected counts connects refused by MaxAgentsPerOwner.
+	OwnerRejected uint64 `json:"owner_rejected_total"`
+}
+
+func (h *Hub) AgentStats() hubAgentStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	byIP := make(map[string]int, len(h.agentIPSlots))
+	for ip, n := range h.agentIPSlots {
+		byIP[ip] = n
+	}
+	return hubAgentStats{
+		ConnectionsByIP: byIP,
+		IPRejected:      h.agentIPRejected,
+		OwnerRejected:   h.ownerRejected,
+		Connected:       len(h.agents),
+		Reconnects:      h.agentReconnects,
+		Connectivity:    h.connectivity.snapshot(),
+		InvalidPayloads: h.invalidPayloads.Load(),
+		FilteredEvents:  h.filteredEvents.Load(),
+	}
+}
+
+type agentReconnectedEvent struct {
+	Event      string    `json:"_event"`
+	ServerID   string    `json:"server_id"`
+	DowntimeMs int64     `json:"downtime_ms"`
+	At         time.Time `json:"reconnected_at"`
+}
+
+// agentReconnected records an agent that came back after losing its previous
+// session and tells the server's event clients how long it was away.
+func (h *Hub) agentReconnected(serverID string, downtime time.Duration) {
+	h.mu.Lock()
+	h.agentReconnects++
+	h.mu.Unlock()
+
+	h.logger.Info("agent reconnected", slog.String("server_id", serverID), slog.Duration("downtime", downtime))
+
+	payload, err := json.Marshal(agentReconnectedEvent{
+		Event:      "agent_reconnected",
+		ServerID:   serverID,
+		DowntimeMs: downtime.Milliseconds(),
+		At:         time.Now().UTC(),
+	})
+	if err != nil {
+		return
+	}
+	h.broadcast(serverID, payload, true)
+}
+
+type hubConnectionSummary struct {
+	ServerID         string     `json:"server_id"`
+	AgentConnected   bool       `json:"agent_connected"`
+	AgentConnectedAt *time.Time `json:"agent_connected_at,omitempty"`
+	ClientCount      int        `json:"client_count"`
+}
+
+// Snapshot summarises every server the hub currently knows about, whether it
+// has a live agent, event clients, or both.
+func (h *Hub) Snapshot() []hubConnectionSummary {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	byServer := make(map[string]*hubConnectionSummary, len(h.agents)+len(h.clients))
+	entry := func(serverID string) *hubConnectionSummary {
+		if item, ok := byServer[serverID]; ok {
+			return item
+		}
+		item := &hubConnectionSummary{ServerID: serverID}
+		byServer[serverID] = item
+		return item
+	}
+	for serverID, agent := range h.agents {
+		item := entry(serverID)
+		connectedAt := agent.connectedAt
+		item.AgentConnected = true
+		item.AgentConnectedAt = &connectedAt
+	}
+	for serverID, clients := range h.clients {
+		entry(serverID).ClientCount = len(clients)
+	}
+
+	list := make([]hubConnectionSummary, 0, len(byServer))
+	for _, item := range byServer {
+		list = append(list, *item)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ServerID < list[j].ServerID })
+	return list
+}
+
+type snapshotEvent struct {
+	Event       string          `json:"_event"`
+	ServerID    string          `json:"server_id"`
+	Connected   bool            `json:"connected"`
+	ConnectedAt *time.Time      `json:"connected_at"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+// RegisterClient adds an event client and sends it a snapshot of the
+// persisted schema and connection status. The client's write lock is held
+// until the snapshot is out, so it is always the first frame on the stream.
+func (h *Hub) RegisterClient(ctx context.Context, serverID string, role Role, conn *websocket.Conn) (*ClientConn, error) {
+	conn.SetReadLimit(h.cfg.ClientMaxFrame)
+	client := &ClientConn{conn: conn, role: role, rpcSlots: make(chan struct{}, maxClientRPCInFlight)}
+	client.touch()
+
+	// Load the schema, and look up any other instance holding the agent,
+	// before the client is registered or its write lock is held: broadcast
+	// blocks on that lock, so holding it across a query would stall the
+	// agent's read loop.
+	snapshot := snapshotEvent{Event: "snapshot", ServerID: serverID}
+	queryCtx, cancel := withQueryTimeout(ctx, h.cfg.QueryTimeout)
+	err := h.db.QueryRow(queryCtx, `SELECT schema_json FROM servers WHERE id = $1`, serverID).Scan(&snapshot.Schema)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Schema, err = h.cfg.Cipher.open(snapshot.Schema, aadServerSchema); err != nil {
+		return nil, err
+	}
+	if snapshot.Schema == nil {
+		snapshot.Schema = json.RawMessage("null")
+	} else if snapshot.Schema, err = h.schemaForRole(snapshot.Schema, role); err != nil {
+		return nil, err
+	}
+	remoteAt := h.remoteConnectedAt(ctx, serverID)
+
+	// The snapshot must reach the client before any broadcast, so the write
+	// lock is taken before the client becomes visible to broadcast.
+	client.writeMu.Lock()
+	defer client.writeMu.Unlock()
+	h.mu.Lock()
 	if _, ok := h.clients[serverID]; !ok {
 		h.clients[serverID] = make(map[*ClientConn]struct{})
 	}
 	h.clients[serverID][client] = struct{}{}
-	return client
+	h.mu.Unlock()
+
+	// This is agentConnectedAt split around the lock: the relay lookup ran
+	// before it, while the local agent is read only now that the client is
+	// registered, so a connect or disconnect after this point reaches the
+	// client as an event.
+	snapshot.ConnectedAt = remoteAt
+	if agent := h.AgentFor(serverID); agent != nil {
+		snapshot.ConnectedAt = &agent.connectedAt
+	}
+	snapshot.Connected = snapshot.ConnectedAt != nil
+
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		h.removeClient(serverID, client)
+		return nil, err
+	}
+	writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := conn.Write(writeCtx, websocket.MessageText, payload); err != nil {
+		h.removeClient(serverID, client)
+		return nil, err
+	}
+	return client, nil
+}
+
+// disconnectServer closes the agent and every event client for a server.
+func (h *Hub) disconnectServer(serverID string, status websocket.StatusCode, reason string) {
+	h.mu.RLock()
+	agent := h.agents[serverID]
+	clients := make([]*ClientConn, 0, len(h.clients[serverID]))
+	for client := range h.clients[serverID] {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	if agent != nil {
+		agent.Close(status, reason)
+	}
+	for _, client := range clients {
+		client.Close(status, reason)
+	}
 }
 
 func (h *Hub) removeClient(serverID string, client *ClientConn) {
@@ -77,15 +534,37 @@ func (h *Hub) removeClient(serverID string, client *ClientConn) {
 	}
 }
 
-func (h *Hub) broadcast(serverID string, payload []byte) {
+// broadcast sends payload to the server's event clients and returns how many
+// received it. API-originated events (apiEvent) bypass method subscriptions;
+// agent notifications never do.
+func (h *Hub) broadcast(serverID string, payload []byte, apiEvent bool) int {
+	var env struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(payload, &env)
+
 	h.mu.RLock()
+	if f, ok := h.eventFilters[serverID]; ok && !apiEvent && !f.passes(env.Method) {
+		h.mu.RUnlock()
+		h.filteredEvents.Add(1)
+		return 0
+	}
 	clientsMap := h.clients[serverID]
 	clients := make([]*ClientConn, 0, len(clientsMap))
 	for client := range clientsMap {
+		if !apiEvent && !client.Wants(env.Method) {
+			continue
+		}
+		// Console output can carry anything the server logs, so the live
+		// tail is held to the same role as the console endpoint.
+		if strings.HasPrefix(env.Method, consoleNotificationMethod) && !client.role.Meets(RoleModerator) {
+			continue
+		}
 		clients = append(clients, client)
 	}
 	h.mu.RUnlock()
 
+	delivered := 0
 	for _, client := range clients {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		if err := client.Send(ctx, payload); err != nil {
@@ -96,36 +575,92 @@ func (h *Hub) broadcast(serverID string, payload []byte) {
 			continue
 		}
 		cancel()
+		delivered++
 	}
+	return delivered
 }
 
-func (h *Hub) agentClosed(serverID string) {
+// clientServerIDs lists servers that currently have event clients.
+func (h *Hub) clientServerIDs() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.clients))
+	for id := range h.clients {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ClearConnectedAt resets connected_at for every server. It runs at startup:
+// the hub starts empty, so any value left by a previous process is stale.
+// With the relay on, servers held by another live instance are kept.
+// It returns how many servers were reset.
+func (h *Hub) ClearConnectedAt(ctx context.Context) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, h.cfg.QueryTimeout)
+	defer cancel()
+	tag, err := h.db.Exec(ctx, `UPDATE servers SET connected_at = NULL, agent_instance = NULL WHERE connected_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM hub_instances i WHERE i.id = servers.agent_instance AND i.seen_at > now() - make_interval(secs => $1))`,
+		relayInstanceTTL.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// agentClosed forgets agent unless a newer agent has already replaced it,
+// in which case the server is still connected.
+func (h *Hub) agentClosed(agent *AgentConn) {
+	serverID := agent.serverID
 	h.mu.Lock()
-	delete(h.agents, serverID)
+	current := h.agents[serverID] == agent
+	if current {
+		delete(h.agents, serverID)
+	}
 	h.mu.Unlock()
+	if !current {
+		return
+	}
+	h.connectivity.observe(serverID, false)
 
-	if _, err := h.db.Exec(context.Background(), "UPDATE servers SET connected_at = NULL WHERE id = $1", serverID); err != nil {
+	ctx, cancel := withQueryTimeout(context.Background(), h.cfg.QueryTimeout)
+	defer cancel()
+	// Another instance may already hold the server's reconnected agent;
+	// leave its row alone.
+	if _, err := h.db.Exec(ctx, "UPDATE servers SET connected_at = NULL, agent_instance = NULL, agent_last_seen_at = now() WHERE id = $1 AND agent_instance IS NOT DISTINCT FROM $2", serverID, h.instanceID()); err != nil {
 		h.logger.Error("failed to clear connected_at", slog.String("server_id", serverID), slog.Any("err", err))
 	}
 }
 
 type AgentConn struct {
-	hub      *Hub
-	serverID string
-	conn     *websocket.Conn
-	writeMu  sync.Mutex
-	pending  map[string]chan []byte
-	pendMu   sync.Mutex
-	closed   chan struct{}
+	hub         *Hub
+	serverID    string
+	conn        *websocket.Conn
+	connectedAt time.Time
+	writeMu     sync.Mutex
+	pending     map[string]*pendingCall
+	pendMu      sync.Mutex
+	closed      chan struct{}
+	newID       func() string
+	features    map[string]bool
+	// invalidLog keeps a misbehaving agent from flooding the log with
+	// invalid payload warnings.
+	invalidLog logThrottle
 }
 
-func newAgentConn(hub *Hub, serverID string, conn *websocket.Conn) *AgentConn {
+func newAgentConn(hub *Hub, serverID string, conn *websocket.Conn, features map[string]bool) *AgentConn {
+	newID := hub.cfg.NewCallID
+	if newID == nil {
+		newID = uuid.NewString
+	}
 	return &AgentConn{
-		hub:      hub,
-		serverID: serverID,
-		conn:     conn,
-		pending:  make(map[string]chan []byte),
-		closed:   make(chan struct{}),
+		hub:         hub,
+		serverID:    serverID,
+		conn:        conn,
+		connectedAt: time.Now(),
+		pending:     make(map[string]*pendingCall),
+		closed:      make(chan struct{}),
+		newID:       newID,
+		features:    features,
 	}
 }
 
@@ -141,94 +676,169 @@ func (a *AgentConn) Close(status websocket.StatusCode, reason string) {
 	}
 }
 
+// alive reports whether the agent answers a ping within timeout. With no
+// timeout it assumes the agent is alive.
+func (a *AgentConn) alive(ctx context.Context, timeout time.Duration) bool {
+	select {
+	case <-a.closed:
+		return false
+	default:
+	}
+	if timeout <= 0 {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return a.conn.Ping(ctx) == nil
+}
+
 func (a *AgentConn) Closed() <-chan struct{} {
 	return a.closed
 }
 
 func (a *AgentConn) Call(ctx context.Context, frame JSONRPC) ([]byte, error) {
+	if err := a.hub.beginCall(); err != nil {
+		return nil, err
+	}
+	defer a.hub.calls.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(a.hub.callsCtx, cancel)
+	defer stop()
+
+	p := newBufferedCall()
+	idKey, err := a.startCall(ctx, &frame, p)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		a.abandon(idKey)
+		return nil, ctx.Err()
+	case <-a.closed:
+		a.abandon(idKey)
+		return nil, errAgentDisconnected
+	case resp := <-p.resp:
+		if resp == nil {
+			return nil, errAgentDisconnected
+		}
+		a.hub.lastResponses.remember(a.serverID, frame.Method, resp)
+		return resp, nil
+	}
+}
+
+// startCall assigns frame an id if it has none, registers p under it, and
+// sends the frame to the agent. A caller-supplied id is sent as is, so the
+// agent's response carries it back unchanged.
+func (a *AgentConn) startCall(ctx context.Context, frame *JSONRPC, p *pendingCall) (string, error) {
 	if frame.JSONRPC == "" {
 		frame.JSONRPC = "2.0"
 	}
 	if frame.ID == nil {
-		idVal := uuid.NewString()
-		raw, err := json.Marshal(idVal)
+		raw, err := json.Marshal(a.newID())
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 		rawMsg := json.RawMessage(raw)
 		frame.ID = &rawMsg
 	}
 	idKey := string(*frame.ID)
 
-	respCh := make(chan []byte, 1)
 	a.pendMu.Lock()
-	a.pending[idKey] = respCh
+	if _, taken := a.pending[idKey]; taken {
+		a.pendMu.Unlock()
+		return "", errCallIDInUse
+	}
+	a.pending[idKey] = p
 	a.pendMu.Unlock()
 
 	payload, err := json.Marshal(frame)
 	if err != nil {
-		if ch := a.removePending(idKey); ch != nil {
-			close(ch)
-		}
-		return nil, err
+		a.abandon(idKey)
+		return "", err
 	}
-
 	if err := a.write(ctx, payload); err != nil {
-		if ch := a.removePending(idKey); ch != nil {
-			close(ch)
-		}
-		return nil, err
+		a.abandon(idKey)
+		return "", fmt.Errorf("%w: %w", errAgentWrite, err)
+	}
+	return idKey, nil
+}
+
+func (a *AgentConn) Notify(ctx context.Context, frame JSONRPC) error {
+	if frame.JSONRPC == "" {
+		frame.JSONRPC = "2.0"
+	}
+	frame.ID = nil
+
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return err
 	}
 
 	select {
-	case <-ctx.Done():
-		if ch := a.removePending(idKey); ch != nil {
-			close(ch)
-		}
-		return nil, ctx.Err()
 	case <-a.closed:
-		if ch := a.removePending(idKey); ch != nil {
-			close(ch)
-		}
-		return nil, errors.New("agent disconnected")
-	case resp := <-respCh:
-		if resp == nil {
-			return nil, errors.New("agent disconnected")
-		}
-		return resp, nil
+		return errAgentDisconnected
+	default:
 	}
+
+	return a.write(ctx, payload)
 }
 
 func (a *AgentConn) write(ctx context.Context, data []byte) error {
+	if timeout := a.hub.cfg.AgentWriteTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	a.writeMu.Lock()
-	defer a.writeMu.Unlock()
-	return a.conn.Write(ctx, websocket.MessageText, data)
+	err := a.conn.Write(ctx, websocket.MessageText, data)
+	a.writeMu.Unlock()
+
+	if err != nil && errors.Is(err, context.DeadlineExceeded) {
+		// A write that cannot complete means the socket is wedged; drop the
+		// agent so it reconnects rather than blocking every later caller.
+		a.hub.logger.Warn("agent write timed out", slog.String("server_id", a.serverID))
+		a.Close(websocket.StatusPolicyViolation, "write timeout")
+	}
+	return err
 }
 
-func (a *AgentConn) removePending(idKey string) chan []byte {
+func (a *AgentConn) removePending(idKey string) *pendingCall {
 	a.pendMu.Lock()
-	ch := a.pending[idKey]
-	if ch != nil {
+	p := a.pending[idKey]
+	if p != nil {
 		delete(a.pending, idKey)
 	}
 	a.pendMu.Unlock()
-	return ch
+	return p
 }
 
 func (a *AgentConn) readLoop() {
 	ctx := context.Background()
 	for {
-		_, data, err := a.conn.Read(ctx)
+		_, data, err := a.read(ctx)
+		if frameTooLarge(err) {
+			a.hub.logger.Warn("agent frame exceeds limit; closing connection", slog.String("server_id", a.serverID), slog.Int64("limit_bytes", a.hub.cfg.AgentMaxFrame))
+			a.Close(websocket.StatusMessageTooBig, "frame too large")
+			a.hub.agentClosed(a)
+			return
+		}
 		if err != nil {
 			a.hub.logger.Info("agent connection closing", slog.String("server_id", a.serverID), slog.Any("err", err))
 			a.Close(websocket.StatusNormalClosure, "read error")
-			a.hub.agentClosed(a.serverID)
+			a.hub.agentClosed(a)
 			return
 		}
 
 		var env map[string]json.RawMessage
 		if err := json.Unmarshal(data, &env); err != nil {
-			a.hub.logger.Warn("invalid agent payload", slog.String("server_id", a.serverID), slog.Any("err", err))
+			a.hub.invalidPayloads.Add(1)
+			if ok, suppressed := a.invalidLog.allow(); ok {
+				a.hub.logger.Warn("invalid agent payload", slog.String("server_id", a.serverID), slog.Uint64("suppressed", suppressed), slog.Any("err", err))
+			}
 			continue
 		}
 
@@ -243,24 +853,36 @@ func (a *AgentConn) readLoop() {
 
 		if idRaw, ok := env["id"]; ok && len(idRaw) > 0 {
 			idKey := string(idRaw)
-			if ch := a.removePending(idKey); ch != nil {
-				select {
-				case ch <- data:
-				default:
-				}
-				close(ch)
+			if p := a.removePending(idKey); p != nil {
+				p.deliver(a.checkVersion(idRaw, env["jsonrpc"], data))
 			}
 			continue
 		}
 
 		if _, ok := env["method"]; ok {
-			// Notification - fan out to clients
-			a.hub.broadcast(a.serverID, data)
+			// Notification - fan out to clients. _event is reserved for
+			// API-originated frames, so agents cannot spoof them.
+			if _, spoofed := env["_event"]; spoofed {
+				a.hub.logger.Warn("dropping agent notification with reserved _event field", slog.String("server_id", a.serverID))
+				continue
+			}
+			a.hub.broadcast(a.serverID, data, false)
 			continue
 		}
 	}
 }
 
+// read waits for the next frame, giving up after the configured idle timeout
+// so half-open connections are detected.
+func (a *AgentConn) read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	if timeout := a.hub.cfg.AgentReadIdleTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return a.conn.Read(ctx)
+}
+
 func (a *AgentConn) handleControl(ctx context.Context, controlType string, env map[string]json.RawMessage) {
 	switch controlType {
 	case "discover":
@@ -268,30 +890,211 @@ func (a *AgentConn) handleControl(ctx context.Context, controlType string, env m
 		if !ok {
 			return
 		}
-		if _, err := a.hub.db.Exec(ctx, "UPDATE servers SET schema_json = $1 WHERE id = $2", schema, a.serverID); err != nil {
+		if err := a.hub.storeSchema(ctx, a.serverID, schema); err != nil {
 			a.hub.logger.Error("failed to persist schema", slog.String("server_id", a.serverID), slog.Any("err", err))
 		}
+	case "chunk":
+		a.handleChunk(env)
+	case "log":
+		entry, ok := parseAgentLog(env)
+		if !ok {
+			return
+		}
+		a.hub.agentLogs.add(a.serverID, entry)
+	case "telemetry":
+		samples, dropped, gzipped, err := parseAgentTelemetry(env)
+		if err != nil {
+			a.hub.logger.Warn("invalid agent telemetry", slog.String("server_id", a.serverID), slog.Any("err", err))
+			return
+		}
+		a.hub.agentTelemetry.add(a.serverID, samples, dropped, gzipped)
 	default:
 		a.hub.logger.Info("unknown control message", slog.String("server_id", a.serverID), slog.String("type", controlType))
 	}
 }
 
+// checkVersion returns data unchanged unless strict mode is on and the
+// response does not declare jsonrpc "2.0", in which case the caller gets an
+// invalid-request error in its place.
+func (a *AgentConn) checkVersion(idRaw, version json.RawMessage, data []byte) []byte {
+	if !a.hub.cfg.StrictJSONRPC {
+		return data
+	}
+	var v string
+	if json.Unmarshal(version, &v) == nil && v == "2.0" {
+		return data
+	}
+	a.hub.logger.Warn("rejecting response without jsonrpc 2.0", slog.String("server_id", a.serverID), slog.String("jsonrpc", string(version)))
+	resp, err := json.Marshal(JSONRPC{
+		JSONRPC: "2.0",
+		ID:      &idRaw,
+		Error:   json.RawMessage(`{"code":-32600,"message":"response jsonrpc version must be 2.0"}`),
+	})
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// schemaDigest hashes a schema's compacted plaintext, so the same document
+// matches whatever its whitespace and whether or not it is stored encrypted.
+func schemaDigest(schema json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, schema); err == nil {
+		schema = buf.Bytes()
+	}
+	sum := sha256.Sum256(schema)
+	return hex.EncodeToString(sum[:])
+}
+
+// storeSchema caches an rpc.discover document for serverID. The write is
+// skipped when the schema matches the last one this hub stored, or the
+// schema_sha256 another process left; ciphertexts differ on every seal, so
+// the plaintext digest is what is compared.
+func (h *Hub) storeSchema(ctx context.Context, serverID string, schema json.RawMessage) error {
+	digest := schemaDigest(schema)
+	h.mu.RLock()
+	unchanged := h.schemaDigests[serverID] == digest
+	h.mu.RUnlock()
+	if unchanged {
+		h.logger.Debug("schema unchanged", slog.String("server_id", serverID))
+		return nil
+	}
+
+	stored, err := h.cfg.Cipher.seal(schema, aadServerSchema)
+	if err != nil {
+		return fmt.Errorf("encrypt schema: %w", err)
+	}
+	dbCtx, cancel := withQueryTimeout(ctx, h.cfg.QueryTimeout)
+	defer cancel()
+	tag, err := h.db.Exec(dbCtx, "UPDATE servers SET schema_json = $1, schema_sha256 = $3 WHERE id = $2 AND schema_sha256 IS DISTINCT FROM $3", stored, serverID, digest)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		h.logger.Debug("schema unchanged", slog.String("server_id", serverID))
+	}
+	h.mu.Lock()
+	h.schemaDigests[serverID] = digest
+	h.mu.Unlock()
+	return nil
+}
+
+// invalidPayloadLogInterval is how often a server's invalid payload warning
+// may repeat; occurrences in between are only counted.
+const invalidPayloadLogInterval = time.Minute
+
+// logThrottle lets the first event through and then at most one per
+// interval, reporting how many were suppressed since the last one.
+type logThrottle struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed uint64
+}
+
+func (t *logThrottle) allow() (bool, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if !t.last.IsZero() && now.Sub(t.last) < invalidPayloadLogInterval {
+		t.suppressed++
+		return false, 0
+	}
+	suppressed := t.suppressed
+	t.last = now
+	t.suppressed = 0
+	return true, suppressed
+}
+
 func (a *AgentConn) failPending() {
 	a.pendMu.Lock()
-	for id, ch := range a.pending {
+	for id, p := range a.pending {
 		delete(a.pending, id)
-		select {
-		case ch <- nil:
-		default:
-		}
-		close(ch)
+		p.fail()
 	}
 	a.pendMu.Unlock()
 }
 
 type ClientConn struct {
-	conn    *websocket.Conn
-	writeMu sync.Mutex
+	conn     *websocket.Conn
+	role     Role
+	lastSeen atomic.Int64
+	writeMu  sync.Mutex
+	filterMu sync.RWMutex
+	filters  []string
+	// subToken is the subscription token this connection last saved or
+	// restored; later subscribes reuse it. Guarded by filterMu.
+	subToken string
+	// rpcSlots holds one token per RPC the client has in flight.
+	rpcSlots chan struct{}
+}
+
+// SetFilters limits the client to notifications whose method starts with one
+// of the given prefixes. An empty list receives everything.
+func (c *ClientConn) SetFilters(methods []string) {
+	c.filterMu.Lock()
+	c.filters = methods
+	c.filterMu.Unlock()
+}
+
+func (c *ClientConn) subscriptionToken() string {
+	c.filterMu.RLock()
+	defer c.filterMu.RUnlock()
+	return c.subToken
+}
+
+func (c *ClientConn) setSubscriptionToken(token string) {
+	c.filterMu.Lock()
+	c.subToken = token
+	c.filterMu.Unlock()
+}
+
+func (c *ClientConn) Wants(method string) bool {
+	c.filterMu.RLock()
+	defer c.filterMu.RUnlock()
+	if len(c.filters) == 0 {
+		return true
+	}
+	for _, prefix := range c.filters {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// touch records client activity for the idle timeout.
+func (c *ClientConn) touch() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// keepalive pings the client whenever it has been quiet for half the
+// timeout and returns an error once a ping goes unanswered. It returns nil
+// when ctx ends.
+func (c *ClientConn) keepalive(ctx context.Context, timeout time.Duration) error {
+	interval := timeout / 2
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, c.lastSeen.Load())) < interval {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := c.conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		c.touch()
+	}
 }
 
 func (c *ClientConn) Send(ctx context.Context, payload []byte) error {
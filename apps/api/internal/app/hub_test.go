@@ -0,0 +1,277 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"nhooyr.io/websocket"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// testApp returns an App whose queries are answered by db. Its audit writer
+// has no database, so tests should act as users with non-UUID ids, whose
+// audit entries are refused before they are queued.
+func testApp(t *testing.T, results map[string][][]any) *App {
+	a := NewApp(nil, Config{}, testLogger())
+	a.DB = &fakeDB{t: t, results: results}
+	a.ReadDB = a.DB
+	return a
+}
+
+// serverRequest builds a request for a /v1/servers/{id} route as the router
+// would pass it on: with the id URL parameter set and user authenticated.
+func serverRequest(t *testing.T, method, id, body string, user *AuthUser) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, "/v1/servers/"+id, strings.NewReader(body))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, contextKeyUser, user)
+	return req.WithContext(ctx)
+}
+
+// websocketPair returns the two ends of a live websocket: the one the API
+// accepted and the one that dialed it.
+func websocketPair(t *testing.T) (accepted, dialed *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	dialed, _, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted = <-conns
+	t.Cleanup(func() {
+		dialed.Close(websocket.StatusNormalClosure, "")
+		accepted.Close(websocket.StatusNormalClosure, "")
+	})
+	return accepted, dialed
+}
+
+func TestSchemaDigest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"identical", `{"methods":[{"name":"a"}]}`, `{"methods":[{"name":"a"}]}`, true},
+		{"whitespace only", `{"methods":[{"name":"a"}]}`, "{\n  \"methods\": [ {\"name\": \"a\"} ]\n}", true},
+		{"different method", `{"methods":[{"name":"a"}]}`, `{"methods":[{"name":"b"}]}`, false},
+		{"reordered keys", `{"a":1,"b":2}`, `{"b":2,"a":1}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schemaDigest(json.RawMessage(tt.a)) == schemaDigest(json.RawMessage(tt.b))
+			if got != tt.same {
+				t.Fatalf("digests equal = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
+
+// TestStoreSchemaUnchanged checks that rediscovering the stored schema is a
+// no-op. The hub has no database, so any write would panic.
+func TestStoreSchemaUnchanged(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	encrypted, err := ParseDataKeys("k1:" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := json.RawMessage(`{"methods":[{"name":"minecraft:players"}]}`)
+
+	tests := []struct {
+		name   string
+		cipher *DataCipher
+		send   json.RawMessage
+	}{
+		{"plaintext", nil, schema},
+		{"encrypted", encrypted, schema},
+		{"reformatted", encrypted, json.RawMessage("{ \"methods\": [ { \"name\": \"minecraft:players\" } ] }")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Hub{
+				logger:        testLogger(),
+				cfg:           HubConfig{Cipher: tt.cipher},
+				schemaDigests: map[string]string{"srv": schemaDigest(schema)},
+			}
+			if err := h.storeSchema(context.Background(), "srv", tt.send); err != nil {
+				t.Fatalf("storeSchema: %v", err)
+			}
+		})
+	}
+}
+
+func TestDrainCallsRefusesNewCalls(t *testing.T) {
+	h := NewHub(nil, HubConfig{}, testLogger())
+	if err := h.beginCall(); err != nil {
+		t.Fatalf("beginCall before drain: %v", err)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		h.DrainCalls(time.Minute)
+		close(drained)
+	}()
+
+	// Once draining, new calls are refused while the earlier one is still
+	// counted.
+	deadline := time.Now().Add(5 * time.Second)
+	for h.beginCall() == nil {
+		h.calls.Done()
+		if time.Now().After(deadline) {
+			t.Fatal("calls still accepted after DrainCalls started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-drained:
+		t.Fatal("DrainCalls returned with a call in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	h.calls.Done()
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DrainCalls did not return after the last call finished")
+	}
+
+	agent := &AgentConn{hub: h}
+	if _, err := agent.Call(context.Background(), JSONRPC{Method: "minecraft:players"}); !errors.Is(err, errDraining) {
+		t.Fatalf("Call after drain = %v, want errDraining", err)
+	}
+	if err := agent.CallStream(context.Background(), JSONRPC{Method: "minecraft:players"}, nil); !errors.Is(err, errDraining) {
+		t.Fatalf("CallStream after drain = %v, want errDraining", err)
+	}
+	if got := callErrorStatus(errDraining); got != http.StatusServiceUnavailable {
+		t.Fatalf("callErrorStatus(errDraining) = %d, want 503", got)
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		data       string
+		wantReject bool
+	}{
+		{"2.0", false, `{"jsonrpc":"2.0","id":1,"result":[]}`, false},
+		{"version-less", false, `{"id":1,"result":[]}`, false},
+		{"other version", false, `{"jsonrpc":"1.0","id":1,"result":[]}`, false},
+		{"strict 2.0", true, `{"jsonrpc":"2.0","id":1,"result":[]}`, false},
+		{"strict version-less", true, `{"id":1,"result":[]}`, true},
+		{"strict other version", true, `{"jsonrpc":"1.0","id":1,"result":[]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var env map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.data), &env); err != nil {
+				t.Fatal(err)
+			}
+			a := &AgentConn{serverID: "srv", hub: &Hub{logger: testLogger(), cfg: HubConfig{StrictJSONRPC: tt.strict}}}
+			got := a.checkVersion(env["id"], env["jsonrpc"], []byte(tt.data))
+			if !tt.wantReject {
+				if string(got) != tt.data {
+					t.Fatalf("response changed to %s", got)
+				}
+				return
+			}
+			var resp JSONRPC
+			if err := json.Unmarshal(got, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.JSONRPC != "2.0" || resp.ID == nil || string(*resp.ID) != "1" || !strings.Contains(string(resp.Error), "-32600") {
+				t.Fatalf("rejection = %s, want a -32600 error for id 1", got)
+			}
+		})
+	}
+}
+
+// TestCallIDGenerator drives calls through a fake agent that answers each
+// request with its own id as the result, so the ids are checked on the wire
+// and through response correlation.
+func TestCallIDGenerator(t *testing.T) {
+	hubSide, agentSide := websocketPair(t)
+	n := 0
+	h := NewHub(nil, HubConfig{NewCallID: func() string {
+		n++
+		return fmt.Sprintf("call-%d", n)
+	}}, testLogger())
+	a := newAgentConn(h, "srv", hubSide, nil)
+	go a.readLoop()
+	go func() {
+		ctx := context.Background()
+		for {
+			_, data, err := agentSide.Read(ctx)
+			if err != nil {
+				return
+			}
+			var req JSONRPC
+			if err := json.Unmarshal(data, &req); err != nil || req.ID == nil {
+				t.Errorf("agent got %s", data)
+				return
+			}
+			resp, _ := json.Marshal(JSONRPC{JSONRPC: "2.0", ID: req.ID, Result: *req.ID})
+			if err := agentSide.Write(ctx, websocket.MessageText, resp); err != nil {
+				return
+			}
+		}
+	}()
+
+	tests := []struct {
+		name   string
+		id     string
+		wantID string
+	}{
+		{"generated", "", `"call-1"`},
+		{"generated again", "", `"call-2"`},
+		{"caller id kept", `7`, `7`},
+		{"generator resumes", "", `"call-3"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := JSONRPC{Method: "minecraft:players"}
+			if tt.id != "" {
+				raw := json.RawMessage(tt.id)
+				frame.ID = &raw
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			data, err := a.Call(ctx, frame)
+			if err != nil {
+				t.Fatalf("Call: %v", err)
+			}
+			var resp JSONRPC
+			if err := json.Unmarshal(data, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ID == nil || string(*resp.ID) != tt.wantID || string(resp.Result) != tt.wantID {
+				t.Fatalf("response %s, want id %s", data, tt.wantID)
+			}
+		})
+	}
+}
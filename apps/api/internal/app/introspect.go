@@ -0,0 +1,113 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type introspectClaims struct {
+	Sub       string    `json:"sub"`
+	Role      Role      `json:"role"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+type introspectSession struct {
+	UserRole   Role       `json:"user_role"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// IdleExpiresAt is when SESSION_IDLE_TIMEOUT revokes the session if it
+	// stays unused; null when the idle timeout is off.
+	IdleExpiresAt *time.Time `json:"idle_expires_at"`
+}
+
+type introspectResponse struct {
+	// Active is whether authMiddleware would accept the token right now.
+	Active bool `json:"active"`
+	// Reason explains why an inactive token is rejected.
+	Reason  string             `json:"reason,omitempty"`
+	Claims  *introspectClaims  `json:"claims"`
+	Session *introspectSession `json:"session"`
+}
+
+// jwtKey is the jwt.Keyfunc for session tokens.
+func (a *App) jwtKey(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, errors.New("invalid signing method")
+	}
+	return a.jwtSecret, nil
+}
+
+// handleIntrospect reports how authMiddleware would judge the presented
+// token, for debugging unexpected 401s. It sits outside authMiddleware so
+// rejected tokens can be inspected, and unlike lookupSession it never
+// purges, revokes, or touches the session. Claims are shown only when the
+// signature verifies; the token and its hash are never echoed.
+func (a *App) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	token := extractTokenFromRequest(r)
+	if token == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var resp introspectResponse
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, a.jwtKey, jwt.WithoutClaimsValidation())
+	if err != nil || !parsed.Valid {
+		resp.Reason = "token is malformed or its signature does not verify"
+		a.writeJSON(w, resp)
+		return
+	}
+	resp.Claims = &introspectClaims{}
+	resp.Claims.Sub, _ = claims["sub"].(string)
+	if role, ok := claims["role"].(string); ok {
+		resp.Claims.Role = Role(role)
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		resp.Claims.ExpiresAt = exp.Time.UTC()
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	var (
+		userID  string
+		session introspectSession
+	)
+	err = a.DB.QueryRow(ctx, `SELECT s.user_id, u.role, s.expires_at, s.last_seen_at, s.revoked_at FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.token_hash = $1`, hashToken(token)).
+		Scan(&userID, &session.UserRole, &session.ExpiresAt, &session.LastSeenAt, &session.RevokedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		a.internalError(w, err)
+		return
+	}
+	if err == nil {
+		if a.sessionIdleTimeout > 0 {
+			idle := session.LastSeenAt.Add(a.sessionIdleTimeout)
+			session.IdleExpiresAt = &idle
+		}
+		resp.Session = &session
+	}
+
+	// Checks run in the order authMiddleware and lookupSession apply them.
+	switch {
+	case !resp.Claims.ExpiresAt.IsZero() && now.After(resp.Claims.ExpiresAt):
+		resp.Reason = "token exp has passed"
+	case resp.Session == nil:
+		resp.Reason = "no session exists for this token; it was logged out, pruned, or issued by another database"
+	case session.RevokedAt != nil:
+		resp.Reason = "session was revoked"
+	case now.After(session.ExpiresAt):
+		resp.Reason = "session expired"
+	case a.sessionIdleExpired(session.LastSeenAt, now):
+		resp.Reason = "session idle longer than SESSION_IDLE_TIMEOUT"
+	case resp.Claims.Sub != "" && !constantTimeEqual(resp.Claims.Sub, userID):
+		resp.Reason = "token sub does not match the session's user"
+	default:
+		resp.Active = true
+	}
+	a.writeJSON(w, resp)
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxCachedMethodsPerServer bounds the cache, since viewer rules match by
+// prefix and callers can invent method names under them.
+const maxCachedMethodsPerServer = 64
+
+type lastResponse struct {
+	Method     string          `json:"method"`
+	Response   json.RawMessage `json:"response"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// lastResponseCache keeps the most recent successful response for each
+// read-only method per server, for debugging without re-issuing calls.
+type lastResponseCache struct {
+	mu      sync.RWMutex
+	entries map[string]map[string]lastResponse
+}
+
+func newLastResponseCache() *lastResponseCache {
+	return &lastResponseCache{entries: make(map[string]map[string]lastResponse)}
+}
+
+func (c *lastResponseCache) remember(serverID, method string, resp []byte) {
+	if c == nil || roleForMethod(method) != RoleViewer || decodeJSONRPCError(resp) != nil {
+		return
+	}
+	entry := lastResponse{
+		Method:     method,
+		Response:   append(json.RawMessage(nil), resp...),
+		ReceivedAt: time.Now().UTC(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	byMethod, ok := c.entries[serverID]
+	if !ok {
+		byMethod = make(map[string]lastResponse)
+		c.entries[serverID] = byMethod
+	}
+	if _, exists := byMethod[method]; !exists && len(byMethod) >= maxCachedMethodsPerServer {
+		return
+	}
+	byMethod[method] = entry
+}
+
+func (c *lastResponseCache) get(serverID, method string) (lastResponse, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[serverID][method]
+	return entry, ok
+}
+
+func (a *App) handleLastRPCResponse(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	method := strings.TrimSpace(r.URL.Query().Get("method"))
+	if method == "" {
+		http.Error(w, "method required", http.StatusBadRequest)
+		return
+	}
+	if a.Hub.lastResponses == nil {
+		http.Error(w, "response cache disabled; set RPC_CACHE_LAST_RESPONSES=true", http.StatusNotFound)
+		return
+	}
+	entry, ok := a.Hub.lastResponses.get(serverID, method)
+	if !ok {
+		http.Error(w, "no cached response for method", http.StatusNotFound)
+		return
+	}
+	a.writeJSON(w, entry)
+}
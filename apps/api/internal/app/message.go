@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	systemMessageMethod = "minecraft:server/system_message"
+	maxSystemMessageLen = 1000
+)
+
+// playerNamePattern matches Java Edition usernames.
+var playerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,16}$`)
+
+type systemMessageRequest struct {
+	Message string `json:"message"`
+	Target  string `json:"target,omitempty"`
+}
+
+type systemMessagePlayer struct {
+	Name string `json:"name"`
+}
+
+type systemMessageParams struct {
+	Message struct {
+		Message struct {
+			Literal string `json:"literal"`
+		} `json:"message"`
+		Overlay          bool                  `json:"overlay"`
+		ReceivingPlayers []systemMessagePlayer `json:"receivingPlayers,omitempty"`
+	} `json:"message"`
+}
+
+type systemMessageResponse struct {
+	Result json.RawMessage `json:"result"`
+}
+
+// sanitizeSystemMessage drops control characters other than newlines and the
+// legacy section-sign formatting codes, so the text renders as typed.
+func sanitizeSystemMessage(msg string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '§' || (unicode.IsControl(r) && r != '\n') {
+			return -1
+		}
+		return r
+	}, msg)
+}
+
+func (a *App) handleSystemMessage(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req systemMessageRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message := strings.TrimSpace(sanitizeSystemMessage(req.Message))
+	if message == "" {
+		http.Error(w, "message required", http.StatusBadRequest)
+		return
+	}
+	if len(message) > maxSystemMessageLen {
+		http.Error(w, "message too long", http.StatusBadRequest)
+		return
+	}
+	target := strings.TrimSpace(req.Target)
+	if target != "" && !playerNamePattern.MatchString(target) {
+		http.Error(w, "target must be a player name of 3-16 letters, digits, or underscores", http.StatusBadRequest)
+		return
+	}
+
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+	// A nil agent with a remote owner is reached through the hub relay.
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	var p systemMessageParams
+	p.Message.Message.Literal = message
+	if target != "" {
+		p.Message.ReceivingPlayers = []systemMessagePlayer{{Name: target}}
+	}
+	params, err := json.Marshal(p)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.serverRPCTimeout(r.Context(), serverID))
+	defer cancel()
+
+	resp, err := a.Hub.call(ctx, serverID, agent, JSONRPC{Method: systemMessageMethod, Params: params})
+	if err == nil {
+		err = decodeJSONRPCError(resp)
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	// The default redaction rules mask the message text before storage.
+	a.recordAudit(r.Context(), user.ID, serverID, systemMessageMethod, params, status, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var env struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &env); err != nil {
+		http.Error(w, fmt.Sprintf("decode response: %v", err), http.StatusBadGateway)
+		return
+	}
+	a.writeJSON(w, systemMessageResponse{Result: env.Result})
+}
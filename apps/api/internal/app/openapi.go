@@ -0,0 +1,16 @@
+package app
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPIDocument describes every registered route; openapi_test.go fails
+// when a route is added without documenting it here.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+func (a *App) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	a.writeJSONRaw(w, openAPIDocument)
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestOpenAPICoversRoutes fails when a registered route or method is missing
+// from openapi.json, or when the document describes a route that no longer
+// exists.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPIDocument, &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+
+	app := NewApp(nil, Config{}, testLogger())
+	routes, ok := app.Router.(chi.Routes)
+	if !ok {
+		t.Fatalf("router %T does not expose its routes", app.Router)
+	}
+
+	registered := make(map[string]bool)
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if method == http.MethodOptions || method == http.MethodHead {
+			return nil
+		}
+		route = strings.ReplaceAll(route, "/*", "")
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		registered[route] = true
+		if _, ok := doc.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("%s %s is not documented in openapi.json", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path := range doc.Paths {
+		if !registered[path] {
+			t.Errorf("openapi.json documents %s, which is not registered", path)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// listPage is the ?v=2 envelope for list endpoints. Without v=2 they keep
+// returning bare arrays.
+type listPage[T any] struct {
+	Items []T `json:"items"`
+	// NextCursor is passed back as ?cursor= for the following page; it is
+	// null on the last one.
+	NextCursor *string `json:"next_cursor"`
+	HasMore    bool    `json:"has_more"`
+}
+
+// pageCursor marks the last row of a page. Every paginated list is ordered
+// newest first by a timestamp with the row id as tie-breaker, so the next
+// page is the rows strictly before it.
+type pageCursor struct {
+	At time.Time `json:"t"`
+	ID string    `json:"id"`
+}
+
+func (c pageCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" || c.At.IsZero() {
+		return pageCursor{}, errInvalidCursor
+	}
+	return c, nil
+}
+
+// wantsPage reports whether the caller asked for the listPage envelope.
+func wantsPage(r *http.Request) bool {
+	return r.URL.Query().Get("v") == "2"
+}
+
+// pageParams reads ?limit= and ?cursor= for an enveloped list. The limit is
+// clamped like the bare lists clamp theirs; cursor is nil on the first page.
+func pageParams(r *http.Request) (int, *pageCursor, error) {
+	limit := defaultPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			limit = min(max(parsed, 1), maxPageSize)
+		}
+	}
+	raw := r.URL.Query().Get("cursor")
+	if raw == "" {
+		return limit, nil, nil
+	}
+	c, err := decodePageCursor(raw)
+	if err != nil {
+		return 0, nil, err
+	}
+	return limit, &c, nil
+}
+
+// newListPage builds the envelope from up to limit+1 rows; the extra row
+// only signals that another page exists.
+func newListPage[T any](items []T, limit int, cursorOf func(T) pageCursor) listPage[T] {
+	p := listPage[T]{Items: items}
+	if p.Items == nil {
+		p.Items = []T{}
+	}
+	if len(p.Items) > limit {
+		p.Items = p.Items[:limit]
+		p.HasMore = true
+		next := cursorOf(p.Items[limit-1]).encode()
+		p.NextCursor = &next
+	}
+	return p
+}
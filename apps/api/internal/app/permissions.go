@@ -0,0 +1,134 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type methodPermission struct {
+	// Method is an RBAC rule prefix; it may name one method or a family.
+	Method       string `json:"method"`
+	RequiredRole Role   `json:"required_role"`
+	// Allowlisted is false when the RPC allowlist in effect blocks every
+	// method under Method.
+	Allowlisted bool `json:"allowlisted"`
+	Allowed     bool `json:"allowed"`
+}
+
+type actionPermission struct {
+	RequiredRole Role `json:"required_role"`
+	Allowed      bool `json:"allowed"`
+}
+
+type permissionsResponse struct {
+	ServerID string             `json:"server_id"`
+	Role     Role               `json:"role"`
+	Methods  []methodPermission `json:"methods"`
+	// Other is the requirement for methods no rule above matches.
+	Other   methodPermission            `json:"other"`
+	Actions map[string]actionPermission `json:"actions"`
+}
+
+// callableBy reports whether role may call method through the API given the
+// effective allowlist patterns. Raw commands go through their own endpoint,
+// which has its own minimum role and skips the allowlist.
+func (a *App) callableBy(role Role, patterns []string, method string) bool {
+	if method == commandMethod {
+		return role.Meets(a.commandRole)
+	}
+	return methodAllowed(patterns, method) && role.Meets(roleForMethod(method))
+}
+
+// allowlistCovers reports whether patterns allow at least one method whose
+// name starts with prefix.
+func allowlistCovers(patterns []string, prefix string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if p, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(prefix, p) || strings.HasPrefix(p, prefix) {
+				return true
+			}
+		} else if strings.HasPrefix(pattern, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleServerPermissions reports what the caller's role may do on a server
+// so clients can hide controls up front. It only evaluates RBAC, the RPC
+// allowlist, and the per-server command switch; it never calls the agent.
+func (a *App) handleServerPermissions(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := uuid.Parse(serverID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var commandsEnabled bool
+	ctx, cancel := a.queryContext(r.Context())
+	err := a.DB.QueryRow(ctx, `SELECT commands_enabled FROM servers WHERE id = $1`, serverID).Scan(&commandsEnabled)
+	cancel()
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	patterns, err := a.effectiveAllowlist(r.Context(), serverID)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	permission := func(method string, role Role) methodPermission {
+		allowlisted := allowlistCovers(patterns, method)
+		return methodPermission{
+			Method:       method,
+			RequiredRole: role,
+			Allowlisted:  allowlisted,
+			Allowed:      allowlisted && user.Role.Meets(role),
+		}
+	}
+
+	resp := permissionsResponse{
+		ServerID: serverID,
+		Role:     user.Role,
+		Methods:  make([]methodPermission, 0, len(rbacRules)),
+		Other:    permission("", RoleOwner),
+		Actions:  make(map[string]actionPermission),
+	}
+	for _, rule := range rbacRules {
+		resp.Methods = append(resp.Methods, permission(rule.prefix, rule.role))
+	}
+
+	action := func(name string, role Role, extra bool) {
+		resp.Actions[name] = actionPermission{RequiredRole: role, Allowed: extra && user.Role.Meets(role)}
+	}
+	action("command", a.commandRole, commandsEnabled)
+	action("console", RoleModerator, true)
+	action("message", roleForMethod(systemMessageMethod), true)
+	action("announce", RoleModerator, true)
+	action("gamerule_presets", RoleModerator, true)
+	action("schema_probe", RoleModerator, true)
+	action("agent_logs", RoleModerator, true)
+	action("audit_tail", RoleModerator, true)
+	action("manage", RoleOwner, true)
+
+	a.writeJSON(w, resp)
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const discoverMethod = "rpc.discover"
+
+type schemaProbeResponse struct {
+	OK        bool    `json:"ok"`
+	LatencyMS float64 `json:"latency_ms"`
+	Methods   int     `json:"methods"`
+	Persisted bool    `json:"persisted"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// handleSchemaProbe runs rpc.discover through the agent now and reports how
+// long the round trip took. A failed probe is still a 200; the result is in
+// the body. The schema is only stored when persist=true.
+func (a *App) handleSchemaProbe(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	persist := false
+	if raw := r.URL.Query().Get("persist"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "invalid persist", http.StatusBadRequest)
+			return
+		}
+		persist = v
+	}
+
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+	// A nil agent with a remote owner is reached through the hub relay.
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.serverRPCTimeout(r.Context(), serverID))
+	defer cancel()
+
+	started := time.Now()
+	resp, err := a.Hub.call(ctx, serverID, agent, JSONRPC{Method: discoverMethod, Params: json.RawMessage("[]")})
+	latency := time.Since(started)
+	if err == nil {
+		err = decodeJSONRPCError(resp)
+	}
+
+	var result json.RawMessage
+	if err == nil {
+		var env struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if jsonErr := json.Unmarshal(resp, &env); jsonErr != nil || len(env.Result) == 0 {
+			err = errors.New("response has no result")
+		}
+		result = env.Result
+	}
+
+	out := schemaProbeResponse{OK: err == nil, LatencyMS: float64(latency.Microseconds()) / 1000}
+	if err == nil {
+		var doc struct {
+			Methods []json.RawMessage `json:"methods"`
+		}
+		_ = json.Unmarshal(result, &doc)
+		out.Methods = len(doc.Methods)
+		if persist {
+			if err = a.Hub.storeSchema(r.Context(), serverID, result); err != nil {
+				a.internalError(w, err)
+				return
+			}
+			out.Persisted = true
+		}
+	} else {
+		out.Error = err.Error()
+	}
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	a.recordAudit(r.Context(), user.ID, serverID, discoverMethod, nil, status, err)
+	a.writeJSON(w, out)
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var errAgentOwnerLimit = errors.New("agent connection quota reached for this server's owner")
+
+// quotaExceededResponse is the body of a request refused by a per-owner
+// quota. Quota is "servers" or "agent_connections".
+type quotaExceededResponse struct {
+	Error   string `json:"error"`
+	Quota   string `json:"quota"`
+	OwnerID string `json:"owner_id"`
+	Limit   int    `json:"limit"`
+	Used    int    `json:"used"`
+}
+
+type serverQuotaError struct {
+	used, limit int
+}
+
+func (e *serverQuotaError) Error() string {
+	return fmt.Sprintf("server quota reached (%d of %d)", e.used, e.limit)
+}
+
+func (a *App) writeQuotaExceeded(w http.ResponseWriter, status int, quota, ownerID string, used, limit int) {
+	a.writeJSONStatus(w, status, quotaExceededResponse{
+		Error:   "quota_exceeded",
+		Quota:   quota,
+		OwnerID: ownerID,
+		Limit:   limit,
+		Used:    used,
+	})
+}
+
+// checkServerQuota fails with *serverQuotaError when ownerID already has
+// maxServersPerOwner servers. It locks the owner's user row for the rest of
+// tx, so concurrent creates by one owner are counted one at a time.
+func (a *App) checkServerQuota(ctx context.Context, tx pgx.Tx, ownerID string) error {
+	if a.maxServersPerOwner <= 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, ownerID); err != nil {
+		return err
+	}
+	var used int
+	if err := tx.QueryRow(ctx, `SELECT count(*) FROM servers WHERE owner_id = $1`, ownerID).Scan(&used); err != nil {
+		return err
+	}
+	if used >= a.maxServersPerOwner {
+		return &serverQuotaError{used: used, limit: a.maxServersPerOwner}
+	}
+	return nil
+}
+
+// acquireOwnerAgentSlot reserves a connection for serverID's agent against
+// its owner's quota. Quotas count servers with a connected agent, so a
+// reconnect that briefly overlaps the server's old socket always fits.
+// Servers without an owner are not counted.
+func (h *Hub) acquireOwnerAgentSlot(ownerID, serverID string) (int, error) {
+	if ownerID == "" {
+		return 0, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	servers := h.ownerAgents[ownerID]
+	if _, ok := servers[serverID]; !ok && h.cfg.MaxAgentsPerOwner > 0 && len(servers) >= h.cfg.MaxAgentsPerOwner {
+		h.ownerRejected++
+		return len(servers), errAgentOwnerLimit
+	}
+	if servers == nil {
+		servers = make(map[string]int)
+		h.ownerAgents[ownerID] = servers
+	}
+	servers[serverID]++
+	return len(servers), nil
+}
+
+func (h *Hub) releaseOwnerAgentSlot(ownerID, serverID string) {
+	if ownerID == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	servers := h.ownerAgents[ownerID]
+	if servers[serverID] <= 1 {
+		delete(servers, serverID)
+	} else {
+		servers[serverID]--
+	}
+	if len(servers) == 0 {
+		delete(h.ownerAgents, ownerID)
+	}
+}
+
+func (h *Hub) ownerAgentCounts() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	counts := make(map[string]int, len(h.ownerAgents))
+	for owner, servers := range h.ownerAgents {
+		counts[owner] = len(servers)
+	}
+	return counts
+}
+
+// ownerQuotaUsage reports one owner's usage. Max values are null when the
+// quota is off. Agent connections are those held by this API instance.
+type ownerQuotaUsage struct {
+	OwnerID         string `json:"owner_id"`
+	Email           string `json:"email"`
+	Servers         int    `json:"servers"`
+	MaxServers      *int   `json:"max_servers"`
+	AgentsConnected int    `json:"agents_connected"`
+	MaxAgents       *int   `json:"max_agents"`
+}
+
+// handleQuotaUsage lists every owner, and every other user who still owns
+// servers, with their current usage.
+func (a *App) handleQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	rows, err := a.DB.Query(ctx, `SELECT u.id, u.email, count(s.id) FROM users u
+		LEFT JOIN servers s ON s.owner_id = u.id
+		GROUP BY u.id
+		HAVING u.role = 'owner' OR count(s.id) > 0
+		ORDER BY u.email`)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var maxServers, maxAgents *int
+	if a.maxServersPerOwner > 0 {
+		maxServers = &a.maxServersPerOwner
+	}
+	if a.Hub.cfg.MaxAgentsPerOwner > 0 {
+		maxAgents = &a.Hub.cfg.MaxAgentsPerOwner
+	}
+	agents := a.Hub.ownerAgentCounts()
+
+	list := []ownerQuotaUsage{}
+	for rows.Next() {
+		item := ownerQuotaUsage{MaxServers: maxServers, MaxAgents: maxAgents}
+		if err := rows.Scan(&item.OwnerID, &item.Email, &item.Servers); err != nil {
+			a.internalError(w, err)
+			return
+		}
+		item.AgentsConnected = agents[item.OwnerID]
+		list = append(list, item)
+	}
+	if err := rows.Err(); err != nil {
+		a.internalError(w, err)
+		return
+	}
+	a.writeJSON(w, list)
+}
+
+// rejectServerQuota answers a create or import refused by checkServerQuota
+// and reports whether err was such a refusal.
+func (a *App) rejectServerQuota(w http.ResponseWriter, ownerID string, err error) bool {
+	var quotaErr *serverQuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	a.Logger.Info("server quota reached", slog.String("owner_id", ownerID), slog.Int("limit", quotaErr.limit))
+	a.writeQuotaExceeded(w, http.StatusForbidden, "servers", ownerID, quotaErr.used, quotaErr.limit)
+	return true
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimiterEntries caps the keys one limiter tracks. Once full, new
+// keys are refused until old windows expire, so a flood of addresses cannot
+// grow the map without bound.
+const maxRateLimiterEntries = 10000
+
+// rateLimiter is a fixed-window limiter keyed by client IP. It is meant for
+// low-volume endpoints that must not become credential oracles.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		entries: make(map[string]*rateWindow),
+	}
+}
+
+// allow records a hit for key and reports whether it is within the limit,
+// along with how long the caller should wait when it is not.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l == nil || l.limit <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if ok && now.Sub(entry.start) >= l.window {
+		entry.start, entry.count = now, 0
+	}
+	if !ok {
+		if now.Sub(l.lastSweep) >= l.window {
+			l.sweepLocked(now)
+		}
+		if len(l.entries) >= maxRateLimiterEntries {
+			return false, l.window
+		}
+		l.entries[key] = &rateWindow{start: now, count: 1}
+		return true, 0
+	}
+	if entry.count >= l.limit {
+		return false, l.window - now.Sub(entry.start)
+	}
+	entry.count++
+	return true, 0
+}
+
+// sweepLocked drops expired windows. It runs at most once per window, so
+// a hit costs O(1) on average.
+func (l *rateLimiter) sweepLocked(now time.Time) {
+	l.lastSweep = now
+	for k, entry := range l.entries {
+		if now.Sub(entry.start) >= l.window {
+			delete(l.entries, k)
+		}
+	}
+}
+
+func (l *rateLimiter) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return l.middlewareBy(func(r *http.Request) []string {
+		return []string{clientIP(r)}
+	}, next)
+}
+
+// middlewareBy limits each key returned by keys separately; a request is
+// refused when any of them is over the limit.
+func (l *rateLimiter) middlewareBy(keys func(*http.Request) []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range keys(r) {
+			if ok, retry := l.allow(key); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
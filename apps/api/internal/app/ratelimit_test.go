@@ -0,0 +1,70 @@
+package app
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		hits  []string
+		want  []bool
+	}{
+		{"disabled", 0, []string{"a", "a", "a"}, []bool{true, true, true}},
+		{"within limit", 2, []string{"a", "a"}, []bool{true, true}},
+		{"over limit", 2, []string{"a", "a", "a"}, []bool{true, true, false}},
+		{"keys are separate", 1, []string{"a", "b", "a"}, []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.limit, time.Minute)
+			for i, key := range tt.hits {
+				if got, _ := l.allow(key); got != tt.want[i] {
+					t.Fatalf("hit %d (%s) allowed = %v, want %v", i, key, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterWindowExpiry(t *testing.T) {
+	l := newRateLimiter(1, time.Minute)
+	if ok, _ := l.allow("a"); !ok {
+		t.Fatal("first hit refused")
+	}
+	if ok, retry := l.allow("a"); ok || retry <= 0 {
+		t.Fatalf("second hit = %v, retry %v; want refused with a retry", ok, retry)
+	}
+	l.entries["a"].start = time.Now().Add(-2 * time.Minute)
+	if ok, _ := l.allow("a"); !ok {
+		t.Fatal("hit after the window refused")
+	}
+}
+
+func TestRateLimiterBounded(t *testing.T) {
+	l := newRateLimiter(1, time.Minute)
+	for i := 0; i < maxRateLimiterEntries; i++ {
+		l.allow(strconv.Itoa(i))
+	}
+	if ok, _ := l.allow("one too many"); ok {
+		t.Fatal("new key accepted with the limiter full")
+	}
+	if len(l.entries) != maxRateLimiterEntries {
+		t.Fatalf("entries = %d, want %d", len(l.entries), maxRateLimiterEntries)
+	}
+
+	// Expired windows are swept on the next periodic pass, making room.
+	for _, entry := range l.entries {
+		entry.start = time.Now().Add(-2 * time.Minute)
+	}
+	l.lastSweep = time.Now().Add(-2 * time.Minute)
+	if ok, _ := l.allow("one too many"); !ok {
+		t.Fatal("new key refused after old windows expired")
+	}
+	if len(l.entries) != 1 {
+		t.Fatalf("entries after sweep = %d, want 1", len(l.entries))
+	}
+}
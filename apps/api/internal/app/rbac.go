@@ -7,11 +7,14 @@ type rbacRule struct {
 	role   Role
 }
 
+// rbacRules is matched in order. The agent keeps a copy for its optional
+// method policy (defaultMethodRules in mc-agent); update both together.
 var rbacRules = []rbacRule{
 	{prefix: "minecraft:server/stop", role: RoleOwner},
 	{prefix: "minecraft:server/save", role: RoleModerator},
 	{prefix: "minecraft:server/system_message", role: RoleModerator},
 	{prefix: "minecraft:server/status", role: RoleViewer},
+	{prefix: "minecraft:server/console", role: RoleModerator},
 	{prefix: "minecraft:players/", role: RoleModerator},
 	{prefix: "minecraft:players", role: RoleViewer},
 	{prefix: "minecraft:gamerules/update", role: RoleModerator},
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"addresses and ranges", " 127.0.0.1, 10.0.0.0/8 ,::1,", 3, false},
+		{"bad address", "proxy.internal", 0, true},
+		{"bad range", "10.0.0.0/40", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTrustedProxies(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("got %d ranges, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIPMiddleware(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8,127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		trusted bool
+		peer    string
+		xff     []string
+		realIP  string
+		want    string
+	}{
+		{"no proxies configured", false, "203.0.113.7:4000", []string{"198.51.100.1"}, "", "203.0.113.7"},
+		{"untrusted peer spoofing xff", true, "203.0.113.7:4000", []string{"198.51.100.1"}, "", "203.0.113.7"},
+		{"untrusted peer spoofing x-real-ip", true, "203.0.113.7:4000", nil, "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy without headers", true, "10.1.2.3:4000", nil, "", "10.1.2.3"},
+		{"trusted proxy xff", true, "10.1.2.3:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"client-supplied prefix ignored", true, "10.1.2.3:4000", []string{"192.0.2.9, 198.51.100.1"}, "", "198.51.100.1"},
+		{"trusted hops skipped", true, "10.1.2.3:4000", []string{"198.51.100.1, 10.9.9.9", "127.0.0.1"}, "", "198.51.100.1"},
+		{"all hops trusted", true, "10.1.2.3:4000", []string{"10.9.9.9"}, "", "10.9.9.9"},
+		{"garbage hop", true, "10.1.2.3:4000", []string{"198.51.100.1, not-an-ip"}, "", "10.1.2.3"},
+		{"trusted proxy x-real-ip", true, "127.0.0.1:4000", nil, "198.51.100.1", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if !tt.trusted {
+				proxies = nil
+			}
+			var got string
+			handler := realIPMiddleware(proxies)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Fatalf("client ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAgentIPCapIgnoresSpoofedHeaders fills the agent connection cap for one
+// address and checks that forged forwarding headers do not get around it.
+// Every case is refused before the token lookup, so no database is needed.
+func TestAgentIPCapIgnoresSpoofedHeaders(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		full string
+		peer string
+		xff  string
+	}{
+		{"direct client", "203.0.113.7", "203.0.113.7:4000", ""},
+		{"direct client forging xff", "203.0.113.7", "203.0.113.7:4000", "198.51.100.1"},
+		{"client behind proxy", "198.51.100.1", "10.1.2.3:4000", "198.51.100.1"},
+		{"client behind proxy forging a prefix", "198.51.100.1", "10.1.2.3:4000", "192.0.2.9, 198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewApp(nil, Config{MaxAgentsPerIP: 1, TrustedProxies: trusted}, testLogger())
+			if err := a.Hub.acquireAgentIPSlot(tt.full); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/agent/connect", nil)
+			req.RemoteAddr = tt.peer
+			req.Header.Set("Authorization", "Bearer agent-token")
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rec := httptest.NewRecorder()
+			a.Router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want 429", rec.Code)
+			}
+			if got := a.Hub.AgentStats().IPRejected; got != 1 {
+				t.Fatalf("ip_rejected_total = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type panicErrorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// recoverMiddleware replaces chi's Recoverer: the panic and its stack go to
+// the app logger, while the client only gets a JSON 500 carrying the request
+// id to quote when reporting it.
+func (a *App) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			requestID := middleware.GetReqID(r.Context())
+			a.Logger.Error("panic serving request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("request_id", requestID),
+				slog.String("panic", fmt.Sprint(rec)),
+				slog.String("stack", string(debug.Stack())),
+			)
+			// A hijacked WebSocket connection has no HTTP response to write.
+			if r.Header.Get("Connection") == "Upgrade" {
+				return
+			}
+			a.writeJSONStatus(w, http.StatusInternalServerError, panicErrorResponse{
+				Error:     "internal server error",
+				RequestID: requestID,
+			})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
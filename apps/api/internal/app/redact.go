@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const redactedPlaceholder = "[redacted]"
+
+// RedactionRule masks part of an RPC's params before they are stored in the
+// audit log. Key matches an object key at any depth; Path matches a dotted
+// path from the root. Arrays are traversed transparently in both cases.
+type RedactionRule struct {
+	// Method limits the rule to methods with this prefix; empty matches all.
+	Method string
+	Key    string
+	Path   []string
+}
+
+var defaultRedactionRules = []RedactionRule{
+	{Method: "minecraft:server/system_message", Key: "message"},
+}
+
+// ParseRedactionRules builds rules from comma-separated key names and dotted
+// paths, e.g. keys "reason,message" and paths "gamerule.value".
+func ParseRedactionRules(keys, paths string) []RedactionRule {
+	var rules []RedactionRule
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		rules = append(rules, RedactionRule{Key: key})
+	}
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.Trim(strings.TrimSpace(path), ".")
+		if path == "" {
+			continue
+		}
+		rules = append(rules, RedactionRule{Path: strings.Split(path, ".")})
+	}
+	return rules
+}
+
+// redactParams returns params with every value matched by rules replaced by a
+// placeholder. The structure is preserved so entries remain useful when
+// debugging. Params that are not valid JSON are dropped entirely.
+func redactParams(method string, params json.RawMessage, rules []RedactionRule) json.RawMessage {
+	if len(params) == 0 {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(params, &doc); err != nil {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if rule.Method != "" && !strings.HasPrefix(method, rule.Method) {
+			continue
+		}
+		if rule.Key != "" {
+			doc = redactKey(doc, rule.Key)
+		}
+		if len(rule.Path) > 0 {
+			doc = redactPath(doc, rule.Path)
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func redactKey(node any, key string) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if k == key {
+				v[k] = redactedPlaceholder
+				continue
+			}
+			v[k] = redactKey(child, key)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = redactKey(child, key)
+		}
+		return v
+	default:
+		return node
+	}
+}
+
+func redactPath(node any, path []string) any {
+	switch v := node.(type) {
+	case map[string]any:
+		child, ok := v[path[0]]
+		if !ok {
+			return v
+		}
+		if len(path) == 1 {
+			v[path[0]] = redactedPlaceholder
+			return v
+		}
+		v[path[0]] = redactPath(child, path[1:])
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = redactPath(child, path)
+		}
+		return v
+	default:
+		return node
+	}
+}
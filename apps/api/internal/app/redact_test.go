@@ -0,0 +1,115 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRedactParams(t *testing.T) {
+	custom := ParseRedactionRules("reason", "gamerule.value,players.name")
+	rules := append(append([]RedactionRule{}, defaultRedactionRules...), custom...)
+
+	tests := []struct {
+		name   string
+		method string
+		params string
+		want   string
+	}{
+		{
+			name:   "system message field",
+			method: "minecraft:server/system_message",
+			params: `{"message":{"literal":"hi"},"overlay":false}`,
+			want:   `{"message":"[redacted]","overlay":false}`,
+		},
+		{
+			name:   "message kept for other methods",
+			method: "minecraft:players/kick",
+			params: `[{"message":"bye"}]`,
+			want:   `[{"message":"bye"}]`,
+		},
+		{
+			name:   "key at any depth",
+			method: "minecraft:bans/add",
+			params: `[{"player":{"name":"alex"},"details":{"reason":"spam"}}]`,
+			want:   `[{"player":{"name":"alex"},"details":{"reason":"[redacted]"}}]`,
+		},
+		{
+			name:   "nested path",
+			method: "minecraft:gamerules/update",
+			params: `{"gamerule":{"key":"keepInventory","value":true}}`,
+			want:   `{"gamerule":{"key":"keepInventory","value":"[redacted]"}}`,
+		},
+		{
+			name:   "path through array",
+			method: "minecraft:allowlist/add",
+			params: `{"players":[{"name":"alex","id":"1"},{"name":"sam"}]}`,
+			want:   `{"players":[{"id":"1","name":"[redacted]"},{"name":"[redacted]"}]}`,
+		},
+		{
+			name:   "path only from root",
+			method: "minecraft:allowlist/add",
+			params: `{"batch":{"players":[{"name":"alex"}]}}`,
+			want:   `{"batch":{"players":[{"name":"alex"}]}}`,
+		},
+		{
+			name:   "no match",
+			method: "minecraft:players",
+			params: `[]`,
+			want:   `[]`,
+		},
+		{
+			name:   "invalid json dropped",
+			method: "minecraft:players",
+			params: `{`,
+			want:   ``,
+		},
+		{
+			name:   "empty",
+			method: "minecraft:players",
+			params: ``,
+			want:   ``,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactParams(tt.method, json.RawMessage(tt.params), rules)
+			if tt.want == "" {
+				if got != nil {
+					t.Fatalf("got %s, want nil", got)
+				}
+				return
+			}
+			var gotDoc, wantDoc any
+			if err := json.Unmarshal(got, &gotDoc); err != nil {
+				t.Fatalf("invalid output %s: %v", got, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantDoc); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotDoc, wantDoc) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRedactionRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		keys, paths string
+		want        []RedactionRule
+	}{
+		{"empty", "", "", nil},
+		{"keys", " reason , ,message", "", []RedactionRule{{Key: "reason"}, {Key: "message"}}},
+		{"paths", "", "gamerule.value, .players.name.", []RedactionRule{{Path: []string{"gamerule", "value"}}, {Path: []string{"players", "name"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseRedactionRules(tt.keys, tt.paths)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// relayHeartbeat is how often an instance refreshes its hub_instances
+	// row; one not refreshed within relayInstanceTTL is treated as gone.
+	relayHeartbeat   = 10 * time.Second
+	relayInstanceTTL = 30 * time.Second
+	// relayMessageTTL bounds how long an undelivered hub_relay row is kept,
+	// e.g. when its target died before reading it.
+	relayMessageTTL = 5 * time.Minute
+	// relayDefaultTimeout applies to forwarded calls whose caller set no
+	// deadline.
+	relayDefaultTimeout = defaultRPCTimeout
+)
+
+var errRelayStopped = errors.New("hub relay stopped")
+
+// relayMessage is the body of a hub_relay row. Calls and notifications
+// travel from the instance serving the request to the instance holding the
+// agent; results travel back, matched by Ref.
+type relayMessage struct {
+	Kind      string          `json:"kind"`
+	Ref       string          `json:"ref"`
+	ReplyTo   string          `json:"reply_to,omitempty"`
+	ServerID  string          `json:"server_id,omitempty"`
+	Frame     *JSONRPC        `json:"frame,omitempty"`
+	TimeoutMs int64           `json:"timeout_ms,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode string          `json:"error_code,omitempty"`
+}
+
+type relayStats struct {
+	InstanceID string `json:"instance_id"`
+	// Forwarded counts calls sent to another instance's agent; Served
+	// counts calls this instance ran for another; Failed counts forwarded
+	// calls that got no result.
+	Forwarded uint64 `json:"forwarded_total"`
+	Served    uint64 `json:"served_total"`
+	Failed    uint64 `json:"failed_total"`
+}
+
+// hubRelay lets API instances that share a database reach each other's
+// agents. Each instance LISTENs on its own channel; a message is inserted
+// into hub_relay and its id sent with pg_notify, since NOTIFY payloads are
+// limited to 8000 bytes. servers.agent_instance records which instance
+// holds each agent, and hub_instances heartbeats let the others ignore
+// routes left by an instance that died.
+type hubRelay struct {
+	hub     *Hub
+	id      string
+	channel string
+	ctx     context.Context
+	stop    context.CancelFunc
+	done    chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]chan relayMessage
+	seq     atomic.Uint64
+
+	forwarded atomic.Uint64
+	served    atomic.Uint64
+	failed    atomic.Uint64
+}
+
+func newHubRelay(hub *Hub) *hubRelay {
+	id := uuid.NewString()
+	ctx, stop := context.WithCancel(context.Background())
+	return &hubRelay{
+		hub:     hub,
+		id:      id,
+		channel: relayChannel(id),
+		ctx:     ctx,
+		stop:    stop,
+		done:    make(chan struct{}),
+		pending: make(map[string]chan relayMessage),
+	}
+}
+
+func relayChannel(instanceID string) string {
+	return "conduit_relay_" + strings.ReplaceAll(instanceID, "-", "")
+}
+
+// run heartbeats and listens until Close, reconnecting the listener after
+// errors.
+func (r *hubRelay) run() {
+	defer close(r.done)
+	go r.heartbeatLoop()
+
+	backoff := time.Second
+	for {
+		err := r.listen()
+		if r.ctx.Err() != nil {
+			return
+		}
+		r.hub.logger.Warn("hub relay listener failed; retrying", slog.Duration("backoff", backoff), slog.Any("err", err))
+		select {
+		case <-time.After(backoff):
+		case <-r.ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, relayInstanceTTL)
+	}
+}
+
+func (r *hubRelay) heartbeatLoop() {
+	ticker := time.NewTicker(relayHeartbeat)
+	defer ticker.Stop()
+	for {
+		r.heartbeat()
+		select {
+		case <-ticker.C:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *hubRelay) heartbeat() {
+	ctx, cancel := withQueryTimeout(r.ctx, r.hub.cfg.QueryTimeout)
+	defer cancel()
+	if _, err := r.hub.db.Exec(ctx, `INSERT INTO hub_instances (id, seen_at) VALUES ($1, now()) ON CONFLICT (id) DO UPDATE SET seen_at = now()`, r.id); err != nil {
+		r.hub.logger.Warn("hub relay heartbeat failed", slog.Any("err", err))
+		return
+	}
+	if _, err := r.hub.db.Exec(ctx, `DELETE FROM hub_relay WHERE created_at < now() - make_interval(secs => $1)`, relayMessageTTL.Seconds()); err != nil {
+		r.hub.logger.Warn("failed to prune hub relay messages", slog.Any("err", err))
+	}
+}
+
+// listen holds a dedicated connection on the instance's channel. The
+// connection is taken out of the pool so the LISTEN never leaks to other
+// queries.
+func (r *hubRelay) listen() error {
+	pooled, err := r.hub.db.Acquire(r.ctx)
+	if err != nil {
+		return err
+	}
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(r.ctx, "LISTEN "+pgx.Identifier{r.channel}.Sanitize()); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(r.ctx)
+		if err != nil {
+			return err
+		}
+		id, err := strconv.ParseInt(n.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		go r.receive(id)
+	}
+}
+
+// receive claims a message addressed to this instance and acts on it.
+func (r *hubRelay) receive(id int64) {
+	ctx, cancel := withQueryTimeout(r.ctx, r.hub.cfg.QueryTimeout)
+	var body []byte
+	err := r.hub.db.QueryRow(ctx, `DELETE FROM hub_relay WHERE id = $1 AND target = $2 RETURNING body`, id, r.id).Scan(&body)
+	cancel()
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			r.hub.logger.Warn("failed to read hub relay message", slog.Int64("id", id), slog.Any("err", err))
+		}
+		return
+	}
+	var msg relayMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		r.hub.logger.Warn("invalid hub relay message", slog.Int64("id", id), slog.Any("err", err))
+		return
+	}
+
+	switch msg.Kind {
+	case "result":
+		r.mu.Lock()
+		ch, ok := r.pending[msg.Ref]
+		delete(r.pending, msg.Ref)
+		r.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case "call", "notify":
+		r.serve(msg)
+	}
+}
+
+// serve runs a forwarded call on the local agent and sends back the result.
+func (r *hubRelay) serve(msg relayMessage) {
+	r.served.Add(1)
+	result := relayMessage{Kind: "result", Ref: msg.Ref}
+	timeout := time.Duration(msg.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = relayDefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
+	defer cancel()
+
+	var err error
+	agent := r.hub.AgentFor(msg.ServerID)
+	switch {
+	case agent == nil || msg.Frame == nil:
+		err = errAgentDisconnected
+	case msg.Kind == "notify":
+		err = agent.Notify(ctx, *msg.Frame)
+	default:
+		result.Response, err = agent.Call(ctx, *msg.Frame)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorCode = relayErrorCode(err)
+	}
+
+	// The reply gets its own budget so a call that used up its timeout
+	// can still report that.
+	replyCtx, cancelReply := withQueryTimeout(r.ctx, r.hub.cfg.QueryTimeout)
+	defer cancelReply()
+	if err := r.send(replyCtx, msg.ReplyTo, result); err != nil {
+		r.hub.logger.Warn("failed to return hub relay result", slog.String("server_id", msg.ServerID), slog.Any("err", err))
+	}
+}
+
+func (r *hubRelay) send(ctx context.Context, target string, msg relayMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = r.hub.db.Exec(ctx, `WITH m AS (INSERT INTO hub_relay (target, body) VALUES ($1, $2) RETURNING id) SELECT pg_notify($3, m.id::text) FROM m`, target, body, relayChannel(target))
+	return err
+}
+
+// owner returns the live instance, other than this one, that holds the
+// agent for serverID and when the agent connected to it, or "" when there
+// is none.
+func (r *hubRelay) owner(ctx context.Context, serverID string) (string, time.Time, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.hub.cfg.QueryTimeout)
+	defer cancel()
+	var owner string
+	var connectedAt time.Time
+	err := r.hub.db.QueryRow(ctx, `SELECT s.agent_instance, s.connected_at FROM servers s JOIN hub_instances i ON i.id = s.agent_instance
+		WHERE s.id = $1 AND s.connected_at IS NOT NULL AND i.id <> $2 AND i.seen_at > now() - make_interval(secs => $3)`,
+		serverID, r.id, relayInstanceTTL.Seconds()).Scan(&owner, &connectedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", time.Time{}, nil
+	}
+	return owner, connectedAt, err
+}
+
+// forward sends frame to the instance holding serverID's agent and waits
+// for its result. Notifications return once the agent has been written to.
+func (r *hubRelay) forward(ctx context.Context, serverID string, frame JSONRPC, notify bool) ([]byte, error) {
+	owner, _, err := r.owner(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if owner == "" {
+		return nil, errAgentDisconnected
+	}
+	r.forwarded.Add(1)
+
+	msg := relayMessage{Kind: "call", Ref: r.id + ":" + strconv.FormatUint(r.seq.Add(1), 10), ReplyTo: r.id, ServerID: serverID, Frame: &frame}
+	if notify {
+		msg.Kind = "notify"
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.TimeoutMs = max(time.Until(deadline).Milliseconds(), 1)
+	}
+
+	ch := make(chan relayMessage, 1)
+	r.mu.Lock()
+	r.pending[msg.Ref] = ch
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, msg.Ref)
+		r.mu.Unlock()
+	}()
+
+	if err := r.send(ctx, owner, msg); err != nil {
+		r.failed.Add(1)
+		return nil, fmt.Errorf("%w: %w", errAgentWrite, err)
+	}
+	select {
+	case result := <-ch:
+		if result.ErrorCode != "" || result.Error != "" {
+			return nil, relayError(result)
+		}
+		return result.Response, nil
+	case <-ctx.Done():
+		r.failed.Add(1)
+		return nil, ctx.Err()
+	case <-r.ctx.Done():
+		r.failed.Add(1)
+		return nil, errRelayStopped
+	}
+}
+
+// relayErrorCode and relayError carry the errors callers branch on across
+// instances; anything else arrives as plain text.
+func relayErrorCode(err error) string {
+	switch {
+	case errors.Is(err, errCallIDInUse):
+		return "id_in_use"
+	case errors.Is(err, errAgentWrite):
+		return "write"
+	case errors.Is(err, errAgentDisconnected):
+		return "disconnected"
+	case errors.Is(err, errDraining):
+		return "draining"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "other"
+	}
+}
+
+func relayError(msg relayMessage) error {
+	switch msg.ErrorCode {
+	case "id_in_use":
+		return errCallIDInUse
+	case "write":
+		// msg.Error already starts with errAgentWrite's text.
+		return fmt.Errorf("%w: %s", errAgentWrite, strings.TrimPrefix(msg.Error, errAgentWrite.Error()+": "))
+	case "disconnected":
+		return errAgentDisconnected
+	case "draining":
+		return errDraining
+	case "timeout":
+		return context.DeadlineExceeded
+	default:
+		return errors.New(msg.Error)
+	}
+}
+
+// RelayStats returns nil when the relay is off.
+func (h *Hub) RelayStats() *relayStats {
+	if h.relay == nil {
+		return nil
+	}
+	r := h.relay
+	return &relayStats{
+		InstanceID: r.id,
+		Forwarded:  r.forwarded.Load(),
+		Served:     r.served.Load(),
+		Failed:     r.failed.Load(),
+	}
+}
+
+// Close stops relaying and withdraws the instance, so others stop routing
+// to it at once rather than after relayInstanceTTL.
+func (r *hubRelay) Close(ctx context.Context) {
+	r.stop()
+	<-r.done
+	ctx, cancel := withQueryTimeout(ctx, r.hub.cfg.QueryTimeout)
+	defer cancel()
+	if _, err := r.hub.db.Exec(ctx, `UPDATE servers SET connected_at = NULL, agent_instance = NULL WHERE agent_instance = $1`, r.id); err != nil {
+		r.hub.logger.Warn("failed to clear relayed agent routes", slog.Any("err", err))
+	}
+	if _, err := r.hub.db.Exec(ctx, `DELETE FROM hub_instances WHERE id = $1`, r.id); err != nil {
+		r.hub.logger.Warn("failed to remove hub instance", slog.Any("err", err))
+	}
+}
+
+// instanceID is stored in servers.agent_instance for agents this hub
+// holds; it is NULL when the relay is off.
+func (h *Hub) instanceID() *string {
+	if h.relay == nil {
+		return nil
+	}
+	return &h.relay.id
+}
+
+// RemoteAgent reports whether another live instance holds serverID's
+// agent, so calls for it can be relayed. It is always false with the relay
+// off.
+func (h *Hub) RemoteAgent(ctx context.Context, serverID string) bool {
+	return h.remoteConnectedAt(ctx, serverID) != nil
+}
+
+// remoteConnectedAt returns when serverID's agent connected to another
+// live instance, or nil when none holds it or the relay is off.
+func (h *Hub) remoteConnectedAt(ctx context.Context, serverID string) *time.Time {
+	if h.relay == nil {
+		return nil
+	}
+	owner, connectedAt, err := h.relay.owner(ctx, serverID)
+	if err != nil {
+		h.logger.Warn("failed to look up agent instance", slog.String("server_id", serverID), slog.Any("err", err))
+		return nil
+	}
+	if owner == "" {
+		return nil
+	}
+	return &connectedAt
+}
+
+// agentConnectedAt returns when serverID's agent connected to this
+// instance or, failing that, to another live one; nil means no instance
+// holds it. servers.connected_at alone cannot say, since it outlives an
+// instance that exits without clearing it.
+func (h *Hub) agentConnectedAt(ctx context.Context, serverID string) *time.Time {
+	if agent := h.AgentFor(serverID); agent != nil {
+		return &agent.connectedAt
+	}
+	return h.remoteConnectedAt(ctx, serverID)
+}
+
+// liveInstanceJoin joins servers to the live instance, other than this
+// one, holding each server's agent: live.instance is NULL for servers no
+// other instance holds. $1 is this instance's id and $2 the liveness
+// window in seconds; with the relay off $1 is NULL and nothing joins.
+const liveInstanceJoin = ` LEFT JOIN (SELECT id AS instance FROM hub_instances WHERE id <> $1 AND seen_at > now() - make_interval(secs => $2)) live
+	ON live.instance = servers.agent_instance AND servers.connected_at IS NOT NULL`
+
+// call sends frame to agent, or through the relay when agent is nil
+// because another instance holds it.
+func (h *Hub) call(ctx context.Context, serverID string, agent *AgentConn, frame JSONRPC) ([]byte, error) {
+	if agent != nil {
+		return agent.Call(ctx, frame)
+	}
+	if h.relay == nil {
+		return nil, errAgentDisconnected
+	}
+	return h.relay.forward(ctx, serverID, frame, false)
+}
+
+// notify is call for notifications.
+func (h *Hub) notify(ctx context.Context, serverID string, agent *AgentConn, frame JSONRPC) error {
+	if agent != nil {
+		return agent.Notify(ctx, frame)
+	}
+	if h.relay == nil {
+		return errAgentDisconnected
+	}
+	_, err := h.relay.forward(ctx, serverID, frame, true)
+	return err
+}
+
+// CloseRelay withdraws this instance from the relay; it is a no-op when
+// the relay is off.
+func (h *Hub) CloseRelay(ctx context.Context) {
+	if h.relay != nil {
+		h.relay.Close(ctx)
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestRelayErrorRoundTrip checks that the errors callers branch on survive
+// the trip from the instance holding the agent back to the caller, and map
+// to the same HTTP status they would for a local agent. Sentinels arrive
+// bare; write failures and other errors keep their text.
+func TestRelayErrorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+		text string
+	}{
+		{"id in use", errCallIDInUse, "id_in_use", errCallIDInUse.Error()},
+		{"write failed", fmt.Errorf("%w: broken pipe", errAgentWrite), "write", "agent write failed: broken pipe"},
+		{"disconnected", errAgentDisconnected, "disconnected", errAgentDisconnected.Error()},
+		{"wrapped disconnected", fmt.Errorf("call: %w", errAgentDisconnected), "disconnected", errAgentDisconnected.Error()},
+		{"draining", errDraining, "draining", errDraining.Error()},
+		{"timeout", context.DeadlineExceeded, "timeout", context.DeadlineExceeded.Error()},
+		{"other", errors.New("agent returned garbage"), "other", "agent returned garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := relayErrorCode(tt.err)
+			if code != tt.code {
+				t.Fatalf("relayErrorCode = %q, want %q", code, tt.code)
+			}
+			got := relayError(relayMessage{Kind: "result", Error: tt.err.Error(), ErrorCode: code})
+			if got.Error() != tt.text {
+				t.Fatalf("relayed error = %q, want %q", got, tt.text)
+			}
+			for _, sentinel := range []error{errCallIDInUse, errAgentWrite, errAgentDisconnected, errDraining, context.DeadlineExceeded} {
+				if errors.Is(got, sentinel) != errors.Is(tt.err, sentinel) {
+					t.Fatalf("errors.Is(relayed, %v) = %v, want %v", sentinel, errors.Is(got, sentinel), errors.Is(tt.err, sentinel))
+				}
+			}
+			if got, want := callErrorStatus(got), callErrorStatus(tt.err); got != want {
+				t.Fatalf("callErrorStatus = %d, want %d", got, want)
+			}
+		})
+	}
+}
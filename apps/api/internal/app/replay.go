@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// emptyParamsHash is params_sha256 for a call recorded without params.
+var emptyParamsHash = func() string {
+	sum := sha256.Sum256(nil)
+	return hex.EncodeToString(sum[:])
+}()
+
+type replayResponse struct {
+	// ReplayOf is the audit entry whose call was re-issued.
+	ReplayOf int64           `json:"replay_of"`
+	Method   string          `json:"method"`
+	Response json.RawMessage `json:"response"`
+}
+
+// containsRedacted reports whether any string in doc is the audit redaction
+// placeholder, meaning the stored params are not the ones originally sent.
+func containsRedacted(node any) bool {
+	switch v := node.(type) {
+	case string:
+		return v == redactedPlaceholder
+	case map[string]any:
+		for _, child := range v {
+			if containsRedacted(child) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if containsRedacted(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadReplayParams reads a failed RPC's stored params for replay. It returns
+// a message for the caller, rather than an error, when the entry cannot be
+// replayed.
+func (a *App) loadReplayParams(ctx context.Context, serverID string, auditID int64) (method string, params json.RawMessage, reason string, err error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+	var (
+		hash   string
+		stored json.RawMessage
+		status string
+	)
+	err = a.DB.QueryRow(ctx, `SELECT action, params_sha256, params_json, result_status FROM audit_logs WHERE id = $1 AND server_id = $2`, auditID, serverID).
+		Scan(&method, &hash, &stored, &status)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if status != "error" {
+		return method, nil, "only failed calls can be replayed", nil
+	}
+	if strings.HasPrefix(method, "conduit:") {
+		return method, nil, "only RPC calls can be replayed", nil
+	}
+	if stored, err = a.cipher.open(stored, aadAuditParams); err != nil {
+		return "", nil, "", err
+	}
+	if stored == nil {
+		if hash == emptyParamsHash {
+			return method, nil, "", nil
+		}
+		return method, nil, "params were not stored for this call; enable AUDIT_STORE_PARAMS", nil
+	}
+	var doc any
+	if err := json.Unmarshal(stored, &doc); err != nil {
+		return "", nil, "", err
+	}
+	if containsRedacted(doc) {
+		return method, nil, "stored params were redacted", nil
+	}
+	return method, stored, "", nil
+}
+
+// handleReplayRPC re-issues a failed RPC from its audit entry with the same
+// method and params. The caller must pass the same allowlist, role, and sudo
+// checks as a direct call. Methods that can change server state are refused
+// unless ?force=true, since the original may have been applied before it
+// failed. The new audit entry records replay_of.
+func (a *App) handleReplayRPC(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	auditID, err := strconv.ParseInt(chi.URLParam(r, "auditId"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+
+	method, params, reason, err := a.loadReplayParams(r.Context(), serverID, auditID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	if reason != "" {
+		http.Error(w, reason, http.StatusConflict)
+		return
+	}
+	if method == commandMethod || a.streamsMethod(method) {
+		http.Error(w, fmt.Sprintf("%s cannot be replayed", method), http.StatusBadRequest)
+		return
+	}
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	minRole := roleForMethod(method)
+	if minRole != RoleViewer && !force {
+		http.Error(w, fmt.Sprintf("%s may change server state; add ?force=true to replay it", method), http.StatusConflict)
+		return
+	}
+
+	req := JSONRPC{Method: method, Params: params}
+	if a.rejectIfNotAllowed(w, r, user.ID, serverID, req) {
+		return
+	}
+	if !user.Role.Meets(minRole) {
+		a.writeJSONStatus(w, http.StatusForbidden, rbacErrorResponse{
+			Error:        "forbidden",
+			Method:       method,
+			RequiredRole: minRole,
+			CurrentRole:  user.Role,
+		})
+		return
+	}
+	if a.rejectWithoutSudo(w, r, method) {
+		return
+	}
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+
+	agent := a.Hub.AgentFor(serverID)
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.serverRPCTimeout(r.Context(), serverID))
+	defer cancel()
+	resp, attempts, err := a.callAgent(ctx, serverID, agent, req)
+	record := func(status string, err error) {
+		entry := a.newAuditEntry(user.ID, serverID, method, params, status, err)
+		entry.attempts = attempts
+		entry.replayOf = auditID
+		a.submitAudit(entry)
+	}
+	if err != nil {
+		record("error", err)
+		http.Error(w, err.Error(), callErrorStatus(err))
+		return
+	}
+	httpStatus := http.StatusOK
+	if rpcErr := decodeJSONRPCError(resp); rpcErr != nil {
+		record("error", rpcErr)
+		httpStatus = http.StatusUnprocessableEntity
+	} else {
+		record("ok", nil)
+	}
+	a.writeJSONStatus(w, httpStatus, replayResponse{ReplayOf: auditID, Method: method, Response: resp})
+}
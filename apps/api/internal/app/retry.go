@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// rpcRetryBackoff is the wait before the first retry; it doubles after each.
+const rpcRetryBackoff = 100 * time.Millisecond
+
+type rpcStats struct {
+	Retries uint64 `json:"retries_total"`
+	// SlowCalls counts calls slower than RPC_SLOW_THRESHOLD.
+	SlowCalls uint64 `json:"slow_calls_total"`
+}
+
+// logCallLatency logs a finished agent call, at warn level and counted in
+// rpc.slow_calls_total when it took longer than the slow threshold.
+func (a *App) logCallLatency(serverID, userID string, req JSONRPC, latency time.Duration) {
+	attrs := []any{
+		slog.String("server_id", serverID),
+		slog.String("user_id", userID),
+		slog.String("method", req.Method),
+		slog.Duration("latency", latency),
+	}
+	if a.rpcSlowThreshold <= 0 || latency <= a.rpcSlowThreshold {
+		a.Logger.Debug("rpc call", attrs...)
+		return
+	}
+	a.rpcSlowCalls.Add(1)
+	hash := sha256.Sum256(req.Params)
+	attrs = append(attrs, slog.String("params_sha256", hex.EncodeToString(hash[:])), slog.Duration("threshold", a.rpcSlowThreshold))
+	a.Logger.Warn("slow rpc call", attrs...)
+}
+
+// retryableCall reports whether err means the call was lost on the way to or
+// from the agent rather than answered.
+func retryableCall(err error) bool {
+	return errors.Is(err, errAgentDisconnected) || errors.Is(err, errAgentWrite)
+}
+
+// callAgent issues frame and, for methods viewers may call, retries up to
+// RPC_READ_RETRIES times when the agent connection drops or the write fails.
+// Methods that can change server state are never retried. A replacement
+// agent that connected in the meantime is picked up between attempts. It
+// returns how many attempts were made.
+func (a *App) callAgent(ctx context.Context, serverID string, agent *AgentConn, frame JSONRPC) ([]byte, int, error) {
+	retries := 0
+	if roleForMethod(frame.Method) == RoleViewer {
+		retries = a.rpcReadRetries
+	}
+
+	backoff := rpcRetryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := a.Hub.call(ctx, serverID, agent, frame)
+		if err == nil || attempt > retries || !retryableCall(err) || ctx.Err() != nil {
+			return resp, attempt, err
+		}
+
+		a.rpcRetries.Add(1)
+		a.Logger.Warn("retrying agent call", slog.String("server_id", serverID), slog.String("method", frame.Method), slog.Int("attempt", attempt), slog.Any("err", err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, attempt, err
+		}
+		backoff *= 2
+		if next := a.Hub.AgentFor(serverID); next != nil {
+			agent = next
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteRPCResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       string
+		wantCode   int
+		wantStatus string
+		wantErr    string
+	}{
+		{"result", `{"jsonrpc":"2.0","id":1,"result":[]}`, http.StatusOK, "ok", ""},
+		{"null error", `{"jsonrpc":"2.0","id":1,"result":true,"error":null}`, http.StatusOK, "ok", ""},
+		{"error in 200", `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"Invalid params"}}`, http.StatusUnprocessableEntity, "error", "Invalid params"},
+		{"error without message", `{"jsonrpc":"2.0","id":1,"error":{"code":-32601}}`, http.StatusUnprocessableEntity, "error", "rpc error -32601"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			status, err := writeRPCResponse(rec, []byte(tt.resp))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("audit status = %q, want %q", status, tt.wantStatus)
+			}
+			if got := rec.Body.String(); got != tt.resp {
+				t.Fatalf("body = %s, want the full response %s", got, tt.resp)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("Content-Type = %q", ct)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import "encoding/json"
+
+// stripSchemaFields returns schema without the members rules match, for
+// callers below owner. Rules use the same key and path forms as audit
+// redaction, but matched members are removed rather than masked; their
+// Method is ignored.
+func stripSchemaFields(schema json.RawMessage, rules []RedactionRule) (json.RawMessage, error) {
+	if len(rules) == 0 {
+		return schema, nil
+	}
+	var doc any
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if rule.Key != "" {
+			stripKey(doc, rule.Key)
+		}
+		if len(rule.Path) > 0 {
+			stripPath(doc, rule.Path)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// schemaForRole applies the hub's strip rules unless role is owner.
+func (h *Hub) schemaForRole(schema json.RawMessage, role Role) (json.RawMessage, error) {
+	if role.Meets(RoleOwner) {
+		return schema, nil
+	}
+	return stripSchemaFields(schema, h.cfg.SchemaStrip)
+}
+
+func stripKey(node any, key string) {
+	switch v := node.(type) {
+	case map[string]any:
+		delete(v, key)
+		for _, child := range v {
+			stripKey(child, key)
+		}
+	case []any:
+		for _, child := range v {
+			stripKey(child, key)
+		}
+	}
+}
+
+func stripPath(node any, path []string) {
+	switch v := node.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			delete(v, path[0])
+			return
+		}
+		if child, ok := v[path[0]]; ok {
+			stripPath(child, path[1:])
+		}
+	case []any:
+		for _, child := range v {
+			stripPath(child, path)
+		}
+	}
+}
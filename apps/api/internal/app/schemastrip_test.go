@@ -0,0 +1,111 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStripSchemaFields(t *testing.T) {
+	schema := `{"info":{"title":"mc","x-internal":"host-7"},"methods":[` +
+		`{"name":"minecraft:players","description":"List players","examples":[{"params":[]}],` +
+		`"params":[{"name":"player","schema":{"type":"object","examples":["alex"]}}]},` +
+		`{"name":"minecraft:server/stop","x-internal":{"runbook":"stop.md"}}]}`
+
+	tests := []struct {
+		name        string
+		keys, paths string
+		want        string
+	}{
+		{
+			name: "no rules",
+			want: schema,
+		},
+		{
+			name: "key at any depth",
+			keys: "examples",
+			want: `{"info":{"title":"mc","x-internal":"host-7"},"methods":[` +
+				`{"name":"minecraft:players","description":"List players",` +
+				`"params":[{"name":"player","schema":{"type":"object"}}]},` +
+				`{"name":"minecraft:server/stop","x-internal":{"runbook":"stop.md"}}]}`,
+		},
+		{
+			name: "key removes whole subtree",
+			keys: "x-internal",
+			want: `{"info":{"title":"mc"},"methods":[` +
+				`{"name":"minecraft:players","description":"List players","examples":[{"params":[]}],` +
+				`"params":[{"name":"player","schema":{"type":"object","examples":["alex"]}}]},` +
+				`{"name":"minecraft:server/stop"}]}`,
+		},
+		{
+			name:  "path through arrays",
+			paths: "methods.params.schema.examples",
+			want: `{"info":{"title":"mc","x-internal":"host-7"},"methods":[` +
+				`{"name":"minecraft:players","description":"List players","examples":[{"params":[]}],` +
+				`"params":[{"name":"player","schema":{"type":"object"}}]},` +
+				`{"name":"minecraft:server/stop","x-internal":{"runbook":"stop.md"}}]}`,
+		},
+		{
+			name:  "path only from root",
+			paths: "params.schema.examples,x-internal",
+			want:  schema,
+		},
+		{
+			name:  "keys and paths",
+			keys:  "description",
+			paths: "info.x-internal,methods.examples",
+			want: `{"info":{"title":"mc"},"methods":[` +
+				`{"name":"minecraft:players",` +
+				`"params":[{"name":"player","schema":{"type":"object","examples":["alex"]}}]},` +
+				`{"name":"minecraft:server/stop","x-internal":{"runbook":"stop.md"}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripSchemaFields(json.RawMessage(schema), ParseRedactionRules(tt.keys, tt.paths))
+			if err != nil {
+				t.Fatalf("stripSchemaFields: %v", err)
+			}
+			var gotDoc, wantDoc any
+			if err := json.Unmarshal(got, &gotDoc); err != nil {
+				t.Fatalf("invalid output %s: %v", got, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantDoc); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotDoc, wantDoc) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaForRole(t *testing.T) {
+	schema := json.RawMessage(`{"methods":[{"name":"minecraft:players","examples":["alex"]}]}`)
+	stripped := `{"methods":[{"name":"minecraft:players"}]}`
+	h := NewHub(nil, HubConfig{SchemaStrip: ParseRedactionRules("examples", "")}, testLogger())
+
+	tests := []struct {
+		role Role
+		want string
+	}{
+		{RoleViewer, stripped},
+		{RoleModerator, stripped},
+		{RoleOwner, string(schema)},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			got, err := h.schemaForRole(schema, tt.role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := h.schemaForRole(json.RawMessage(`{`), RoleViewer); err == nil {
+		t.Fatal("invalid schema stripped without error")
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -8,9 +9,14 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -25,33 +31,212 @@ import (
 )
 
 type App struct {
-	DB        *pgxpool.Pool
+	DB        appDB
+	ReadDB    appDB
 	Hub       *Hub
 	Logger    *slog.Logger
 	jwtSecret []byte
 	Router    http.Handler
+
+	queryTimeout       time.Duration
+	exportQueryTimeout time.Duration
+	auditStoreParams   bool
+	auditRedaction     []RedactionRule
+	auditPolicy        []AuditPolicyRule
+	verifyLimiter      *rateLimiter
+	sudoLimiter        *rateLimiter
+	sudoActions        []string
+	sudoWindow         time.Duration
+	sessionIdleTimeout time.Duration
+	maxServersPerOwner int
+	audit              *auditWriter
+	auditTail          *auditTail
+	commandRole        Role
+	cipher             *DataCipher
+	agentURL           string
+	streamMethods      []string
+	wsOriginPatterns   []string
+	rpcTimeoutMax      time.Duration
+	rpcReadRetries     int
+	disableBootstrap   bool
+	rpcRetries         atomic.Uint64
+	rpcSlowThreshold   time.Duration
+	rpcSlowCalls       atomic.Uint64
 }
 
 type Config struct {
-	JWTSecret string
+	JWTSecret           string
+	ReadReplica         *pgxpool.Pool
+	MaxClientsPerServer int
+	MaxClients          int
+	QueryTimeout        time.Duration
+	ExportQueryTimeout  time.Duration
+	AgentWriteTimeout   time.Duration
+	AgentReadIdle       time.Duration
+	AgentReplaceGrace   time.Duration
+	AuditStoreParams    bool
+	AuditRedaction      []RedactionRule
+	AuditPolicy         []AuditPolicyRule
+	AuditQueueSize      int
+	DataCipher          *DataCipher
+	CacheLastResponses  bool
+	StrictJSONRPC       bool
+	RPCTimeoutMax       time.Duration
+	ClientIdleTimeout   time.Duration
+	AgentConnectURL     string
+	AgentLogBuffer      int
+	StreamMethods       []string
+	// AllowedOrigins lists browser origins for CORS and the event WebSocket;
+	// empty falls back to the local UI dev server.
+	AllowedOrigins []string
+	// RPCReadRetries is how many times a viewer-level RPC is retried when
+	// the agent connection fails mid-call; zero disables retries.
+	RPCReadRetries int
+	// RPCSlowThreshold logs RPCs slower than this at warn level; zero
+	// disables slow-call logging.
+	RPCSlowThreshold time.Duration
+	// DisableBootstrap turns off POST /v1/users/bootstrap so the first owner
+	// can only come from BootstrapOwner.
+	DisableBootstrap bool
+	// CommandRole is the minimum role for POST /v1/servers/{id}/command;
+	// only RoleModerator lowers it from the RoleOwner default.
+	CommandRole Role
+	// AlertDebounce and AlertWebhook configure agent online/offline
+	// alerts; see HubConfig.ConnectivityDebounce and ConnectivityWebhook.
+	AlertDebounce time.Duration
+	AlertWebhook  string
+	// AgentMaxFrame and ClientMaxFrame cap a single WebSocket message from
+	// an agent or event client; see HubConfig.
+	AgentMaxFrame  int64
+	ClientMaxFrame int64
+	// MaxAgentsPerIP caps concurrent agent connections from one address;
+	// zero means unlimited.
+	MaxAgentsPerIP int
+	// TrustedProxies lists the proxies whose X-Forwarded-For and X-Real-IP
+	// headers name the client; empty ignores those headers.
+	TrustedProxies []*net.IPNet
+	// SchemaStrip lists schema keys and paths hidden from non-owners; see
+	// HubConfig.
+	SchemaStrip []RedactionRule
+	// SudoActions lists RPC methods and conduit: actions that need a
+	// recent POST /v1/auth/sudo; empty disables sudo mode. SudoWindow is
+	// how long one lasts.
+	SudoActions []string
+	SudoWindow  time.Duration
+	// SessionIdleTimeout revokes sessions unused for longer than this,
+	// independent of their absolute expiry; zero disables it.
+	SessionIdleTimeout time.Duration
+	// HubRelay forwards calls between API instances sharing the database;
+	// see HubConfig.Relay.
+	HubRelay bool
+	// MaxServersPerOwner and MaxAgentsPerOwner cap the servers an owner
+	// may create and how many of them may have an agent connected at once;
+	// zero means unlimited.
+	MaxServersPerOwner int
+	MaxAgentsPerOwner  int
+}
+
+// defaultRPCTimeout bounds agent calls for servers without their own
+// default_rpc_timeout_ms.
+const defaultRPCTimeout = 15 * time.Second
+
+var defaultAllowedOrigins = []string{"http://localhost:5173", "http://127.0.0.1:5173"}
+
+// originPatterns converts allowed origins into the host patterns
+// websocket.Accept matches the Origin header against.
+func originPatterns(origins []string) []string {
+	patterns := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			patterns = append(patterns, "*")
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		patterns = append(patterns, u.Host)
+	}
+	return patterns
 }
 
 func NewApp(db *pgxpool.Pool, cfg Config, logger *slog.Logger) *App {
-	hub := NewHub(db, logger)
+	hub := NewHub(db, HubConfig{
+		MaxClientsPerServer:  cfg.MaxClientsPerServer,
+		MaxClients:           cfg.MaxClients,
+		QueryTimeout:         cfg.QueryTimeout,
+		AgentWriteTimeout:    cfg.AgentWriteTimeout,
+		AgentReadIdleTimeout: cfg.AgentReadIdle,
+		AgentReplaceGrace:    cfg.AgentReplaceGrace,
+		Cipher:               cfg.DataCipher,
+		CacheLastResponses:   cfg.CacheLastResponses,
+		StrictJSONRPC:        cfg.StrictJSONRPC,
+		ClientIdleTimeout:    cfg.ClientIdleTimeout,
+		AgentLogBuffer:       cfg.AgentLogBuffer,
+		ConnectivityDebounce: cfg.AlertDebounce,
+		ConnectivityWebhook:  cfg.AlertWebhook,
+		AgentMaxFrame:        cfg.AgentMaxFrame,
+		ClientMaxFrame:       cfg.ClientMaxFrame,
+		MaxAgentsPerIP:       cfg.MaxAgentsPerIP,
+		SchemaStrip:          cfg.SchemaStrip,
+		Relay:                cfg.HubRelay,
+		MaxAgentsPerOwner:    cfg.MaxAgentsPerOwner,
+	}, logger)
+	readDB := cfg.ReadReplica
+	if readDB == nil {
+		readDB = db
+	}
+	allowedOrigins := cfg.AllowedOrigins
+	if len(allowedOrigins) == 0 {
+		allowedOrigins = defaultAllowedOrigins
+	}
 	app := &App{
 		DB:        db,
+		ReadDB:    readDB,
 		Hub:       hub,
 		Logger:    logger,
 		jwtSecret: []byte(cfg.JWTSecret),
+
+		queryTimeout:       cfg.QueryTimeout,
+		exportQueryTimeout: cfg.ExportQueryTimeout,
+		auditStoreParams:   cfg.AuditStoreParams,
+		auditRedaction:     append(append([]RedactionRule{}, defaultRedactionRules...), cfg.AuditRedaction...),
+		auditPolicy:        cfg.AuditPolicy,
+		verifyLimiter:      newRateLimiter(10, time.Minute),
+		sudoLimiter:        newRateLimiter(10, time.Minute),
+		sudoActions:        cfg.SudoActions,
+		sudoWindow:         cfg.SudoWindow,
+		sessionIdleTimeout: cfg.SessionIdleTimeout,
+		maxServersPerOwner: cfg.MaxServersPerOwner,
+		audit:              newAuditWriter(db, cfg.AuditQueueSize, cfg.QueryTimeout, logger),
+		cipher:             cfg.DataCipher,
+		agentURL:           strings.TrimSpace(cfg.AgentConnectURL),
+		streamMethods:      cfg.StreamMethods,
+		wsOriginPatterns:   originPatterns(allowedOrigins),
+		rpcTimeoutMax:      cfg.RPCTimeoutMax,
+		rpcReadRetries:     max(cfg.RPCReadRetries, 0),
+		rpcSlowThreshold:   cfg.RPCSlowThreshold,
+		disableBootstrap:   cfg.DisableBootstrap,
+		auditTail:          newAuditTail(),
+		commandRole:        RoleOwner,
+	}
+	if app.rpcTimeoutMax <= 0 {
+		app.rpcTimeoutMax = 2 * time.Minute
+	}
+	if app.sudoWindow <= 0 {
+		app.sudoWindow = defaultSudoWindow
+	}
+	if cfg.CommandRole == RoleModerator {
+		app.commandRole = RoleModerator
 	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(realIPMiddleware(cfg.TrustedProxies))
+	r.Use(app.accessLogMiddleware)
+	r.Use(app.recoverMiddleware)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://127.0.0.1:5173"},
+		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Requested-With"},
 		ExposedHeaders:   []string{"Link"},
@@ -63,32 +248,80 @@ func NewApp(db *pgxpool.Pool, cfg Config, logger *slog.Logger) *App {
 
 	r.With(timeout).Post("/v1/users/bootstrap", app.handleBootstrap)
 	r.With(timeout).Post("/v1/auth/login", app.handleLogin)
+	r.With(timeout).Get("/v1/auth/introspect", app.handleIntrospect)
+	r.With(timeout).Get("/v1/openapi.json", app.handleOpenAPI)
+	r.With(timeout).Post("/v1/agent/verify", app.verifyLimiter.middleware(app.handleVerifyAgentToken))
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Use(timeout)
 		r.Group(func(r chi.Router) {
 			r.Use(app.authMiddleware)
 			r.Post("/auth/logout", app.handleLogout)
+			r.Post("/auth/sudo", app.sudoLimiter.middlewareBy(sudoLimitKeys, app.handleSudo))
+			r.Post("/users/{id}/revoke-sessions", app.requireRole(RoleOwner, app.sudo(actionRevokeSessions, app.handleRevokeUserSessions)))
 			r.Get("/servers", app.handleListServers)
 			r.Post("/servers", app.requireRole(RoleOwner, app.handleCreateServer))
+			r.Post("/servers/import", app.requireRole(RoleOwner, app.sudo(actionServerImport, app.handleImportServer)))
 			r.Route("/servers/{id}", func(r chi.Router) {
 				r.Get("/", app.handleGetServer)
+				r.Patch("/", app.requireRole(RoleOwner, app.handleUpdateServer))
+				r.Post("/agent-token", app.requireRole(RoleOwner, app.sudo(actionAgentTokenRotate, app.handleRotateAgentToken)))
+				r.Get("/agent-config", app.requireRole(RoleOwner, app.sudo(actionAgentTokenRotate, app.handleAgentConfig)))
+				r.Get("/export", app.requireRole(RoleOwner, app.sudo(actionServerExport, app.handleExportServer)))
+				r.Post("/suspend", app.requireRole(RoleOwner, app.sudo(actionServerSuspend, app.handleSuspendServer)))
+				r.Post("/resume", app.requireRole(RoleOwner, app.sudo(actionServerResume, app.handleResumeServer)))
 				r.Get("/schema", app.handleServerSchema)
+				r.Get("/permissions", app.handleServerPermissions)
+				r.Post("/schema/probe", app.requireRole(RoleModerator, app.handleSchemaProbe))
 				r.Post("/rpc", app.handleServerRPC)
+				r.Get("/rpc-allowlist", app.requireRole(RoleOwner, app.handleGetServerAllowlist))
+				r.Put("/rpc-allowlist", app.requireRole(RoleOwner, app.sudo(actionAllowlistServer, app.handlePutServerAllowlist)))
+				r.Get("/event-filter", app.requireRole(RoleOwner, app.handleGetEventFilter))
+				r.Put("/event-filter", app.requireRole(RoleOwner, app.sudo(actionEventFilter, app.handlePutEventFilter)))
+				r.Post("/agent-policy/override", app.requireRole(RoleOwner, app.sudo(actionAgentPolicyOverride, app.handleAgentPolicyOverride)))
+				r.Get("/rpc/last", app.requireRole(RoleViewer, app.handleLastRPCResponse))
+				r.Get("/console", app.requireRole(RoleModerator, app.handleServerConsole))
+				r.Get("/agent-logs", app.requireRole(RoleModerator, app.handleAgentLogs))
+				r.Get("/agent-telemetry", app.requireRole(RoleModerator, app.handleAgentTelemetry))
+				r.Post("/announce", app.requireRole(RoleModerator, app.handleAnnounce))
+				r.Post("/message", app.requireRole(roleForMethod(systemMessageMethod), app.handleSystemMessage))
+				r.Post("/command", app.requireRole(app.commandRole, app.sudo(commandMethod, app.handleServerCommand)))
 				r.Get("/audit", app.handleListAuditLogs)
 				r.Get("/audit/export", app.handleExportAuditLogs)
+				r.Get("/audit/stats", app.requireRole(RoleViewer, app.handleAuditStats))
+				r.Post("/audit/{auditId}/replay", app.requireRole(RoleViewer, app.handleReplayRPC))
 				r.Post("/gamerules/apply-preset", app.requireRole(RoleModerator, app.handleApplyGameRulePreset))
+				r.Get("/gamerules/preset-diff", app.requireRole(RoleViewer, app.handlePresetDiff))
+				r.Get("/gamerules/{key}", app.requireRole(RoleViewer, app.handleGetGameRule))
 			})
 			r.Get("/game-rule-presets", app.requireRole(RoleViewer, app.handleListGameRulePresets))
+			r.Get("/server-settings/catalog", app.requireRole(RoleViewer, app.handleServerSettingsCatalog))
 			r.Get("/api-keys", app.requireRole(RoleOwner, app.handleListAPIKeys))
-			r.Post("/api-keys", app.requireRole(RoleOwner, app.handleCreateAPIKey))
-			r.Delete("/api-keys/{id}", app.requireRole(RoleOwner, app.handleDeleteAPIKey))
+			r.Post("/api-keys", app.requireRole(RoleOwner, app.sudo(actionAPIKeyCreate, app.handleCreateAPIKey)))
+			r.Delete("/api-keys/{id}", app.requireRole(RoleOwner, app.sudo(actionAPIKeyDelete, app.handleDeleteAPIKey)))
+			r.Get("/admin/connections", app.requireRole(RoleOwner, app.handleAdminConnections))
+			r.Get("/admin/quotas", app.requireRole(RoleOwner, app.handleQuotaUsage))
+			r.Post("/admin/agents/drain", app.requireRole(RoleOwner, app.sudo(actionAgentsDrain, app.handleDrainAgents)))
+			r.Get("/admin/audit/retention-preview", app.requireRole(RoleOwner, app.handleRetentionPreview))
+			r.Get("/rpc-allowlist", app.requireRole(RoleOwner, app.handleGetGlobalAllowlist))
+			r.Put("/rpc-allowlist", app.requireRole(RoleOwner, app.sudo(actionAllowlistGlobal, app.handlePutGlobalAllowlist)))
+			r.Post("/announce", app.requireRole(RoleOwner, app.handleAnnounceGlobal))
+			r.Get("/groups", app.requireRole(RoleViewer, app.handleListGroups))
+			r.Post("/groups", app.requireRole(RoleOwner, app.handleCreateGroup))
+			r.Route("/groups/{id}", func(r chi.Router) {
+				r.Get("/", app.requireRole(RoleViewer, app.handleGetGroup))
+				r.Delete("/", app.requireRole(RoleOwner, app.handleDeleteGroup))
+				r.Put("/servers/{serverID}", app.requireRole(RoleOwner, app.handleAddGroupMember))
+				r.Delete("/servers/{serverID}", app.requireRole(RoleOwner, app.handleRemoveGroupMember))
+				r.Post("/rpc", app.handleGroupRPC)
+			})
 		})
 	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(app.authMiddleware)
 		r.Get("/ws/servers/{id}/events", app.handleServerEvents)
+		r.Get("/ws/servers/{id}/audit-tail", app.handleAuditTail)
 	})
 
 	r.Get("/agent/connect", app.handleAgentConnect)
@@ -107,48 +340,9 @@ type authLoginResponse struct {
 	User  *AuthUser `json:"user"`
 }
 
-func (a *App) handleBootstrap(w http.ResponseWriter, r *http.Request) {
-	var req bootstrapRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
-	if req.Email == "" || req.Password == "" {
-		http.Error(w, "email and password required", http.StatusBadRequest)
-		return
-	}
-
-	ctx := r.Context()
-	var userCount int
-	if err := a.DB.QueryRow(ctx, "SELECT COUNT(1) FROM users").Scan(&userCount); err != nil {
-		a.internalError(w, err)
-		return
-	}
-	if userCount > 0 {
-		http.Error(w, "bootstrap already completed", http.StatusForbidden)
-		return
-	}
-
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		a.internalError(w, err)
-		return
-	}
-
-	id := uuid.NewString()
-	if _, err := a.DB.Exec(ctx, `INSERT INTO users (id, email, password_hash, role) VALUES ($1, $2, $3, 'owner')`, id, req.Email, string(hash)); err != nil {
-		a.internalError(w, err)
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-}
-
 func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
 	var req bootstrapRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSONBody(r, &req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -159,7 +353,8 @@ func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
 	var (
 		id     string
 		stored string
@@ -167,6 +362,7 @@ func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
 	)
 	if err := a.DB.QueryRow(ctx, `SELECT id, password_hash, role FROM users WHERE email=$1`, req.Email).Scan(&id, &stored, &role); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
+			burnPasswordCompare(req.Password)
 			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -179,55 +375,141 @@ func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	resp, err := a.issueSession(ctx, id, req.Email, role)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	a.writeJSON(w, resp)
+}
+
+// issueSession signs a JWT for the user and records its session row.
+func (a *App) issueSession(ctx context.Context, id, email string, role Role) (authLoginResponse, error) {
 	expiresAt := time.Now().Add(24 * time.Hour).UTC()
 	claims := jwt.MapClaims{
 		"sub":   id,
-		"email": req.Email,
+		"email": email,
 		"role":  string(role),
 		"exp":   expiresAt.Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, err := token.SignedString(a.jwtSecret)
 	if err != nil {
-		a.internalError(w, err)
-		return
+		return authLoginResponse{}, err
 	}
 
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
 	tokenHash := hashToken(signed)
 	if _, err := a.DB.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1 AND expires_at < now()`, id); err != nil {
 		a.Logger.Warn("failed to prune expired sessions", slog.Any("err", err))
 	}
 	if _, err := a.DB.Exec(ctx, `INSERT INTO sessions (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`, id, tokenHash, expiresAt); err != nil {
-		a.internalError(w, err)
-		return
+		return authLoginResponse{}, err
 	}
 
-	a.writeJSON(w, authLoginResponse{
+	return authLoginResponse{
 		Token: signed,
-		User:  &AuthUser{ID: id, Email: req.Email, Role: role},
-	})
+		User:  &AuthUser{ID: id, Email: email, Role: role},
+	}, nil
 }
 
 type serverRow struct {
 	ID          string
 	Name        string
 	Description *string
-	ConnectedAt *time.Time
+	Tags        []string
+	Suspended   bool
+	RPCTimeout  *int
+	Commands    bool
 	CreatedAt   time.Time
 }
 
+const serverColumns = `id, name, description, tags, suspended, default_rpc_timeout_ms, commands_enabled, created_at`
+
+func scanServerRow(row pgx.Row) (serverRow, error) {
+	var s serverRow
+	err := row.Scan(&s.ID, &s.Name, &s.Description, &s.Tags, &s.Suspended, &s.RPCTimeout, &s.Commands, &s.CreatedAt)
+	return s, err
+}
+
+// listItem renders row for the API. connectedAt is when the server's agent
+// connected, as the hub reports it, or nil when no instance holds it.
+func (row serverRow) listItem(connectedAt *time.Time) serverListItem {
+	tags := row.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return serverListItem{
+		ID:          row.ID,
+		Name:        row.Name,
+		Description: row.Description,
+		Tags:        tags,
+		Suspended:   row.Suspended,
+		RPCTimeout:  row.RPCTimeout,
+		Commands:    row.Commands,
+		Connected:   connectedAt != nil,
+		ConnectedAt: connectedAt,
+		CreatedAt:   row.CreatedAt,
+	}
+}
+
 type serverListItem struct {
 	ID          string     `json:"id"`
 	Name        string     `json:"name"`
 	Description *string    `json:"description,omitempty"`
+	Tags        []string   `json:"tags"`
+	Suspended   bool       `json:"suspended"`
+	RPCTimeout  *int       `json:"default_rpc_timeout_ms,omitempty"`
+	Commands    bool       `json:"commands_enabled"`
 	Connected   bool       `json:"connected"`
 	ConnectedAt *time.Time `json:"connected_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 }
 
 func (a *App) handleListServers(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	rows, err := a.DB.Query(ctx, `SELECT id, name, description, connected_at, created_at FROM servers ORDER BY created_at DESC`)
+	// Agents held by other instances come from one join rather than a
+	// relay lookup per row.
+	query := `SELECT ` + serverColumns + `, CASE WHEN live.instance IS NOT NULL THEN servers.connected_at END FROM servers` + liveInstanceJoin
+	args := []any{a.Hub.instanceID(), relayInstanceTTL.Seconds()}
+	tags := normalizeTags(r.URL.Query()["tag"])
+	if len(tags) > 0 {
+		args = append(args, tags)
+		switch strings.ToLower(r.URL.Query().Get("tag_mode")) {
+		case "", "all":
+			query += fmt.Sprintf(` WHERE tags @> $%d`, len(args))
+		case "any":
+			query += fmt.Sprintf(` WHERE tags && $%d`, len(args))
+		default:
+			http.Error(w, "tag_mode must be all or any", http.StatusBadRequest)
+			return
+		}
+	}
+	paged := wantsPage(r)
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if paged {
+		if cursor != nil {
+			if len(tags) == 0 {
+				query += ` WHERE`
+			} else {
+				query += ` AND`
+			}
+			args = append(args, cursor.At, cursor.ID)
+			query += fmt.Sprintf(` (created_at, id) < ($%d, $%d)`, len(args)-1, len(args))
+		}
+		args = append(args, limit+1)
+		query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d`, len(args))
+	} else {
+		query += ` ORDER BY created_at DESC`
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	rows, err := a.ReadDB.Query(ctx, query, args...)
 	if err != nil {
 		a.internalError(w, err)
 		return
@@ -237,27 +519,50 @@ func (a *App) handleListServers(w http.ResponseWriter, r *http.Request) {
 	var list []serverListItem
 	for rows.Next() {
 		var row serverRow
-		if err := rows.Scan(&row.ID, &row.Name, &row.Description, &row.ConnectedAt, &row.CreatedAt); err != nil {
+		var remoteAt *time.Time
+		if err := rows.Scan(&row.ID, &row.Name, &row.Description, &row.Tags, &row.Suspended, &row.RPCTimeout, &row.Commands, &row.CreatedAt, &remoteAt); err != nil {
 			a.internalError(w, err)
 			return
 		}
-		item := serverListItem{
-			ID:          row.ID,
-			Name:        row.Name,
-			Description: row.Description,
-			Connected:   row.ConnectedAt != nil,
-			ConnectedAt: row.ConnectedAt,
-			CreatedAt:   row.CreatedAt,
+		connectedAt := remoteAt
+		if agent := a.Hub.AgentFor(row.ID); agent != nil {
+			connectedAt = &agent.connectedAt
 		}
-		list = append(list, item)
+		list = append(list, row.listItem(connectedAt))
 	}
 
+	if paged {
+		a.writeJSON(w, newListPage(list, limit, func(s serverListItem) pageCursor {
+			return pageCursor{At: s.CreatedAt, ID: s.ID}
+		}))
+		return
+	}
 	a.writeJSON(w, list)
 }
 
+// normalizeTags trims, lowercases, and de-duplicates tags while keeping
+// their original order.
+func normalizeTags(raw []string) []string {
+	seen := make(map[string]struct{}, len(raw))
+	tags := make([]string, 0, len(raw))
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
 type createServerRequest struct {
-	Name        string  `json:"name"`
-	Description *string `json:"description"`
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	Tags        []string `json:"tags"`
 }
 
 type createServerResponse struct {
@@ -265,12 +570,24 @@ type createServerResponse struct {
 	AgentToken  string    `json:"agent_token"`
 	Name        string    `json:"name"`
 	Description *string   `json:"description,omitempty"`
+	Tags        []string  `json:"tags"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+type updateServerRequest struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+	// RPCTimeout sets the server's default RPC timeout in milliseconds; 0
+	// clears it.
+	RPCTimeout *int `json:"default_rpc_timeout_ms"`
+	// Commands turns POST /v1/servers/{id}/command on or off.
+	Commands *bool `json:"commands_enabled"`
+}
+
 func (a *App) handleCreateServer(w http.ResponseWriter, r *http.Request) {
 	var req createServerRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSONBody(r, &req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -281,16 +598,30 @@ func (a *App) handleCreateServer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tags := normalizeTags(req.Tags)
+
 	agentToken, err := generateAgentToken()
 	if err != nil {
 		a.internalError(w, err)
 		return
 	}
 
+	user := userFromContext(r.Context())
 	id := uuid.NewString()
 	now := time.Now()
-	if _, err := a.DB.Exec(r.Context(), `INSERT INTO servers (id, name, description, agent_token, created_at) VALUES ($1, $2, $3, $4, $5)`, id, req.Name, req.Description, agentToken, now); err != nil {
-		a.internalError(w, err)
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	err = pgx.BeginFunc(ctx, a.DB, func(tx pgx.Tx) error {
+		if err := a.checkServerQuota(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO servers (id, name, description, tags, agent_token_hash, owner_id, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`, id, req.Name, req.Description, tags, hashToken(agentToken), user.ID, now)
+		return err
+	})
+	if err != nil {
+		if !a.rejectServerQuota(w, user.ID, err) {
+			a.internalError(w, err)
+		}
 		return
 	}
 
@@ -299,14 +630,89 @@ func (a *App) handleCreateServer(w http.ResponseWriter, r *http.Request) {
 		AgentToken:  agentToken,
 		Name:        req.Name,
 		Description: req.Description,
+		Tags:        tags,
 		CreatedAt:   now,
 	})
 }
 
+func (a *App) handleUpdateServer(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	var req updateServerRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != nil {
+		trimmed := strings.TrimSpace(*req.Name)
+		if trimmed == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		req.Name = &trimmed
+	}
+	var tags []string
+	if req.Tags != nil {
+		tags = normalizeTags(*req.Tags)
+	}
+	rpcTimeout := 0
+	if req.RPCTimeout != nil {
+		if *req.RPCTimeout < 0 {
+			http.Error(w, "default_rpc_timeout_ms cannot be negative", http.StatusBadRequest)
+			return
+		}
+		rpcTimeout = *req.RPCTimeout
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	row, err := scanServerRow(a.DB.QueryRow(ctx, `UPDATE servers SET
+		name = COALESCE($2, name),
+		description = CASE WHEN $3 THEN $4 ELSE description END,
+		tags = CASE WHEN $5 THEN $6 ELSE tags END,
+		default_rpc_timeout_ms = CASE WHEN $7 THEN NULLIF($8::int, 0) ELSE default_rpc_timeout_ms END,
+		commands_enabled = COALESCE($9, commands_enabled)
+		WHERE id = $1 RETURNING `+serverColumns,
+		serverID, req.Name, req.Description != nil, req.Description, req.Tags != nil, tags, req.RPCTimeout != nil, rpcTimeout, req.Commands))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	a.writeJSON(w, row.listItem(a.Hub.agentConnectedAt(r.Context(), serverID)))
+}
+
+type rotateAgentTokenResponse struct {
+	ID         string `json:"id"`
+	AgentToken string `json:"agent_token"`
+}
+
+func (a *App) handleRotateAgentToken(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+
+	agentToken, err := a.rotateAgentToken(r.Context(), serverID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	a.writeJSON(w, rotateAgentTokenResponse{ID: serverID, AgentToken: agentToken})
+}
+
 func (a *App) handleGetServer(w http.ResponseWriter, r *http.Request) {
 	serverID := chi.URLParam(r, "id")
-	var row serverRow
-	if err := a.DB.QueryRow(r.Context(), `SELECT id, name, description, connected_at, created_at FROM servers WHERE id=$1`, serverID).Scan(&row.ID, &row.Name, &row.Description, &row.ConnectedAt, &row.CreatedAt); err != nil {
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	row, err := scanServerRow(a.DB.QueryRow(ctx, `SELECT `+serverColumns+` FROM servers WHERE id=$1`, serverID))
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			http.NotFound(w, r)
 			return
@@ -315,20 +721,15 @@ func (a *App) handleGetServer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.writeJSON(w, serverListItem{
-		ID:          row.ID,
-		Name:        row.Name,
-		Description: row.Description,
-		Connected:   row.ConnectedAt != nil,
-		ConnectedAt: row.ConnectedAt,
-		CreatedAt:   row.CreatedAt,
-	})
+	a.writeJSON(w, row.listItem(a.Hub.agentConnectedAt(r.Context(), serverID)))
 }
 
 func (a *App) handleServerSchema(w http.ResponseWriter, r *http.Request) {
 	serverID := chi.URLParam(r, "id")
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
 	var schema json.RawMessage
-	if err := a.DB.QueryRow(r.Context(), `SELECT schema_json FROM servers WHERE id=$1`, serverID).Scan(&schema); err != nil {
+	if err := a.DB.QueryRow(ctx, `SELECT schema_json FROM servers WHERE id=$1`, serverID).Scan(&schema); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			http.NotFound(w, r)
 			return
@@ -336,12 +737,106 @@ func (a *App) handleServerSchema(w http.ResponseWriter, r *http.Request) {
 		a.internalError(w, err)
 		return
 	}
+	schema, err := a.cipher.open(schema, aadServerSchema)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
 	if schema == nil {
-		schema = json.RawMessage("null")
+		a.writeJSON(w, pendingSchema(a.Hub.agentConnectedAt(r.Context(), serverID) != nil))
+		return
+	}
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if schema, err = a.Hub.schemaForRole(schema, user.Role); err != nil {
+		http.Error(w, fmt.Sprintf("cached schema is not valid JSON: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	if permitted, _ := strconv.ParseBool(r.URL.Query().Get("permitted")); permitted {
+		patterns, err := a.effectiveAllowlist(r.Context(), serverID)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		schema, err = filterSchemaMethods(schema, func(method string) bool {
+			return a.callableBy(user.Role, patterns, method)
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cached schema is not an OpenRPC document: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
 	}
 	a.writeJSONRaw(w, schema)
 }
 
+// schemaPendingResponse stands in for the schema before one is cached.
+// Status is "pending" while an agent is connected, since it runs
+// rpc.discover on connect, and "agent_disconnected" otherwise.
+type schemaPendingResponse struct {
+	Schema json.RawMessage `json:"schema"`
+	Status string          `json:"status"`
+}
+
+func pendingSchema(connected bool) schemaPendingResponse {
+	status := "agent_disconnected"
+	if connected {
+		status = "pending"
+	}
+	return schemaPendingResponse{Schema: json.RawMessage("null"), Status: status}
+}
+
+// serverRPCTimeout returns the server's default_rpc_timeout_ms, clamped to
+// RPC_TIMEOUT_MAX, or defaultRPCTimeout when it has none.
+func (a *App) serverRPCTimeout(ctx context.Context, serverID string) time.Duration {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+	var ms *int
+	if err := a.ReadDB.QueryRow(ctx, `SELECT default_rpc_timeout_ms FROM servers WHERE id = $1`, serverID).Scan(&ms); err != nil || ms == nil || *ms <= 0 {
+		return min(defaultRPCTimeout, a.rpcTimeoutMax)
+	}
+	return min(time.Duration(*ms)*time.Millisecond, a.rpcTimeoutMax)
+}
+
+// normalizeCallID checks a caller-supplied JSON-RPC id and re-encodes it
+// compactly. Only strings and integers are accepted: the id is sent to the
+// agent and matched against its response byte for byte, and a fractional
+// number might come back formatted differently.
+func normalizeCallID(raw json.RawMessage) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+	switch id := v.(type) {
+	case string:
+		return json.Marshal(id)
+	case json.Number:
+		n, err := id.Int64()
+		if err != nil {
+			return nil, errors.New("id must be a string or an integer")
+		}
+		return json.Marshal(n)
+	default:
+		return nil, errors.New("id must be a string or an integer")
+	}
+}
+
+// callErrorStatus maps an agent call failure to the HTTP status reported to
+// the caller.
+func callErrorStatus(err error) int {
+	if errors.Is(err, errCallIDInUse) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, errDraining) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
 func (a *App) handleServerRPC(w http.ResponseWriter, r *http.Request) {
 	serverID := chi.URLParam(r, "id")
 	user := userFromContext(r.Context())
@@ -349,41 +844,123 @@ func (a *App) handleServerRPC(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	// Checked up front so a mistyped id is a 404 rather than an allowlist,
+	// role, or offline-agent error.
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
 
 	var req JSONRPC
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSONBody(r, &req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if req.Method == commandMethod {
+		http.Error(w, errCommandViaRPC.Error(), http.StatusBadRequest)
+		return
+	}
+	// Notifications are opt-in: a call without an id is given one and
+	// waits for the agent's reply, as it always has.
+	notify := r.URL.Query().Get("notify") == "true"
+	if notify && req.ID != nil {
+		http.Error(w, "notifications must not carry an id", http.StatusBadRequest)
+		return
+	}
+	if req.ID != nil {
+		id, err := normalizeCallID(*req.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.ID = &id
+	}
+
+	// The allowlist hides methods from the API entirely, so it is checked
+	// before the caller's role.
+	if a.rejectIfNotAllowed(w, r, user.ID, serverID, req) {
+		return
+	}
+
 	minRole := roleForMethod(req.Method)
 	if !user.Role.Meets(minRole) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		a.writeJSONStatus(w, http.StatusForbidden, rbacErrorResponse{
+			Error:        "forbidden",
+			Method:       req.Method,
+			RequiredRole: minRole,
+			CurrentRole:  user.Role,
+		})
 		a.recordAudit(r.Context(), user.ID, serverID, req.Method, req.Params, "error", errors.New("rbac denied"))
 		return
 	}
+	if a.rejectWithoutSudo(w, r, req.Method) {
+		return
+	}
 
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+
+	// A nil agent with a remote owner is reached through the hub relay.
 	agent := a.Hub.AgentFor(serverID)
-	if agent == nil {
-		http.Error(w, "agent not connected", http.StatusServiceUnavailable)
-		a.recordAudit(r.Context(), user.ID, serverID, req.Method, req.Params, "error", errors.New("agent disconnected"))
+	if agent == nil && !a.Hub.RemoteAgent(r.Context(), serverID) {
+		if a.writeAgentOffline(w, r, serverID) {
+			a.recordAudit(r.Context(), user.ID, serverID, req.Method, req.Params, "error", errors.New("agent disconnected"))
+		}
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), a.serverRPCTimeout(r.Context(), serverID))
 	defer cancel()
 
-	resp, err := agent.Call(ctx, req)
+	if notify {
+		// Notification - fire and forget, no response expected
+		err := a.Hub.notify(ctx, serverID, agent, req)
+		status := "ok"
+		if err != nil {
+			status = "error"
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		} else {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		a.recordAudit(r.Context(), user.ID, serverID, req.Method, req.Params, status, err)
+		return
+	}
+
+	// Streaming needs the agent's socket; relayed calls are buffered.
+	if agent != nil && a.streamsMethod(req.Method) {
+		a.streamServerRPC(ctx, w, r, agent, user.ID, serverID, req)
+		return
+	}
+
+	started := time.Now()
+	resp, attempts, err := a.callAgent(ctx, serverID, agent, req)
+	a.logCallLatency(serverID, user.ID, req, time.Since(started))
 	status := "ok"
 	if err != nil {
 		status = "error"
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		http.Error(w, err.Error(), callErrorStatus(err))
 	} else {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(resp)
+		status, err = writeRPCResponse(w, resp)
 	}
 
-	a.recordAudit(r.Context(), user.ID, serverID, req.Method, req.Params, status, err)
+	a.recordCallAudit(r.Context(), "", user.ID, serverID, req.Method, req.Params, status, err, attempts)
+}
+
+// writeRPCResponse relays an agent's response and returns the audit status
+// with the JSON-RPC error, if any. The agent answered, but a JSON-RPC error
+// in the body still means the call failed; the error object is passed
+// through with a 422 so clients need not inspect a 200 body to notice.
+func writeRPCResponse(w http.ResponseWriter, resp json.RawMessage) (string, error) {
+	status, httpStatus := "ok", http.StatusOK
+	rpcErr := decodeJSONRPCError(resp)
+	if rpcErr != nil {
+		status, httpStatus = "error", http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	w.Write(resp)
+	return status, rpcErr
 }
 
 func (a *App) handleServerEvents(w http.ResponseWriter, r *http.Request) {
@@ -393,10 +970,28 @@ func (a *App) handleServerEvents(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !a.requireServer(w, r, serverID) {
+		return
+	}
+
+	if a.rejectIfSuspended(w, r, serverID) {
+		return
+	}
+
+	if err := a.Hub.acquireClientSlot(serverID); err != nil {
+		stats := a.Hub.ClientStats()
+		a.Logger.Warn("rejecting event client", slog.String("server_id", serverID), slog.Int("clients_connected", stats.Connected), slog.Uint64("clients_rejected_total", stats.Rejected))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer a.Hub.releaseClientSlot(serverID)
 
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		CompressionMode: websocket.CompressionContextTakeover,
 		Subprotocols:    []string{"jwt"},
+		// Only the configured origins may open event streams from a browser,
+		// so another site cannot drive a stream with a leaked token.
+		OriginPatterns: a.wsOriginPatterns,
 	})
 	if err != nil {
 		a.Logger.Error("ws accept failed", slog.Any("err", err))
@@ -408,63 +1003,241 @@ func (a *App) handleServerEvents(w http.ResponseWriter, r *http.Request) {
 		_ = conn.Close(closeStatus, closeReason)
 	}()
 
-	client := a.Hub.RegisterClient(serverID, conn)
+	client, err := a.Hub.RegisterClient(r.Context(), serverID, user.Role, conn)
+	if err != nil {
+		a.Logger.Warn("failed to send event snapshot", slog.String("server_id", serverID), slog.Any("err", err))
+		closeStatus = websocket.StatusInternalError
+		closeReason = "snapshot failed"
+		return
+	}
 	defer a.Hub.removeClient(serverID, client)
 
+	if token := r.URL.Query().Get("subscription_token"); token != "" {
+		if methods, ok := a.Hub.subscriptions.restore(token, serverID, user.ID); ok {
+			client.SetFilters(methods)
+			client.setSubscriptionToken(token)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
-	for {
-		if _, _, err := conn.Read(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
-				closeReason = "context canceled"
-				return
+	var idled atomic.Bool
+	if timeout := a.Hub.cfg.ClientIdleTimeout; timeout > 0 {
+		go func() {
+			if err := client.keepalive(ctx, timeout); err != nil {
+				a.Logger.Info("closing idle event client", slog.String("server_id", serverID), slog.Any("err", err))
+				idled.Store(true)
+				cancel()
 			}
+		}()
+	}
 
-			status := websocket.CloseStatus(err)
-			switch status {
-			case websocket.StatusNormalClosure, websocket.StatusGoingAway:
-				closeStatus = websocket.StatusNormalClosure
-				closeReason = "client closed"
-			case -1:
-				closeStatus = websocket.StatusInternalError
-				closeReason = "read failed"
-				a.Logger.Warn("ws read error", slog.String("server_id", serverID), slog.Any("err", err))
-			default:
-				closeStatus = status
-				closeReason = "closing"
-			}
+	for {
+		_, data, err := conn.Read(ctx)
+		if err == nil {
+			client.touch()
+			a.handleClientMessage(ctx, serverID, user, client, data)
+			continue
+		}
+
+		if idled.Load() {
+			closeStatus = websocket.StatusPolicyViolation
+			closeReason = "idle timeout"
+			return
+		}
+
+		if errors.Is(err, context.Canceled) {
+			closeReason = "context canceled"
+			return
+		}
+
+		if frameTooLarge(err) {
+			a.Logger.Warn("event client frame exceeds limit; closing connection", slog.String("server_id", serverID), slog.Int64("limit_bytes", a.Hub.cfg.ClientMaxFrame))
 			return
 		}
+
+		status := websocket.CloseStatus(err)
+		switch status {
+		case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+			closeStatus = websocket.StatusNormalClosure
+			closeReason = "client closed"
+		case -1:
+			closeStatus = websocket.StatusInternalError
+			closeReason = "read failed"
+			a.Logger.Warn("ws read error", slog.String("server_id", serverID), slog.Any("err", err))
+		default:
+			closeStatus = status
+			closeReason = "closing"
+		}
+		return
 	}
 }
 
+func (a *App) handleClientMessage(ctx context.Context, serverID string, user *AuthUser, client *ClientConn, data []byte) {
+	var msg clientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+
+	switch msg.Type {
+	case "rpc":
+		a.handleClientRPC(ctx, serverID, client, msg)
+	case "subscribe":
+		methods := normalizeMethodFilters(msg.Methods)
+		client.SetFilters(methods)
+		token, expiresAt, err := a.Hub.subscriptions.save(client.subscriptionToken(), serverID, user.ID, methods)
+		if err != nil {
+			a.Logger.Error("failed to save subscription", slog.Any("err", err))
+			return
+		}
+		client.setSubscriptionToken(token)
+		payload, err := json.Marshal(subscribedMessage{
+			Type:              "subscribed",
+			Methods:           methods,
+			SubscriptionToken: token,
+			ExpiresAt:         expiresAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := client.Send(sendCtx, payload); err != nil {
+			a.Logger.Warn("failed to ack subscription", slog.String("server_id", serverID), slog.Any("err", err))
+		}
+	}
+}
+
+// DrainRPC lets in-flight agent calls finish for up to grace before cancelling
+// them. Call it alongside http.Server.Shutdown.
+func (a *App) DrainRPC(grace time.Duration) {
+	a.Hub.DrainCalls(grace)
+	a.Hub.CloseRelay(context.Background())
+}
+
+// ResetConnections clears connection state recorded by a previous process.
+// Call it before serving agents.
+func (a *App) ResetConnections(ctx context.Context) (int64, error) {
+	return a.Hub.ClearConnectedAt(ctx)
+}
+
+type verifyAgentTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type verifyAgentTokenResponse struct {
+	ServerID string `json:"server_id"`
+	Name     string `json:"name"`
+}
+
+// handleVerifyAgentToken resolves an agent token to its server without
+// registering anything in the hub, for checking deployment configuration.
+func (a *App) handleVerifyAgentToken(w http.ResponseWriter, r *http.Request) {
+	token := extractBearerToken(r.Header.Get("Authorization"))
+	if token == "" && r.ContentLength != 0 {
+		var req verifyAgentTokenRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token = strings.TrimSpace(req.Token)
+	}
+	if token == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	var resp verifyAgentTokenResponse
+	if err := a.DB.QueryRow(ctx, `SELECT id, name FROM servers WHERE agent_token_hash=$1`, hashToken(token)).Scan(&resp.ServerID, &resp.Name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	a.writeJSON(w, resp)
+}
+
 func (a *App) handleAgentConnect(w http.ResponseWriter, r *http.Request) {
 	token := extractBearerToken(r.Header.Get("Authorization"))
 	if token == "" {
-		http.Error(w, "authorization required", http.StatusUnauthorized)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var serverID string
-	if err := a.DB.QueryRow(r.Context(), `SELECT id FROM servers WHERE agent_token=$1`, token).Scan(&serverID); err != nil {
+	// Checked before the token lookup so a flood from one address costs no
+	// database round trips. The slot is held for the life of the connection.
+	// The address is the peer's unless it is a trusted proxy, so a client
+	// cannot spread its connections over made-up X-Forwarded-For values.
+	ip := clientIP(r)
+	if err := a.Hub.acquireAgentIPSlot(ip); err != nil {
+		a.Logger.Warn("rejecting agent connection", slog.String("remote_ip", ip), slog.Int("limit", a.Hub.cfg.MaxAgentsPerIP))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer a.Hub.releaseAgentIPSlot(ip)
+
+	var (
+		serverID   string
+		serverName string
+		suspended  bool
+		ownerID    *string
+	)
+	lookupCtx, cancelLookup := a.queryContext(r.Context())
+	err := a.DB.QueryRow(lookupCtx, `SELECT id, name, suspended, owner_id FROM servers WHERE agent_token_hash=$1`, hashToken(token)).Scan(&serverID, &serverName, &suspended, &ownerID)
+	cancelLookup()
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
 		a.internalError(w, err)
 		return
 	}
 
+	if suspended {
+		http.Error(w, "server suspended", http.StatusLocked)
+		return
+	}
+
+	// Servers created before quotas have no owner and are not counted.
+	owner := ""
+	if ownerID != nil {
+		owner = *ownerID
+	}
+	if used, err := a.Hub.acquireOwnerAgentSlot(owner, serverID); err != nil {
+		a.Logger.Warn("rejecting agent connection", slog.String("server_id", serverID), slog.String("owner_id", owner), slog.Int("limit", a.Hub.cfg.MaxAgentsPerOwner))
+		a.writeQuotaExceeded(w, http.StatusTooManyRequests, "agent_connections", owner, used, a.Hub.cfg.MaxAgentsPerOwner)
+		return
+	}
+	defer a.Hub.releaseOwnerAgentSlot(owner, serverID)
+
+	// Lets the agent tag its own logs with a stable identity.
+	w.Header().Set("X-Conduit-Server-Id", serverID)
+	w.Header().Set("X-Conduit-Server-Name", url.PathEscape(serverName))
+	w.Header().Set("X-Conduit-Hub-Features", hubFeatures)
+
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		CompressionMode: websocket.CompressionDisabled,
+		// Agents are not browsers and authenticate with a bearer token, so
+		// the Origin header carries no meaning here.
+		InsecureSkipVerify: true,
 	})
 	if err != nil {
 		a.Logger.Error("agent ws accept failed", slog.Any("err", err))
 		return
 	}
 
-	agent := a.Hub.RegisterAgent(r.Context(), serverID, conn)
+	agent := a.Hub.RegisterAgent(r.Context(), serverID, conn, parseAgentFeatures(r.Header.Get("X-Conduit-Agent-Features")))
+	if r.Header.Get("X-Conduit-Agent-Reconnect") != "" {
+		downtime, _ := strconv.ParseInt(r.Header.Get("X-Conduit-Agent-Downtime-Ms"), 10, 64)
+		a.Hub.agentReconnected(serverID, time.Duration(max(downtime, 0))*time.Millisecond)
+	}
 
 	select {
 	case <-agent.Closed():
@@ -476,6 +1249,26 @@ func (a *App) handleAgentConnect(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *App) recordAudit(ctx context.Context, userID, serverID, action string, params json.RawMessage, status string, rpcErr error) {
+	a.submitAudit(a.newAuditEntry(userID, serverID, action, params, status, rpcErr))
+}
+
+// recordGroupAudit is recordAudit for a call issued as part of a group RPC.
+func (a *App) recordGroupAudit(ctx context.Context, groupID, userID, serverID, action string, params json.RawMessage, status string, rpcErr error) {
+	entry := a.newAuditEntry(userID, serverID, action, params, status, rpcErr)
+	entry.groupID = groupID
+	a.submitAudit(entry)
+}
+
+// recordCallAudit is recordAudit for an agent call that may have taken
+// several attempts. groupID is empty for calls outside a group RPC.
+func (a *App) recordCallAudit(ctx context.Context, groupID, userID, serverID, action string, params json.RawMessage, status string, rpcErr error, attempts int) {
+	entry := a.newAuditEntry(userID, serverID, action, params, status, rpcErr)
+	entry.groupID = groupID
+	entry.attempts = attempts
+	a.submitAudit(entry)
+}
+
+func (a *App) newAuditEntry(userID, serverID, action string, params json.RawMessage, status string, rpcErr error) auditEntry {
 	hash := sha256.Sum256(params)
 	paramsHash := hex.EncodeToString(hash[:])
 
@@ -485,12 +1278,36 @@ func (a *App) recordAudit(ctx context.Context, userID, serverID, action string,
 		errMsg = &s
 	}
 
-	_, err := a.DB.Exec(ctx, `INSERT INTO audit_logs (user_id, server_id, action, params_sha256, result_status, error_message) VALUES ($1, $2, $3, $4, $5, $6)`, userID, serverID, action, paramsHash, status, errMsg)
-	if err != nil {
-		a.Logger.Error("failed to write audit log", slog.Any("err", err))
+	var storedParams, sealedParams json.RawMessage
+	if a.auditStoreParams {
+		storedParams = redactParams(action, params, a.auditRedaction)
+		sealed, err := a.cipher.seal(storedParams, aadAuditParams)
+		if err != nil {
+			a.Logger.Error("failed to encrypt audit params", slog.Any("err", err))
+			sealed = nil
+		}
+		sealedParams = sealed
+	}
+
+	return auditEntry{
+		ts:         time.Now(),
+		userID:     userID,
+		serverID:   serverID,
+		action:     action,
+		paramsHash: paramsHash,
+		params:     sealedParams,
+		redacted:   storedParams,
+		status:     status,
+		errMsg:     errMsg,
 	}
 }
 
+// FlushAudit stops accepting audit entries and writes out any still queued.
+// Call it after the HTTP server has shut down.
+func (a *App) FlushAudit(ctx context.Context) error {
+	return a.audit.Close(ctx)
+}
+
 func (a *App) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := extractTokenFromRequest(r)
@@ -500,12 +1317,7 @@ func (a *App) authMiddleware(next http.Handler) http.Handler {
 		}
 
 		claims := jwt.MapClaims{}
-		parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("invalid signing method")
-			}
-			return a.jwtSecret, nil
-		})
+		parsed, err := jwt.ParseWithClaims(token, claims, a.jwtKey)
 		if err != nil || !parsed.Valid {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
@@ -525,11 +1337,12 @@ func (a *App) authMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
-		if sub != "" && sub != user.ID {
+		if sub != "" && !constantTimeEqual(sub, user.ID) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		setAccessLogUser(r.Context(), user.ID)
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
 		ctx = context.WithValue(ctx, contextKeySessionHash, sessionHash)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -554,6 +1367,27 @@ func (a *App) internalError(w http.ResponseWriter, err error) {
 	http.Error(w, "internal server error", http.StatusInternalServerError)
 }
 
+type rbacErrorResponse struct {
+	Error        string `json:"error"`
+	Method       string `json:"method"`
+	RequiredRole Role   `json:"required_role"`
+	CurrentRole  Role   `json:"current_role"`
+}
+
+// decodeJSONBody decodes a request body into v, rejecting fields v does not
+// declare so misspelled keys fail loudly instead of being ignored.
+func decodeJSONBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return fmt.Errorf("unknown field %s", field)
+		}
+		return err
+	}
+	return nil
+}
+
 func (a *App) writeJSON(w http.ResponseWriter, payload any) {
 	a.writeJSONStatus(w, http.StatusOK, payload)
 }
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestListItemConnectedAfterRestart checks that connectedness comes from the
+// answering process's hub. A restarted API starts with an empty hub, so a
+// server its predecessor saw connected reads as disconnected until the agent
+// reconnects, whatever servers.connected_at still says.
+func TestListItemConnectedAfterRestart(t *testing.T) {
+	const serverID = "7d3c3a52-52b4-4a7e-9a55-1d6a8f1e0c11"
+	row := serverRow{ID: serverID, Name: "survival", CreatedAt: time.Now()}
+	connectedAt := time.Now().Add(-time.Hour)
+
+	before := NewHub(nil, HubConfig{}, testLogger())
+	before.agents[serverID] = &AgentConn{serverID: serverID, connectedAt: connectedAt}
+	reconnected := NewHub(nil, HubConfig{}, testLogger())
+	reconnected.agents[serverID] = &AgentConn{serverID: serverID, connectedAt: connectedAt.Add(time.Hour)}
+	otherServer := NewHub(nil, HubConfig{}, testLogger())
+	otherServer.agents["other"] = &AgentConn{serverID: "other", connectedAt: connectedAt}
+
+	tests := []struct {
+		name   string
+		hub    *Hub
+		wantAt *time.Time
+	}{
+		{"before restart", before, &connectedAt},
+		{"after restart", NewHub(nil, HubConfig{}, testLogger()), nil},
+		{"agent reconnected", reconnected, &reconnected.agents[serverID].connectedAt},
+		{"other server's agent", otherServer, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := row.listItem(tt.hub.agentConnectedAt(context.Background(), serverID))
+			if item.Connected != (tt.wantAt != nil) {
+				t.Fatalf("connected = %v, want %v", item.Connected, tt.wantAt != nil)
+			}
+			if tt.wantAt == nil {
+				if item.ConnectedAt != nil {
+					t.Fatalf("connected_at = %v, want none", item.ConnectedAt)
+				}
+				return
+			}
+			if item.ConnectedAt == nil || !item.ConnectedAt.Equal(*tt.wantAt) {
+				t.Fatalf("connected_at = %v, want %v", item.ConnectedAt, *tt.wantAt)
+			}
+		})
+	}
+}
+
+// TestListServersConnectedAcrossInstances checks that the server list marks
+// a server connected when another live instance holds its agent, as the
+// list query's join reports, and prefers this instance's own agent.
+func TestListServersConnectedAcrossInstances(t *testing.T) {
+	now := time.Now().UTC()
+	remoteAt := now.Add(-time.Minute)
+	localAt := now.Add(-time.Second)
+	server := func(id string, connectedAt *time.Time) []any {
+		return []any{id, id, nil, []string{"survival"}, false, nil, true, now, connectedAt}
+	}
+	a := testApp(t, map[string][][]any{"live.instance": {
+		server("remote", &remoteAt),
+		server("local", nil),
+		server("offline", nil),
+	}})
+	a.Hub.agents["local"] = &AgentConn{serverID: "local", connectedAt: localAt}
+
+	rec := httptest.NewRecorder()
+	a.handleListServers(rec, httptest.NewRequest(http.MethodGet, "/v1/servers", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var list []serverListItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*time.Time{"remote": &remoteAt, "local": &localAt, "offline": nil}
+	if len(list) != len(want) {
+		t.Fatalf("got %d servers, want %d", len(list), len(want))
+	}
+	for _, item := range list {
+		wantAt := want[item.ID]
+		if item.Connected != (wantAt != nil) {
+			t.Errorf("%s: connected = %v, want %v", item.ID, item.Connected, wantAt != nil)
+			continue
+		}
+		if wantAt != nil && (item.ConnectedAt == nil || !item.ConnectedAt.Equal(*wantAt)) {
+			t.Errorf("%s: connected_at = %v, want %v", item.ID, item.ConnectedAt, *wantAt)
+		}
+	}
+}
@@ -3,13 +3,27 @@ package app
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	actionRevokeSessions = "conduit:user/revoke-sessions"
+
+	// sessionTouchInterval throttles last_seen_at updates so an active
+	// session costs at most one write per interval.
+	sessionTouchInterval = time.Minute
 )
 
 var (
@@ -22,18 +36,67 @@ func hashToken(token string) string {
 	return hex.EncodeToString(sum[:])
 }
 
+// constantTimeEqual compares two secrets or identifiers without leaking
+// the length of the matching prefix through timing.
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+var (
+	dummyPasswordOnce sync.Once
+	dummyPasswordHash []byte
+)
+
+// burnPasswordCompare performs a bcrypt comparison against a throwaway hash
+// so that logins for unknown emails take as long as wrong passwords.
+func burnPasswordCompare(password string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("conduit-dummy-password"), bcrypt.DefaultCost)
+	})
+	if dummyPasswordHash != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+	}
+}
+
+// sessionIdleExpired reports whether a session last used at lastSeen has
+// been idle longer than SESSION_IDLE_TIMEOUT. It is never true when the
+// idle timeout is off.
+func (a *App) sessionIdleExpired(lastSeen, now time.Time) bool {
+	return a.sessionIdleTimeout > 0 && now.Sub(lastSeen) > a.sessionIdleTimeout
+}
+
+// sessionTouchDue reports whether last_seen_at should be refreshed. Short
+// idle windows are refreshed more often so active use always keeps the
+// session alive.
+func (a *App) sessionTouchDue(lastSeen, now time.Time) bool {
+	interval := sessionTouchInterval
+	if a.sessionIdleTimeout > 0 {
+		interval = min(interval, a.sessionIdleTimeout/4)
+	}
+	return now.Sub(lastSeen) >= interval
+}
+
 func (a *App) lookupSession(ctx context.Context, token string) (*AuthUser, string, error) {
-	tokenHash := hashToken(token)
+	return a.lookupSessionHash(ctx, hashToken(token))
+}
+
+// lookupSessionHash is lookupSession for a token already hashed, as kept in
+// the request context. Long-lived sockets use it to recheck their session.
+func (a *App) lookupSessionHash(ctx context.Context, tokenHash string) (*AuthUser, string, error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
 
 	var (
 		userID    string
 		email     string
 		role      Role
 		expiresAt time.Time
+		lastSeen  time.Time
 		revokedAt *time.Time
+		sudoUntil *time.Time
 	)
 
-	err := a.DB.QueryRow(ctx, `SELECT s.user_id, u.email, u.role, s.expires_at, s.revoked_at FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.token_hash = $1`, tokenHash).Scan(&userID, &email, &role, &expiresAt, &revokedAt)
+	err := a.DB.QueryRow(ctx, `SELECT s.user_id, u.email, u.role, s.expires_at, s.last_seen_at, s.revoked_at, s.sudo_until FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.token_hash = $1`, tokenHash).Scan(&userID, &email, &role, &expiresAt, &lastSeen, &revokedAt, &sudoUntil)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, "", err
@@ -52,8 +115,23 @@ func (a *App) lookupSession(ctx context.Context, token string) (*AuthUser, strin
 		}
 		return nil, tokenHash, errSessionExpired
 	}
+	if a.sessionIdleExpired(lastSeen, now) {
+		if _, execErr := a.DB.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL`, tokenHash); execErr != nil {
+			a.Logger.Warn("failed to revoke idle session", slog.Any("err", execErr))
+		}
+		return nil, tokenHash, errSessionExpired
+	}
+	if a.sessionTouchDue(lastSeen, now) {
+		if _, execErr := a.DB.Exec(ctx, `UPDATE sessions SET last_seen_at = now() WHERE token_hash = $1`, tokenHash); execErr != nil {
+			a.Logger.Warn("failed to update session last seen", slog.Any("err", execErr))
+		}
+	}
 
-	return &AuthUser{ID: userID, Email: email, Role: role}, tokenHash, nil
+	user := &AuthUser{ID: userID, Email: email, Role: role}
+	if sudoUntil != nil {
+		user.sudoUntil = *sudoUntil
+	}
+	return user, tokenHash, nil
 }
 
 func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
@@ -63,10 +141,56 @@ func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := a.DB.Exec(r.Context(), `UPDATE sessions SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL`, hash); err != nil {
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	if _, err := a.DB.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL`, hash); err != nil {
 		a.internalError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+type revokeSessionsResponse struct {
+	UserID  string `json:"user_id"`
+	Revoked int64  `json:"revoked"`
+}
+
+// handleRevokeUserSessions force-logs-out a user by revoking every active
+// session; their next request fails in authMiddleware.
+func (a *App) handleRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	targetID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(targetID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+
+	var exists bool
+	if err := a.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, targetID).Scan(&exists); err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	tag, err := a.DB.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()`, targetID)
+	params, _ := json.Marshal(map[string]string{"user_id": targetID})
+	if err != nil {
+		a.recordAudit(r.Context(), user.ID, "", actionRevokeSessions, params, "error", err)
+		a.internalError(w, err)
+		return
+	}
+	a.recordAudit(r.Context(), user.ID, "", actionRevokeSessions, params, "ok", nil)
+
+	a.writeJSON(w, revokeSessionsResponse{UserID: targetID, Revoked: tag.RowsAffected()})
+}
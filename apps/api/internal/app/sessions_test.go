@@ -0,0 +1,85 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionIdleExpired(t *testing.T) {
+	lastSeen := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		idle time.Duration
+		now  time.Time
+		want bool
+	}{
+		{"disabled", 0, lastSeen.Add(365 * 24 * time.Hour), false},
+		{"just used", 30 * time.Minute, lastSeen, false},
+		{"inside window", 30 * time.Minute, lastSeen.Add(30*time.Minute - time.Nanosecond), false},
+		{"exactly at window", 30 * time.Minute, lastSeen.Add(30 * time.Minute), false},
+		{"just past window", 30 * time.Minute, lastSeen.Add(30*time.Minute + time.Nanosecond), true},
+		{"long idle", 30 * time.Minute, lastSeen.Add(24 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{sessionIdleTimeout: tt.idle}
+			if got := a.sessionIdleExpired(lastSeen, tt.now); got != tt.want {
+				t.Fatalf("sessionIdleExpired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionTouchDue(t *testing.T) {
+	lastSeen := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		idle  time.Duration
+		since time.Duration
+		want  bool
+	}{
+		{"disabled before interval", 0, sessionTouchInterval - time.Second, false},
+		{"disabled at interval", 0, sessionTouchInterval, true},
+		{"long window uses interval", time.Hour, sessionTouchInterval - time.Second, false},
+		{"long window at interval", time.Hour, sessionTouchInterval, true},
+		{"short window before quarter", 2 * time.Minute, 30*time.Second - time.Nanosecond, false},
+		{"short window at quarter", 2 * time.Minute, 30 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{sessionIdleTimeout: tt.idle}
+			if got := a.sessionTouchDue(lastSeen, lastSeen.Add(tt.since)); got != tt.want {
+				t.Fatalf("sessionTouchDue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestActiveSessionStaysAlive replays lookups at a steady pace, refreshing
+// last_seen_at only when a touch is due as lookupSession does, and checks
+// the session outlives its idle window many times over.
+func TestActiveSessionStaysAlive(t *testing.T) {
+	tests := []struct {
+		name  string
+		idle  time.Duration
+		every time.Duration
+	}{
+		{"short window", 2 * time.Minute, 110 * time.Second},
+		{"default touch interval", 10 * time.Minute, 9 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{sessionIdleTimeout: tt.idle}
+			start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			lastSeen := start
+			for now := start; now.Before(start.Add(10 * tt.idle)); now = now.Add(tt.every) {
+				if a.sessionIdleExpired(lastSeen, now) {
+					t.Fatalf("session expired %v in, last seen %v before", now.Sub(start), now.Sub(lastSeen))
+				}
+				if a.sessionTouchDue(lastSeen, now) {
+					lastSeen = now
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxAssembledResponse caps a chunked response collected for a buffered
+	// Call, so a misbehaving agent cannot exhaust memory.
+	maxAssembledResponse = 64 << 20
+	// streamStallTimeout is how long the read loop waits on a slow streaming
+	// caller before abandoning its response; other calls share the loop.
+	streamStallTimeout = 10 * time.Second
+	streamChunkBuffer  = 16
+)
+
+// agentChunk is one piece of a response relayed to a streaming caller.
+type agentChunk struct {
+	data  []byte
+	final bool
+}
+
+// pendingCall tracks one in-flight agent call. Buffered calls receive the
+// whole response on resp; streaming calls receive it piece by piece on
+// chunks. Whoever removes the call from the pending map owns ending it.
+type pendingCall struct {
+	resp    chan []byte
+	chunks  chan agentChunk
+	aborted chan struct{}
+	gone    chan struct{}
+
+	// Only touched by the read loop.
+	nextSeq int
+	buf     []byte
+}
+
+func newBufferedCall() *pendingCall {
+	return &pendingCall{resp: make(chan []byte, 1)}
+}
+
+func newStreamingCall() *pendingCall {
+	return &pendingCall{
+		chunks:  make(chan agentChunk, streamChunkBuffer),
+		aborted: make(chan struct{}),
+		gone:    make(chan struct{}),
+	}
+}
+
+// fail ends the call without a response. It must only be called by the
+// goroutine that removed the call from the pending map.
+func (p *pendingCall) fail() {
+	if p.chunks != nil {
+		close(p.aborted)
+		return
+	}
+	close(p.resp)
+}
+
+// deliver hands a complete, unchunked response to the caller.
+func (p *pendingCall) deliver(data []byte) {
+	if p.chunks != nil {
+		select {
+		case p.chunks <- agentChunk{data: data, final: true}:
+		default:
+			close(p.aborted)
+		}
+		return
+	}
+	p.resp <- data
+	close(p.resp)
+}
+
+// abandon drops a call the caller no longer waits for.
+func (a *AgentConn) abandon(idKey string) {
+	if p := a.removePending(idKey); p != nil {
+		p.fail()
+	}
+}
+
+// CallStream relays frame like Call but passes the response to emit as it
+// arrives. Agents split large responses into "chunk" control frames; a
+// response sent whole arrives as a single emit.
+func (a *AgentConn) CallStream(ctx context.Context, frame JSONRPC, emit func([]byte) error) error {
+	if err := a.hub.beginCall(); err != nil {
+		return err
+	}
+	defer a.hub.calls.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(a.hub.callsCtx, cancel)
+	defer stop()
+
+	p := newStreamingCall()
+	defer close(p.gone)
+	idKey, err := a.startCall(ctx, &frame, p)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.abandon(idKey)
+			return ctx.Err()
+		case <-a.closed:
+			a.abandon(idKey)
+			return errAgentDisconnected
+		case <-p.aborted:
+			return errors.New("agent response stream aborted")
+		case chunk := <-p.chunks:
+			if err := emit(chunk.data); err != nil {
+				a.abandon(idKey)
+				return err
+			}
+			if chunk.final {
+				return nil
+			}
+		}
+	}
+}
+
+// handleChunk routes one piece of a response the agent split into
+// {"_control":"chunk","id":...,"seq":n,"data":"<base64>","final":bool} frames.
+func (a *AgentConn) handleChunk(env map[string]json.RawMessage) {
+	var (
+		seq   int
+		data  []byte
+		final bool
+	)
+	idRaw := env["id"]
+	if len(idRaw) == 0 || json.Unmarshal(env["seq"], &seq) != nil || json.Unmarshal(env["data"], &data) != nil {
+		a.hub.logger.Warn("invalid response chunk", slog.String("server_id", a.serverID))
+		return
+	}
+	_ = json.Unmarshal(env["final"], &final)
+	idKey := string(idRaw)
+
+	a.pendMu.Lock()
+	p := a.pending[idKey]
+	a.pendMu.Unlock()
+	if p == nil {
+		return
+	}
+	if seq != p.nextSeq {
+		a.hub.logger.Warn("out of order response chunk", slog.String("server_id", a.serverID), slog.Int("seq", seq), slog.Int("expected", p.nextSeq))
+		a.abandon(idKey)
+		return
+	}
+	p.nextSeq++
+
+	if p.chunks == nil {
+		if len(p.buf)+len(data) > maxAssembledResponse {
+			a.hub.logger.Warn("chunked response too large", slog.String("server_id", a.serverID))
+			a.abandon(idKey)
+			return
+		}
+		p.buf = append(p.buf, data...)
+		if final && a.removePending(idKey) != nil {
+			var env struct {
+				JSONRPC json.RawMessage `json:"jsonrpc"`
+			}
+			_ = json.Unmarshal(p.buf, &env)
+			p.deliver(a.checkVersion(idRaw, env.JSONRPC, p.buf))
+		}
+		return
+	}
+
+	if final && a.removePending(idKey) == nil {
+		return
+	}
+	timer := time.NewTimer(streamStallTimeout)
+	defer timer.Stop()
+	select {
+	case p.chunks <- agentChunk{data: data, final: final}:
+	case <-p.gone:
+	case <-a.closed:
+	case <-timer.C:
+		a.hub.logger.Warn("streaming caller stalled; dropping response", slog.String("server_id", a.serverID))
+		if final {
+			p.fail()
+		} else {
+			a.abandon(idKey)
+		}
+	}
+}
+
+// streamServerRPC writes the agent's response to w as chunks arrive. Once
+// the first byte is out the status is committed, so a later failure can only
+// cut the body short; it is logged and audited as an error.
+func (a *App) streamServerRPC(ctx context.Context, w http.ResponseWriter, r *http.Request, agent *AgentConn, userID, serverID string, req JSONRPC) {
+	flusher, _ := w.(http.Flusher)
+	wrote := false
+	err := agent.CallStream(ctx, req, func(chunk []byte) error {
+		if !wrote {
+			w.Header().Set("Content-Type", "application/json")
+			wrote = true
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	status := "ok"
+	if err != nil {
+		status = "error"
+		if wrote {
+			a.Logger.Warn("rpc response stream interrupted", slog.String("server_id", serverID), slog.String("method", req.Method), slog.Any("err", err))
+		} else {
+			http.Error(w, err.Error(), callErrorStatus(err))
+		}
+	}
+	a.recordAudit(r.Context(), userID, serverID, req.Method, req.Params, status, err)
+}
+
+// streamsMethod reports whether handleServerRPC should stream method's
+// response instead of buffering it.
+func (a *App) streamsMethod(method string) bool {
+	for _, prefix := range a.streamMethods {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
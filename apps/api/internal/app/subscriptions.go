@@ -0,0 +1,160 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	subscriptionTokenTTL = 10 * time.Minute
+	// maxSubscriptionsPerUser and maxSubscriptions bound the token store;
+	// when either is reached the entry closest to expiry makes room.
+	maxSubscriptionsPerUser = 32
+	maxSubscriptions        = 10000
+	// subscriptionPruneInterval spaces out sweeps for expired tokens.
+	subscriptionPruneInterval = time.Minute
+)
+
+type clientMessage struct {
+	Type    string   `json:"type"`
+	Methods []string `json:"methods"`
+	// Ref, Method, and Params are set on "rpc" messages; Ref is echoed on
+	// the rpc_result reply so clients can match it to the call.
+	Ref    string          `json:"ref"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type subscribedMessage struct {
+	Type              string   `json:"type"`
+	Methods           []string `json:"methods"`
+	SubscriptionToken string   `json:"subscription_token"`
+	ExpiresAt         string   `json:"expires_at"`
+}
+
+type storedSubscription struct {
+	serverID  string
+	userID    string
+	methods   []string
+	expiresAt time.Time
+}
+
+// subscriptionStore keeps recently used event filters so a reconnecting
+// client can restore them with a short-lived token instead of re-subscribing.
+type subscriptionStore struct {
+	mu        sync.Mutex
+	entries   map[string]storedSubscription
+	perUser   map[string]int
+	lastPrune time.Time
+}
+
+func newSubscriptionStore() *subscriptionStore {
+	return &subscriptionStore{
+		entries: make(map[string]storedSubscription),
+		perUser: make(map[string]int),
+	}
+}
+
+// save stores methods and returns the token to restore them with. A
+// connection passes its current token, which is updated in place when it
+// still belongs to the same server and user, so resubscribing does not
+// grow the store.
+func (s *subscriptionStore) save(token, serverID, userID string, methods []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(subscriptionTokenTTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maybePruneLocked(now)
+	if entry, ok := s.entries[token]; !ok || entry.serverID != serverID || entry.userID != userID {
+		buf := make([]byte, 18)
+		if _, err := rand.Read(buf); err != nil {
+			return "", time.Time{}, err
+		}
+		token = base64.RawURLEncoding.EncodeToString(buf)
+		if s.perUser[userID] >= maxSubscriptionsPerUser {
+			s.evictLocked(func(e storedSubscription) bool { return e.userID == userID })
+		}
+		if len(s.entries) >= maxSubscriptions {
+			s.evictLocked(func(storedSubscription) bool { return true })
+		}
+		s.perUser[userID]++
+	}
+	s.entries[token] = storedSubscription{
+		serverID:  serverID,
+		userID:    userID,
+		methods:   append([]string(nil), methods...),
+		expiresAt: expiresAt,
+	}
+	return token, expiresAt, nil
+}
+
+// restore returns the filters saved under token when it belongs to the same
+// server and user and has not expired.
+func (s *subscriptionStore) restore(token, serverID, userID string) ([]string, bool) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maybePruneLocked(now)
+	entry, ok := s.entries[token]
+	if !ok || entry.serverID != serverID || entry.userID != userID || now.After(entry.expiresAt) {
+		return nil, false
+	}
+	return append([]string(nil), entry.methods...), true
+}
+
+// maybePruneLocked drops expired tokens at most once per
+// subscriptionPruneInterval, so lookups do not each walk the store.
+func (s *subscriptionStore) maybePruneLocked(now time.Time) {
+	if now.Sub(s.lastPrune) < subscriptionPruneInterval {
+		return
+	}
+	s.lastPrune = now
+	for token, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			s.deleteLocked(token)
+		}
+	}
+}
+
+// evictLocked removes the matching entry closest to expiry.
+func (s *subscriptionStore) evictLocked(match func(storedSubscription) bool) {
+	victim := ""
+	var oldest time.Time
+	for token, entry := range s.entries {
+		if match(entry) && (victim == "" || entry.expiresAt.Before(oldest)) {
+			victim, oldest = token, entry.expiresAt
+		}
+	}
+	if victim != "" {
+		s.deleteLocked(victim)
+	}
+}
+
+func (s *subscriptionStore) deleteLocked(token string) {
+	entry, ok := s.entries[token]
+	if !ok {
+		return
+	}
+	delete(s.entries, token)
+	if s.perUser[entry.userID] <= 1 {
+		delete(s.perUser, entry.userID)
+	} else {
+		s.perUser[entry.userID]--
+	}
+}
+
+func normalizeMethodFilters(methods []string) []string {
+	out := make([]string, 0, len(methods))
+	for _, m := range methods {
+		m = strings.TrimSpace(m)
+		if m != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionStoreReusesToken(t *testing.T) {
+	s := newSubscriptionStore()
+	token, _, err := s.save("", "srv", "u1", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		next, _, err := s.save(token, "srv", "u1", []string{fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != token {
+			t.Fatalf("resubscribe %d issued a new token", i)
+		}
+	}
+	if len(s.entries) != 1 {
+		t.Fatalf("store has %d entries, want 1", len(s.entries))
+	}
+	if got, ok := s.restore(token, "srv", "u1"); !ok || !reflect.DeepEqual(got, []string{"99"}) {
+		t.Fatalf("restore = %v, %v", got, ok)
+	}
+}
+
+func TestSubscriptionStoreRestore(t *testing.T) {
+	s := newSubscriptionStore()
+	token, _, err := s.save("", "srv", "u1", []string{"minecraft:notification/players/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := s.save("", "srv", "u1", []string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := s.entries[expired]
+	entry.expiresAt = time.Now().Add(-time.Second)
+	s.entries[expired] = entry
+
+	tests := []struct {
+		name     string
+		token    string
+		serverID string
+		userID   string
+		ok       bool
+	}{
+		{"match", token, "srv", "u1", true},
+		{"other user", token, "srv", "u2", false},
+		{"other server", token, "srv2", "u1", false},
+		{"unknown token", "nope", "srv", "u1", false},
+		{"expired", expired, "srv", "u1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := s.restore(tt.token, tt.serverID, tt.userID); ok != tt.ok {
+				t.Fatalf("restore ok = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+
+	// A token another user presents is not updated in place.
+	other, _, err := s.save(token, "srv", "u2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Fatal("u2 took over u1's token")
+	}
+}
+
+func TestSubscriptionStorePerUserCap(t *testing.T) {
+	s := newSubscriptionStore()
+	first, _, err := s.save("", "srv", "u1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxSubscriptionsPerUser+10; i++ {
+		if _, _, err := s.save("", "srv", "u1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := s.save("", "srv", "u2", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.perUser["u1"]; got != maxSubscriptionsPerUser {
+		t.Fatalf("u1 has %d tokens, want %d", got, maxSubscriptionsPerUser)
+	}
+	if got := s.perUser["u2"]; got != 1 {
+		t.Fatalf("u2 has %d tokens, want 1", got)
+	}
+	if _, ok := s.entries[first]; ok {
+		t.Fatal("oldest token was not evicted")
+	}
+}
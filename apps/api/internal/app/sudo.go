@@ -0,0 +1,128 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	actionSudo = "conduit:auth/sudo"
+
+	// Names SUDO_ACTIONS can list for owner endpoints that have no audit
+	// action of their own.
+	actionAgentTokenRotate = "conduit:server/agent-token"
+	actionAPIKeyCreate     = "conduit:api-key/create"
+	actionAPIKeyDelete     = "conduit:api-key/delete"
+
+	defaultSudoWindow = 5 * time.Minute
+)
+
+type sudoRequest struct {
+	Password string `json:"password"`
+}
+
+type sudoResponse struct {
+	SudoUntil time.Time `json:"sudo_until"`
+}
+
+type sudoRequiredResponse struct {
+	Error  string `json:"error"`
+	Action string `json:"action"`
+	// WindowMs is how long a successful POST /v1/auth/sudo lasts.
+	WindowMs int64 `json:"sudo_window_ms"`
+}
+
+// needsSudo reports whether action is in SUDO_ACTIONS. Entries use the RPC
+// allowlist syntax; an empty list protects nothing.
+func (a *App) needsSudo(action string) bool {
+	return len(a.sudoActions) > 0 && methodAllowed(a.sudoActions, action)
+}
+
+// rejectWithoutSudo writes 403 sudo_required and returns true when action
+// is protected and the caller's session has no sudo window in effect.
+func (a *App) rejectWithoutSudo(w http.ResponseWriter, r *http.Request, action string) bool {
+	if !a.needsSudo(action) {
+		return false
+	}
+	user := userFromContext(r.Context())
+	if user != nil && time.Now().Before(user.sudoUntil) {
+		return false
+	}
+	a.writeJSONStatus(w, http.StatusForbidden, sudoRequiredResponse{
+		Error:    "sudo_required",
+		Action:   action,
+		WindowMs: a.sudoWindow.Milliseconds(),
+	})
+	return true
+}
+
+// sudo guards a route whose action is fixed by the route itself.
+func (a *App) sudo(action string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.rejectWithoutSudo(w, r, action) {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// sudoLimitKeys limits sudo attempts per user as well as per address, so
+// spreading guesses for one account over many addresses does not help.
+func sudoLimitKeys(r *http.Request) []string {
+	keys := []string{"ip:" + clientIP(r)}
+	if user := userFromContext(r.Context()); user != nil {
+		keys = append(keys, "user:"+user.ID)
+	}
+	return keys
+}
+
+// handleSudo re-checks the caller's password and opens a sudo window on the
+// current session, which protected actions require.
+func (a *App) handleSudo(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	sessionHash := sessionHashFromContext(r.Context())
+	if user == nil || sessionHash == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req sudoRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		http.Error(w, "password required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	var stored string
+	if err := a.DB.QueryRow(ctx, `SELECT password_hash FROM users WHERE id = $1`, user.ID).Scan(&stored); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(req.Password)); err != nil {
+		a.recordAudit(r.Context(), user.ID, "", actionSudo, nil, "error", errors.New("invalid password"))
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	until := time.Now().Add(a.sudoWindow).UTC()
+	if _, err := a.DB.Exec(ctx, `UPDATE sessions SET sudo_until = $2 WHERE token_hash = $1 AND revoked_at IS NULL`, sessionHash, until); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	a.recordAudit(r.Context(), user.ID, "", actionSudo, nil, "ok", nil)
+	a.writeJSON(w, sudoResponse{SudoUntil: until})
+}
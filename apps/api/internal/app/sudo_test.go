@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSudoLimiter checks that sudo attempts are limited per user across
+// addresses and per address across users.
+func TestSudoLimiter(t *testing.T) {
+	type attempt struct {
+		user, ip string
+		want     int
+	}
+	tests := []struct {
+		name     string
+		attempts []attempt
+	}{
+		{"same user, new address", []attempt{
+			{"u1", "198.51.100.1", http.StatusOK},
+			{"u1", "198.51.100.1", http.StatusOK},
+			{"u1", "198.51.100.2", http.StatusTooManyRequests},
+		}},
+		{"same address, new user", []attempt{
+			{"u1", "198.51.100.1", http.StatusOK},
+			{"u2", "198.51.100.1", http.StatusOK},
+			{"u3", "198.51.100.1", http.StatusTooManyRequests},
+		}},
+		{"unrelated callers", []attempt{
+			{"u1", "198.51.100.1", http.StatusOK},
+			{"u1", "198.51.100.1", http.StatusOK},
+			{"u2", "198.51.100.2", http.StatusOK},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(2, time.Minute)
+			handler := limiter.middlewareBy(sudoLimitKeys, func(http.ResponseWriter, *http.Request) {})
+			for i, at := range tt.attempts {
+				req := httptest.NewRequest(http.MethodPost, "/v1/auth/sudo", nil)
+				req.RemoteAddr = at.ip + ":4000"
+				req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, &AuthUser{ID: at.user}))
+				rec := httptest.NewRecorder()
+				handler(rec, req)
+				if rec.Code != at.want {
+					t.Fatalf("attempt %d (%s from %s) = %d, want %d", i, at.user, at.ip, rec.Code, at.want)
+				}
+			}
+		})
+	}
+}
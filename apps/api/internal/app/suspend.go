@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"nhooyr.io/websocket"
+)
+
+const (
+	actionServerSuspend = "conduit:server/suspend"
+	actionServerResume  = "conduit:server/resume"
+)
+
+func (a *App) serverSuspended(ctx context.Context, serverID string) (bool, error) {
+	ctx, cancel := a.queryContext(ctx)
+	defer cancel()
+	var suspended bool
+	err := a.DB.QueryRow(ctx, `SELECT suspended FROM servers WHERE id = $1`, serverID).Scan(&suspended)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return suspended, err
+}
+
+// rejectIfSuspended writes 423 Locked and returns true when the server is
+// suspended. Unknown servers are left to the caller's own handling.
+func (a *App) rejectIfSuspended(w http.ResponseWriter, r *http.Request, serverID string) bool {
+	suspended, err := a.serverSuspended(r.Context(), serverID)
+	if err != nil {
+		a.internalError(w, err)
+		return true
+	}
+	if suspended {
+		http.Error(w, "server suspended", http.StatusLocked)
+		return true
+	}
+	return false
+}
+
+func (a *App) handleSuspendServer(w http.ResponseWriter, r *http.Request) {
+	a.setServerSuspended(w, r, true)
+}
+
+func (a *App) handleResumeServer(w http.ResponseWriter, r *http.Request) {
+	a.setServerSuspended(w, r, false)
+}
+
+func (a *App) setServerSuspended(w http.ResponseWriter, r *http.Request, suspended bool) {
+	serverID := chi.URLParam(r, "id")
+	user := userFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := a.queryContext(r.Context())
+	defer cancel()
+	row, err := scanServerRow(a.DB.QueryRow(ctx, `UPDATE servers SET suspended = $2 WHERE id = $1 RETURNING `+serverColumns, serverID, suspended))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	action := actionServerResume
+	if suspended {
+		action = actionServerSuspend
+		a.Hub.disconnectServer(serverID, websocket.StatusPolicyViolation, "server suspended")
+	}
+	a.recordAudit(r.Context(), user.ID, serverID, action, nil, "ok", nil)
+
+	a.writeJSON(w, row.listItem(a.Hub.agentConnectedAt(r.Context(), serverID)))
+}
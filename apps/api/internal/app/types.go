@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"time"
 )
 
 type contextKey string
@@ -10,6 +11,7 @@ type contextKey string
 const (
 	contextKeyUser        contextKey = "user"
 	contextKeySessionHash contextKey = "session-hash"
+	contextKeyAccessLog   contextKey = "access-log"
 )
 
 type Role string
@@ -34,6 +36,9 @@ type AuthUser struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
 	Role  Role   `json:"role"`
+	// sudoUntil is when the session's sudo window closes; zero when it
+	// never opened.
+	sudoUntil time.Time
 }
 
 type JSONRPC struct {
@@ -56,6 +61,16 @@ func userFromContext(ctx context.Context) *AuthUser {
 	return nil
 }
 
+func contextWithAccessLogUser(ctx context.Context, holder *accessLogUser) context.Context {
+	return context.WithValue(ctx, contextKeyAccessLog, holder)
+}
+
+func setAccessLogUser(ctx context.Context, userID string) {
+	if holder, ok := ctx.Value(contextKeyAccessLog).(*accessLogUser); ok {
+		holder.id = userID
+	}
+}
+
 func sessionHashFromContext(ctx context.Context) string {
 	v := ctx.Value(contextKeySessionHash)
 	if hash, ok := v.(string); ok {
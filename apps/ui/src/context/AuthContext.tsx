@@ -63,8 +63,11 @@ export const AuthProvider = ({ children }: AuthProviderProps) => {
   }, [persist]);
 
   const bootstrap = useCallback(async (email: string, password: string) => {
-    await apiClient.bootstrap(email, password);
-  }, []);
+    const res = await apiClient.bootstrapAndLogin(email, password);
+    setUser(res.user);
+    setToken(res.token);
+    persist(res);
+  }, [persist]);
 
   const logout = useCallback(async () => {
     try {
@@ -38,7 +38,6 @@ const LoginPage = () => {
     setError(null);
     try {
       await bootstrap(email, password);
-      await login(email, password);
       redirectAfterAuth();
     } catch (err) {
       setError((err as Error).message);
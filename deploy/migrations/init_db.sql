@@ -15,18 +15,43 @@ CREATE TABLE servers (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
   name TEXT NOT NULL,
   description TEXT,
-  agent_token TEXT UNIQUE NOT NULL,
+  tags TEXT[] NOT NULL DEFAULT '{}',
+  suspended BOOLEAN NOT NULL DEFAULT false,
+  default_rpc_timeout_ms INTEGER CHECK (default_rpc_timeout_ms > 0),
+  commands_enabled BOOLEAN NOT NULL DEFAULT true,
+  event_filter_allow TEXT[] NOT NULL DEFAULT '{}',
+  event_filter_deny TEXT[] NOT NULL DEFAULT '{}',
+  agent_token_hash TEXT UNIQUE NOT NULL,
   schema_json JSONB,
+  schema_sha256 TEXT,
   connected_at TIMESTAMPTZ,
+  agent_last_seen_at TIMESTAMPTZ,
+  agent_instance TEXT,
+  owner_id UUID REFERENCES users(id) ON DELETE SET NULL,
   created_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
+CREATE TABLE server_groups (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT UNIQUE NOT NULL,
+  description TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE server_group_members (
+  group_id UUID NOT NULL REFERENCES server_groups(id) ON DELETE CASCADE,
+  server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+  PRIMARY KEY (group_id, server_id)
+);
+
 CREATE TABLE sessions (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
   user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
   token_hash TEXT NOT NULL,
   revoked_at TIMESTAMPTZ,
+  sudo_until TIMESTAMPTZ,
   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
   expires_at TIMESTAMPTZ NOT NULL
 );
 
@@ -35,11 +60,15 @@ CREATE TABLE audit_logs (
   ts TIMESTAMPTZ NOT NULL DEFAULT now(),
   user_id UUID REFERENCES users(id),
   server_id UUID REFERENCES servers(id) ON DELETE CASCADE,
+  group_id UUID REFERENCES server_groups(id) ON DELETE SET NULL,
   action TEXT NOT NULL,
   params_sha256 TEXT NOT NULL,
+  params_json JSONB,
   result_status TEXT NOT NULL CHECK (result_status IN ('ok','error')),
   error_code INT,
-  error_message TEXT
+  error_message TEXT,
+  attempts INTEGER NOT NULL DEFAULT 1,
+  replay_of BIGINT REFERENCES audit_logs(id) ON DELETE SET NULL
 );
 
 CREATE TABLE api_keys (
@@ -50,6 +79,27 @@ CREATE TABLE api_keys (
   created_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
+CREATE TABLE rpc_method_allowlist (
+  server_id UUID REFERENCES servers(id) ON DELETE CASCADE,
+  pattern TEXT NOT NULL
+);
+
+CREATE TABLE hub_instances (
+  id TEXT PRIMARY KEY,
+  seen_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE hub_relay (
+  id BIGSERIAL PRIMARY KEY,
+  target TEXT NOT NULL,
+  body JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
 CREATE UNIQUE INDEX idx_sessions_token_hash ON sessions(token_hash);
 CREATE INDEX idx_sessions_user_active ON sessions(user_id) WHERE revoked_at IS NULL;
+CREATE INDEX idx_servers_tags ON servers USING GIN (tags);
+CREATE INDEX idx_servers_owner ON servers(owner_id);
+CREATE INDEX idx_server_group_members_server ON server_group_members(server_id);
 CREATE INDEX idx_audit_server_ts ON audit_logs(server_id, ts DESC);
+CREATE INDEX idx_rpc_method_allowlist_server ON rpc_method_allowlist(server_id);
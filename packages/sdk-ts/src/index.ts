@@ -13,21 +13,121 @@ export interface LoginResponse {
   user: AuthUser;
 }
 
+export interface IntrospectResponse {
+  active: boolean;
+  reason?: string;
+  claims: { sub: string; role: Role; exp: string } | null;
+  session: {
+    user_role: Role;
+    expires_at: string;
+    last_seen_at: string;
+    revoked_at: string | null;
+    idle_expires_at: string | null;
+  } | null;
+}
+
 export interface AuditLogEntry {
   id: number;
   timestamp: string;
   user_id?: string;
   user_email?: string;
+  group_id?: string;
   action: string;
   params_sha256: string;
+  params?: unknown;
   result_status: string;
   error_message?: string;
+  attempts: number;
+  replay_of?: number;
+}
+
+export interface ReplayResponse {
+  replay_of: number;
+  method: string;
+  response: unknown;
+}
+
+export interface RetentionPreview {
+  cutoff: string;
+  total: number;
+  servers: { server_id: string | null; server_name?: string; count: number }[];
+}
+
+/** Versioned server configuration returned by exportServer. */
+export interface ServerBundle {
+  format: "conduit.server";
+  version: 1;
+  exported_at?: string;
+  server: {
+    name: string;
+    description?: string;
+    tags: string[];
+    suspended: boolean;
+    default_rpc_timeout_ms?: number;
+    commands_enabled: boolean;
+    event_filter?: EventFilter;
+  };
+  rpc_allowlist: string[];
+  groups: string[];
+  schema: unknown;
+}
+
+export interface DrainResult {
+  drained: string[];
+  unsupported: string[];
+  failed: string[];
+}
+
+/** One owner's usage; the `max_` fields are null when that quota is off. */
+export interface OwnerQuotaUsage {
+  owner_id: string;
+  email: string;
+  servers: number;
+  max_servers: number | null;
+  agents_connected: number;
+  max_agents: number | null;
+}
+
+/** Sent on the event socket to make an RPC call; `ref` comes back on the matching `EventRpcResult`. */
+export interface EventRpcRequest {
+  type: "rpc";
+  ref?: string;
+  method: string;
+  params?: unknown;
+}
+
+/** Reply to an `EventRpcRequest`; `status` is what `POST /rpc` would have returned. */
+export interface EventRpcResult {
+  type: "rpc_result";
+  ref?: string;
+  status: number;
+  response?: unknown;
+  error?: string;
+}
+
+/** Frame sent on the audit tail stream; the audit row id is not known yet. */
+export interface AuditTailEvent extends Omit<AuditLogEntry, "id" | "user_email"> {
+  _event: "audit";
+}
+
+export interface AuditCount {
+  key: string;
+  count: number;
+}
+
+export interface AuditStats {
+  total: number;
+  by_status: AuditCount[];
+  top_actions: AuditCount[];
+  by_user: { user_id?: string; user_email?: string; count: number }[];
 }
 
 export interface AuditExportOptions {
   from?: string | Date;
   to?: string | Date;
   limit?: number;
+  /** Adds a tamper-evident chain_sha256 column and a trailing `#chain_final` row. */
+  chain?: boolean;
   signal?: AbortSignal;
 }
 
@@ -39,20 +139,173 @@ export interface GameRulePreset {
   settings?: Record<string, unknown>;
 }
 
+export interface GameRulePresetListEntry extends GameRulePreset {
+  source: "builtin";
+  editable: boolean;
+}
+
 export interface PresetApplicationResult {
   type: "gamerule" | "setting";
   name: string;
   value: unknown;
-  status: "ok" | "error";
+  status: "ok" | "error" | "skipped";
   message?: string;
 }
 
 export interface ApplyPresetResponse {
   preset: GameRulePreset;
   results: PresetApplicationResult[];
+  atomic: boolean;
+  rolled_back: boolean;
+  rollback?: PresetApplicationResult[];
   duration_ms: number;
 }
 
+export interface PresetDiffEntry {
+  type: "gamerule" | "setting";
+  name: string;
+  current: unknown;
+  target: unknown;
+  changed: boolean;
+}
+
+export interface PresetDiffResponse {
+  preset: GameRulePreset;
+  entries: PresetDiffEntry[];
+  changed: number;
+}
+
+export interface GameRuleValue {
+  key: string;
+  value: unknown;
+  type?: string;
+}
+
+export interface ServerSettingCatalogEntry {
+  key: string;
+  method: string;
+  get_method: string;
+  param: string;
+  type: "bool" | "int" | "enum" | "string";
+  choices?: string[];
+  min?: number;
+  max?: number;
+}
+
+export type AnnouncementLevel = "info" | "warning" | "critical";
+
+/** Frame pushed to event clients by the announce endpoints. */
+export interface AnnouncementEvent {
+  _event: "announcement";
+  server_id?: string;
+  message: string;
+  level: AnnouncementLevel;
+  from: string;
+  sent_at: string;
+}
+
+export interface ServerGroup {
+  id: string;
+  name: string;
+  description?: string;
+  server_ids: string[];
+  created_at: string;
+}
+
+export interface GroupRpcResult {
+  server_id: string;
+  status: "ok" | "error" | "timeout" | "suspended";
+  response?: unknown;
+  error?: string;
+}
+
+export interface GroupRpcResponse {
+  group_id: string;
+  method: string;
+  results: GroupRpcResult[];
+  summary: { ok: number; error: number; timeout: number; suspended: number };
+}
+
+export interface LastRpcResponse {
+  method: string;
+  response: unknown;
+  received_at: string;
+}
+
+/** Returned by getServerSchema until the agent reports an rpc.discover document. */
+export interface SchemaPending {
+  schema: null;
+  status: "pending" | "agent_disconnected";
+}
+
+export interface SchemaProbeResult {
+  ok: boolean;
+  latency_ms: number;
+  methods: number;
+  persisted: boolean;
+  error?: string;
+}
+
+/** Exact method names, or prefixes ending in `*`. Empty means unrestricted. */
+export interface RpcAllowlist {
+  server_id?: string;
+  methods: string[];
+}
+
+/** Notification method prefixes; deny wins, and a non-empty allow drops everything else. */
+export interface EventFilter {
+  server_id?: string;
+  allow: string[];
+  deny: string[];
+}
+
+export interface MethodPermission {
+  method: string;
+  required_role: "viewer" | "moderator" | "owner";
+  allowlisted: boolean;
+  allowed: boolean;
+}
+
+export interface ServerPermissions {
+  server_id: string;
+  role: "viewer" | "moderator" | "owner";
+  methods: MethodPermission[];
+  other: MethodPermission;
+  actions: Record<string, { required_role: string; allowed: boolean }>;
+}
+
+export interface AgentLogEntry {
+  time: string;
+  received_at: string;
+  level: string;
+  message: string;
+  attrs?: Record<string, unknown>;
+  dropped?: number;
+}
+
+/** Counter totals an agent has pushed to the API instance that answered. */
+export interface AgentTelemetry {
+  totals: Record<string, number>;
+  last_sample_at: string;
+  last_error?: string;
+  samples_total: number;
+  batches_total: number;
+  gzip_batches_total: number;
+  dropped_total: number;
+}
+
+/** Envelope the list endpoints return with `?v=2`. */
+export interface ListPage<T> {
+  items: T[];
+  next_cursor: string | null;
+  has_more: boolean;
+}
+
+export interface PageOptions {
+  limit?: number;
+  cursor?: string;
+}
+
 export interface ApiKeySummary {
   id: string;
   name: string;
@@ -67,6 +320,10 @@ export interface ServerListItem {
   id: string;
   name: string;
   description?: string | null;
+  tags: string[];
+  suspended: boolean;
+  default_rpc_timeout_ms?: number;
+  commands_enabled: boolean;
   connected: boolean;
   connected_at?: string | null;
   created_at: string;
@@ -89,6 +346,23 @@ export interface JsonRpcRequest {
   params?: unknown;
 }
 
+/** First frame sent on every server event stream. */
+export interface ServerSnapshotEvent {
+  _event: "snapshot";
+  server_id: string;
+  connected: boolean;
+  connected_at: string | null;
+  schema: unknown;
+}
+
+/** Sent to event clients when the agent comes back after losing its previous session. */
+export interface AgentReconnectedEvent {
+  _event: "agent_reconnected";
+  server_id: string;
+  downtime_ms: number;
+  reconnected_at: string;
+}
+
 interface WebSocketConstructor {
   new (url: string, protocols?: string | string[]): WebSocketLike;
 }
@@ -152,12 +426,27 @@ const resolveWebSocket = (custom?: WebSocketConstructor): WebSocketConstructor =
   return WS as unknown as WebSocketConstructor;
 };
 
+const pageParams = (options?: PageOptions): URLSearchParams => {
+  const params = new URLSearchParams({ v: "2" });
+  if (options?.limit != null) {
+    params.set("limit", String(options.limit));
+  }
+  if (options?.cursor) {
+    params.set("cursor", options.cursor);
+  }
+  return params;
+};
+
 export class ConduitClient {
   readonly apiBase: string;
   readonly wsBase: string;
   private token: string | null;
   private readonly fetchImpl: typeof fetch;
   private readonly WebSocketImpl: WebSocketConstructor;
+  private rpcSeq = 0;
+  // The API rejects an id already in flight on a server, so ids are prefixed
+  // per client to keep separate clients from colliding.
+  private readonly rpcPrefix = Math.random().toString(36).slice(2, 10);
 
   constructor(options: ConduitClientOptions = {}) {
     const apiBase = normalizeBase(options.apiBase).replace(/\/$/, "");
@@ -192,6 +481,19 @@ export class ConduitClient {
     this.setToken(null);
   }
 
+  /** Explains whether the current token is accepted, and why not; works for rejected tokens too. */
+  async introspect(): Promise<IntrospectResponse> {
+    return this.fetchJson<IntrospectResponse>("/v1/auth/introspect");
+  }
+
+  /** Re-enters the password so actions in the API's SUDO_ACTIONS are allowed until `sudo_until`. */
+  async sudo(password: string): Promise<{ sudo_until: string }> {
+    return this.fetchJson<{ sudo_until: string }>("/v1/auth/sudo", {
+      method: "POST",
+      body: JSON.stringify({ password })
+    });
+  }
+
   async bootstrap(email: string, password: string): Promise<void> {
     await this.fetchJson<void>("/v1/users/bootstrap", {
       method: "POST",
@@ -199,23 +501,179 @@ export class ConduitClient {
     });
   }
 
-  async listServers(): Promise<ServerListItem[]> {
-    return this.fetchJson<ServerListItem[]>("/v1/servers");
+  /** Creates the first owner and signs in as them in one request. */
+  async bootstrapAndLogin(email: string, password: string): Promise<LoginResponse> {
+    const res = await this.fetchJson<LoginResponse>("/v1/users/bootstrap?login=true", {
+      method: "POST",
+      body: JSON.stringify({ email, password })
+    });
+    this.setToken(res.token);
+    return res;
+  }
+
+  async listServers(options?: { tags?: string[]; tagMode?: "all" | "any" }): Promise<ServerListItem[]> {
+    const params = new URLSearchParams();
+    for (const tag of options?.tags ?? []) {
+      params.append("tag", tag);
+    }
+    if (options?.tagMode) {
+      params.set("tag_mode", options.tagMode);
+    }
+    const suffix = params.size > 0 ? `?${params.toString()}` : "";
+    return this.fetchJson<ServerListItem[]>(`/v1/servers${suffix}`);
+  }
+
+  async listServersPage(
+    options?: PageOptions & { tags?: string[]; tagMode?: "all" | "any" }
+  ): Promise<ListPage<ServerListItem>> {
+    const params = pageParams(options);
+    for (const tag of options?.tags ?? []) {
+      params.append("tag", tag);
+    }
+    if (options?.tagMode) {
+      params.set("tag_mode", options.tagMode);
+    }
+    return this.fetchJson<ListPage<ServerListItem>>(`/v1/servers?${params.toString()}`);
+  }
+
+  async updateServer(
+    id: string,
+    input: {
+      name?: string;
+      description?: string | null;
+      tags?: string[];
+      default_rpc_timeout_ms?: number;
+      commands_enabled?: boolean;
+    }
+  ): Promise<ServerListItem> {
+    return this.fetchJson<ServerListItem>(`/v1/servers/${id}`, {
+      method: "PATCH",
+      body: JSON.stringify(input)
+    });
   }
 
-  async createServer(input: { name: string; description?: string | null }): Promise<{ id: string; agent_token: string }> {
+  async createServer(input: { name: string; description?: string | null; tags?: string[] }): Promise<{ id: string; agent_token: string }> {
     return this.fetchJson<{ id: string; agent_token: string }>("/v1/servers", {
       method: "POST",
       body: JSON.stringify(input)
     });
   }
 
+  async exportServer(id: string): Promise<ServerBundle> {
+    return this.fetchJson<ServerBundle>(`/v1/servers/${id}/export`);
+  }
+
+  /** Creates a new server from a bundle; the response carries its new agent token. */
+  async importServer(bundle: ServerBundle): Promise<{ id: string; agent_token: string; missing_groups: string[] }> {
+    return this.fetchJson<{ id: string; agent_token: string; missing_groups: string[] }>("/v1/servers/import", {
+      method: "POST",
+      body: JSON.stringify(bundle)
+    });
+  }
+
+  async rotateAgentToken(id: string): Promise<{ id: string; agent_token: string }> {
+    return this.fetchJson<{ id: string; agent_token: string }>(`/v1/servers/${id}/agent-token`, {
+      method: "POST"
+    });
+  }
+
+  async getAgentConfig(id: string, options?: { includeToken?: boolean }): Promise<string> {
+    const suffix = options?.includeToken ? "?include_token=true" : "";
+    const response = await this.request(`/v1/servers/${id}/agent-config${suffix}`, {
+      method: "GET",
+      headers: { Accept: "text/plain" }
+    });
+
+    const text = await response.text();
+    if (!response.ok) {
+      this.throwForError(response, text);
+    }
+
+    return text;
+  }
+
+  async suspendServer(id: string): Promise<ServerListItem> {
+    return this.fetchJson<ServerListItem>(`/v1/servers/${id}/suspend`, { method: "POST" });
+  }
+
+  async resumeServer(id: string): Promise<ServerListItem> {
+    return this.fetchJson<ServerListItem>(`/v1/servers/${id}/resume`, { method: "POST" });
+  }
+
   async getServer(id: string): Promise<ServerDetail> {
     return this.fetchJson<ServerDetail>(`/v1/servers/${id}`);
   }
 
-  async getServerSchema(id: string): Promise<unknown> {
-    return this.fetchJson<unknown>(`/v1/servers/${id}/schema`);
+  async getServerSchema(id: string, options?: { permitted?: boolean }): Promise<unknown | SchemaPending> {
+    const suffix = options?.permitted ? "?permitted=true" : "";
+    return this.fetchJson<unknown | SchemaPending>(`/v1/servers/${id}/schema${suffix}`);
+  }
+
+  async probeServerSchema(id: string, options?: { persist?: boolean }): Promise<SchemaProbeResult> {
+    const suffix = options?.persist ? "?persist=true" : "";
+    return this.fetchJson<SchemaProbeResult>(`/v1/servers/${id}/schema/probe${suffix}`, { method: "POST" });
+  }
+
+  /** Counts audit entries older than `olderThan` (a duration such as "2160h" or a timestamp) without deleting them. */
+  async previewAuditRetention(olderThan: string | Date): Promise<RetentionPreview> {
+    const value = olderThan instanceof Date ? olderThan.toISOString() : olderThan;
+    const params = new URLSearchParams({ older_than: value });
+    return this.fetchJson<RetentionPreview>(`/v1/admin/audit/retention-preview?${params.toString()}`);
+  }
+
+  /** Asks agents to reconnect after `delayMs`, optionally to another API endpoint. */
+  async drainAgents(options: { delayMs?: number; url?: string; serverId?: string } = {}): Promise<DrainResult> {
+    return this.fetchJson<DrainResult>("/v1/admin/agents/drain", {
+      method: "POST",
+      body: JSON.stringify({ delay_ms: options.delayMs, url: options.url, server_id: options.serverId })
+    });
+  }
+
+  async getQuotaUsage(): Promise<OwnerQuotaUsage[]> {
+    return this.fetchJson<OwnerQuotaUsage[]>("/v1/admin/quotas");
+  }
+
+  /** Temporarily allows methods the agent's own method policy blocks. */
+  async overrideAgentPolicy(
+    serverId: string,
+    methods: string[],
+    durationMs: number
+  ): Promise<{ server_id: string; methods: string[]; expires_at: string }> {
+    return this.fetchJson<{ server_id: string; methods: string[]; expires_at: string }>(
+      `/v1/servers/${serverId}/agent-policy/override`,
+      {
+        method: "POST",
+        body: JSON.stringify({ methods, duration_ms: durationMs })
+      }
+    );
+  }
+
+  async getServerPermissions(serverId: string): Promise<ServerPermissions> {
+    return this.fetchJson<ServerPermissions>(`/v1/servers/${serverId}/permissions`);
+  }
+
+  async getRpcAllowlist(serverId?: string): Promise<RpcAllowlist> {
+    const path = serverId ? `/v1/servers/${serverId}/rpc-allowlist` : "/v1/rpc-allowlist";
+    return this.fetchJson<RpcAllowlist>(path);
+  }
+
+  async setRpcAllowlist(methods: string[], serverId?: string): Promise<RpcAllowlist> {
+    const path = serverId ? `/v1/servers/${serverId}/rpc-allowlist` : "/v1/rpc-allowlist";
+    return this.fetchJson<RpcAllowlist>(path, {
+      method: "PUT",
+      body: JSON.stringify({ methods })
+    });
+  }
+
+  async getEventFilter(serverId: string): Promise<EventFilter> {
+    return this.fetchJson<EventFilter>(`/v1/servers/${serverId}/event-filter`);
+  }
+
+  async setEventFilter(serverId: string, filter: { allow?: string[]; deny?: string[] }): Promise<EventFilter> {
+    return this.fetchJson<EventFilter>(`/v1/servers/${serverId}/event-filter`, {
+      method: "PUT",
+      body: JSON.stringify({ allow: filter.allow ?? [], deny: filter.deny ?? [] })
+    });
   }
 
   async listAuditLogs(id: string, limit?: number): Promise<AuditLogEntry[]> {
@@ -227,38 +685,110 @@ export class ConduitClient {
     return this.fetchJson<AuditLogEntry[]>(`/v1/servers/${id}/audit${suffix}`);
   }
 
-  async listGameRulePresets(): Promise<GameRulePreset[]> {
-    return this.fetchJson<GameRulePreset[]>("/v1/game-rule-presets");
+  async listAuditLogsPage(id: string, options?: PageOptions): Promise<ListPage<AuditLogEntry>> {
+    return this.fetchJson<ListPage<AuditLogEntry>>(`/v1/servers/${id}/audit?${pageParams(options).toString()}`);
   }
 
-  async applyGameRulePreset(id: string, presetKey: string): Promise<ApplyPresetResponse> {
-    return this.fetchJson<ApplyPresetResponse>(`/v1/servers/${id}/gamerules/apply-preset`, {
-      method: "POST",
-      body: JSON.stringify({ preset: presetKey })
-    });
+  /** Re-issues a failed RPC from its audit entry; `force` is required for methods that may change state. */
+  async replayAuditEntry(id: string, auditId: number, options?: { force?: boolean }): Promise<ReplayResponse> {
+    const suffix = options?.force ? "?force=true" : "";
+    return this.fetchJson<ReplayResponse>(`/v1/servers/${id}/audit/${auditId}/replay${suffix}`, { method: "POST" });
   }
 
-  async exportAuditLogs(id: string, options?: AuditExportOptions): Promise<string> {
+  async getAuditStats(id: string, options?: { from?: string | Date; to?: string | Date }): Promise<AuditStats> {
     const params = new URLSearchParams();
     const normalize = (value: string | Date): string => (value instanceof Date ? value.toISOString() : value);
-
     if (options?.from) {
       params.set("from", normalize(options.from));
     }
     if (options?.to) {
       params.set("to", normalize(options.to));
     }
+    const suffix = params.size > 0 ? `?${params.toString()}` : "";
+    return this.fetchJson<AuditStats>(`/v1/servers/${id}/audit/stats${suffix}`);
+  }
+
+  async listGameRulePresets(): Promise<GameRulePresetListEntry[]> {
+    return this.fetchJson<GameRulePresetListEntry[]>("/v1/game-rule-presets");
+  }
+
+  async getServerSettingsCatalog(): Promise<ServerSettingCatalogEntry[]> {
+    return this.fetchJson<ServerSettingCatalogEntry[]>("/v1/server-settings/catalog");
+  }
+
+  async getLastRpcResponse(id: string, method: string): Promise<LastRpcResponse> {
+    return this.fetchJson<LastRpcResponse>(`/v1/servers/${id}/rpc/last?method=${encodeURIComponent(method)}`);
+  }
+
+  async getAgentLogs(id: string, options?: { level?: "WARN" | "ERROR"; limit?: number }): Promise<AgentLogEntry[]> {
+    const params = new URLSearchParams();
+    if (options?.level) {
+      params.set("level", options.level);
+    }
     if (options?.limit != null) {
       params.set("limit", String(options.limit));
     }
-
     const suffix = params.size > 0 ? `?${params.toString()}` : "";
-    const response = await this.request(`/v1/servers/${id}/audit/export${suffix}`, {
-      method: "GET",
-      headers: { Accept: "text/csv" },
-      signal: options?.signal
+    return this.fetchJson<AgentLogEntry[]>(`/v1/servers/${id}/agent-logs${suffix}`);
+  }
+
+  async getAgentTelemetry(id: string): Promise<AgentTelemetry> {
+    return this.fetchJson<AgentTelemetry>(`/v1/servers/${id}/agent-telemetry`);
+  }
+
+  /** Runs a raw console command; needs COMMAND_MIN_ROLE and commands_enabled on the server. */
+  async runServerCommand(id: string, command: string): Promise<{ output?: string; result: unknown }> {
+    return this.fetchJson<{ output?: string; result: unknown }>(`/v1/servers/${id}/command`, {
+      method: "POST",
+      body: JSON.stringify({ command })
     });
+  }
 
+  async sendSystemMessage(id: string, message: string, target?: string): Promise<{ result: unknown }> {
+    return this.fetchJson<{ result: unknown }>(`/v1/servers/${id}/message`, {
+      method: "POST",
+      body: JSON.stringify(target ? { message, target } : { message })
+    });
+  }
+
+  async announce(id: string, message: string, level?: AnnouncementLevel): Promise<{ delivered: number }> {
+    return this.fetchJson<{ delivered: number }>(`/v1/servers/${id}/announce`, {
+      method: "POST",
+      body: JSON.stringify({ message, level })
+    });
+  }
+
+  async announceGlobal(message: string, level?: AnnouncementLevel): Promise<{ delivered: number }> {
+    return this.fetchJson<{ delivered: number }>("/v1/announce", {
+      method: "POST",
+      body: JSON.stringify({ message, level })
+    });
+  }
+
+  async getConsole(id: string, lines?: number): Promise<{ lines: string[] }> {
+    const query = lines ? `?lines=${lines}` : "";
+    return this.fetchJson<{ lines: string[] }>(`/v1/servers/${id}/console${query}`);
+  }
+
+  async getPresetDiff(id: string, presetKey: string): Promise<PresetDiffResponse> {
+    return this.fetchJson<PresetDiffResponse>(
+      `/v1/servers/${id}/gamerules/preset-diff?preset=${encodeURIComponent(presetKey)}`
+    );
+  }
+
+  async getGameRule(id: string, key: string): Promise<GameRuleValue> {
+    return this.fetchJson<GameRuleValue>(`/v1/servers/${id}/gamerules/${encodeURIComponent(key)}`);
+  }
+
+  async applyGameRulePreset(id: string, presetKey: string, options?: { atomic?: boolean }): Promise<ApplyPresetResponse> {
+    return this.fetchJson<ApplyPresetResponse>(`/v1/servers/${id}/gamerules/apply-preset`, {
+      method: "POST",
+      body: JSON.stringify({ preset: presetKey, atomic: options?.atomic ?? false })
+    });
+  }
+
+  async exportAuditLogs(id: string, options?: AuditExportOptions): Promise<string> {
+    const response = await this.requestAuditExport(id, options, "text/csv");
     const text = await response.text();
     if (!response.ok) {
       this.throwForError(response, text);
@@ -267,10 +797,27 @@ export class ConduitClient {
     return text;
   }
 
-  async callServerRpc<T = unknown>(id: string, method: string, params: unknown): Promise<T> {
+  /** Downloads the audit export as a gzip file (`.csv.gz`), e.g. for archiving without decompressing. */
+  async exportAuditLogsGzip(id: string, options?: AuditExportOptions): Promise<ArrayBuffer> {
+    const response = await this.requestAuditExport(id, options, "application/gzip", { compress: "gzip" });
+    if (!response.ok) {
+      this.throwForError(response, await response.text());
+    }
+
+    return response.arrayBuffer();
+  }
+
+  /** `options.id` is sent as the JSON-RPC id instead of a generated one, for correlation in your own logs. */
+  async callServerRpc<T = unknown>(
+    id: string,
+    method: string,
+    params: unknown,
+    options?: { id?: string | number }
+  ): Promise<T> {
+    const rpcId = options?.id ?? `${this.rpcPrefix}-${++this.rpcSeq}`;
     const result = await this.fetchJson<{ result: T } | T>(`/v1/servers/${id}/rpc`, {
       method: "POST",
-      body: JSON.stringify({ method, params })
+      body: JSON.stringify({ jsonrpc: "2.0", id: rpcId, method, params })
     });
 
     if (result && typeof result === "object" && "result" in result) {
@@ -279,16 +826,58 @@ export class ConduitClient {
     return result as T;
   }
 
-  openServerEvents(serverId: string): WebSocketLike {
+  async notifyServerRpc(id: string, method: string, params: unknown): Promise<void> {
+    await this.fetchJson<void>(`/v1/servers/${id}/rpc?notify=true`, {
+      method: "POST",
+      body: JSON.stringify({ jsonrpc: "2.0", method, params })
+    });
+  }
+
+  /** Opens the server's event socket. Besides receiving events, send `EventRpcRequest` frames on it to make RPC calls. */
+  openServerEvents(serverId: string, options?: { subscriptionToken?: string }): WebSocketLike {
     if (!this.token) {
       throw new Error("Authentication required to open event stream");
     }
-    const socket = new this.WebSocketImpl(`${this.wsBase}/ws/servers/${serverId}/events`, ["jwt", this.token]);
+    const suffix = options?.subscriptionToken
+      ? `?subscription_token=${encodeURIComponent(options.subscriptionToken)}`
+      : "";
+    const socket = new this.WebSocketImpl(`${this.wsBase}/ws/servers/${serverId}/events${suffix}`, ["jwt", this.token]);
     return socket;
   }
 
-  async listApiKeys(): Promise<ApiKeySummary[]> {
-    return this.fetchJson<ApiKeySummary[]>("/v1/api-keys");
+  /** Streams the server's audit entries as they are recorded (moderator). Frames are `AuditTailEvent`s. */
+  openAuditTail(serverId: string): WebSocketLike {
+    if (!this.token) {
+      throw new Error("Authentication required to open audit tail");
+    }
+    return new this.WebSocketImpl(`${this.wsBase}/ws/servers/${serverId}/audit-tail`, ["jwt", this.token]);
+  }
+
+  async revokeUserSessions(userId: string): Promise<{ user_id: string; revoked: number }> {
+    return this.fetchJson<{ user_id: string; revoked: number }>(`/v1/users/${userId}/revoke-sessions`, { method: "POST" });
+  }
+
+  async listApiKeys(options?: { name?: string; limit?: number; offset?: number }): Promise<ApiKeySummary[]> {
+    const params = new URLSearchParams();
+    if (options?.name) {
+      params.set("name", options.name);
+    }
+    if (options?.limit != null) {
+      params.set("limit", String(options.limit));
+    }
+    if (options?.offset != null) {
+      params.set("offset", String(options.offset));
+    }
+    const suffix = params.size > 0 ? `?${params.toString()}` : "";
+    return this.fetchJson<ApiKeySummary[]>(`/v1/api-keys${suffix}`);
+  }
+
+  async listApiKeysPage(options?: PageOptions & { name?: string }): Promise<ListPage<ApiKeySummary>> {
+    const params = pageParams(options);
+    if (options?.name) {
+      params.set("name", options.name);
+    }
+    return this.fetchJson<ListPage<ApiKeySummary>>(`/v1/api-keys?${params.toString()}`);
   }
 
   async createApiKey(name: string): Promise<ApiKeyWithSecret> {
@@ -298,12 +887,78 @@ export class ConduitClient {
     });
   }
 
+  async listGroups(): Promise<ServerGroup[]> {
+    return this.fetchJson<ServerGroup[]>("/v1/groups");
+  }
+
+  async getGroup(id: string): Promise<ServerGroup> {
+    return this.fetchJson<ServerGroup>(`/v1/groups/${id}`);
+  }
+
+  async createGroup(name: string, description?: string): Promise<ServerGroup> {
+    return this.fetchJson<ServerGroup>("/v1/groups", {
+      method: "POST",
+      body: JSON.stringify({ name, description })
+    });
+  }
+
+  async deleteGroup(id: string): Promise<void> {
+    await this.fetchJson<void>(`/v1/groups/${id}`, { method: "DELETE" });
+  }
+
+  async addGroupServer(groupId: string, serverId: string): Promise<void> {
+    await this.fetchJson<void>(`/v1/groups/${groupId}/servers/${serverId}`, { method: "PUT" });
+  }
+
+  async removeGroupServer(groupId: string, serverId: string): Promise<void> {
+    await this.fetchJson<void>(`/v1/groups/${groupId}/servers/${serverId}`, { method: "DELETE" });
+  }
+
+  /** Calls every group member; members still running after `timeoutMs` come back as "timeout". */
+  async callGroupRpc(groupId: string, method: string, params?: unknown, options?: { timeoutMs?: number }): Promise<GroupRpcResponse> {
+    const suffix = options?.timeoutMs ? `?timeout_ms=${options.timeoutMs}` : "";
+    return this.fetchJson<GroupRpcResponse>(`/v1/groups/${groupId}/rpc${suffix}`, {
+      method: "POST",
+      body: JSON.stringify({ jsonrpc: "2.0", method, params })
+    });
+  }
+
   async deleteApiKey(id: string): Promise<void> {
     await this.fetchJson<void>(`/v1/api-keys/${id}`, {
       method: "DELETE"
     });
   }
 
+  private async requestAuditExport(
+    id: string,
+    options: AuditExportOptions | undefined,
+    accept: string,
+    extra?: Record<string, string>
+  ): Promise<Response> {
+    const params = new URLSearchParams(extra);
+    const normalize = (value: string | Date): string => (value instanceof Date ? value.toISOString() : value);
+
+    if (options?.from) {
+      params.set("from", normalize(options.from));
+    }
+    if (options?.to) {
+      params.set("to", normalize(options.to));
+    }
+    if (options?.limit != null) {
+      params.set("limit", String(options.limit));
+    }
+    if (options?.chain) {
+      params.set("chain", "true");
+    }
+
+    const suffix = params.size > 0 ? `?${params.toString()}` : "";
+    return this.request(`/v1/servers/${id}/audit/export${suffix}`, {
+      method: "GET",
+      headers: { Accept: accept },
+      signal: options?.signal
+    });
+  }
+
   private async request(path: string, init: RequestInit = {}): Promise<Response> {
     const headers = new Headers(init.headers ?? {});
     if (!headers.has("Content-Type") && init.body) {
@@ -326,8 +981,12 @@ export class ConduitClient {
     if (trimmed) {
       try {
         const parsed = JSON.parse(trimmed) as { error?: unknown };
+        const rpcError = parsed?.error as { code?: unknown; message?: unknown } | undefined;
         if (parsed && typeof parsed.error === "string" && parsed.error.trim() !== "") {
           message = parsed.error;
+        } else if (rpcError && typeof rpcError === "object" && typeof rpcError.message === "string") {
+          // JSON-RPC error objects relayed with 422 by /rpc.
+          message = typeof rpcError.code === "number" ? `${rpcError.message} (${rpcError.code})` : rpcError.message;
         } else if (!message) {
           message = trimmed;
         }